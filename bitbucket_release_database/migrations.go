@@ -0,0 +1,67 @@
+package bitbucket_release_database
+
+import (
+	"github.com/sharovik/devbot/internal/container"
+	"github.com/sharovik/orm/clients"
+)
+
+// CreateReleasesTableMigration creates the table for the release runs
+type CreateReleasesTableMigration struct {
+}
+
+func (m CreateReleasesTableMigration) GetName() string {
+	return "bitbucket_release_create_releases_table"
+}
+
+func (m CreateReleasesTableMigration) Execute() error {
+	model := releasesModel()
+	model.AddModelField(varcharField("user", varcharLength))
+	model.AddModelField(varcharField("channel", varcharLength))
+	model.AddModelField(varcharField("status", varcharLength))
+	model.AddModelField(varcharField("error", longVarcharLength))
+	model.AddModelField(integerField("created_at"))
+	model.AddModelField(integerField("finished_at"))
+
+	_, err := container.C.Dictionary.GetDBClient().Execute(new(clients.Query).Create(model).IfNotExists())
+	return err
+}
+
+// CreateReleasePullRequestsTableMigration creates the table for the results of the pull-requests in the release runs
+type CreateReleasePullRequestsTableMigration struct {
+}
+
+func (m CreateReleasePullRequestsTableMigration) GetName() string {
+	return "bitbucket_release_create_release_pull_requests_table"
+}
+
+func (m CreateReleasePullRequestsTableMigration) Execute() error {
+	model := releasePullRequestsModel()
+	model.AddModelField(integerField("release_id"))
+	model.AddModelField(varcharField("workspace", varcharLength))
+	model.AddModelField(varcharField("repository_slug", varcharLength))
+	model.AddModelField(integerField("pull_request_id"))
+	model.AddModelField(varcharField("title", varcharLength))
+	model.AddModelField(varcharField("url", varcharLength))
+	model.AddModelField(varcharField("status", varcharLength))
+	model.AddModelField(varcharField("reason", longVarcharLength))
+	model.AddModelField(varcharField("destination_branch", varcharLength))
+	model.AddModelField(varcharField("merge_commit", varcharLength))
+	model.AddModelField(varcharField("release_branch", varcharLength))
+	model.AddModelField(varcharField("release_pull_request_link", varcharLength))
+
+	_, err := container.C.Dictionary.GetDBClient().Execute(new(clients.Query).Create(model).IfNotExists())
+	return err
+}
+
+// AddHostToReleasePullRequestsMigration adds the host of VCS provider to the results of the pull-requests. It is empty for bitbucket.org repositories
+type AddHostToReleasePullRequestsMigration struct {
+}
+
+func (m AddHostToReleasePullRequestsMigration) GetName() string {
+	return "bitbucket_release_add_host_to_release_pull_requests_table"
+}
+
+func (m AddHostToReleasePullRequestsMigration) Execute() error {
+	_, err := container.C.Dictionary.GetDBClient().Execute(new(clients.Query).Alter(releasePullRequestsModel()).AddColumn(varcharField("host", varcharLength)))
+	return err
+}
@@ -0,0 +1,57 @@
+package bitbucket_release_database
+
+import (
+	cdto "github.com/sharovik/orm/dto"
+)
+
+const (
+	releasesTableName                  = "bitbucket_releases"
+	releasePullRequestsTableName       = "bitbucket_release_pull_requests"
+	varcharLength                int64 = 255
+	longVarcharLength            int64 = 2000
+)
+
+// releasesModel returns the model of the table with the release runs
+func releasesModel() *cdto.BaseModel {
+	model := new(cdto.BaseModel)
+	model.SetTableName(releasesTableName)
+	model.SetPrimaryKey(cdto.ModelField{
+		Name:          "id",
+		Type:          cdto.IntegerColumnType,
+		AutoIncrement: true,
+		IsPrimaryKey:  true,
+	})
+
+	return model
+}
+
+// releasePullRequestsModel returns the model of the table with the results of the pull-requests in the release runs
+func releasePullRequestsModel() *cdto.BaseModel {
+	model := new(cdto.BaseModel)
+	model.SetTableName(releasePullRequestsTableName)
+	model.SetPrimaryKey(cdto.ModelField{
+		Name:          "id",
+		Type:          cdto.IntegerColumnType,
+		AutoIncrement: true,
+		IsPrimaryKey:  true,
+	})
+
+	return model
+}
+
+func varcharField(name string, length int64) cdto.ModelField {
+	return cdto.ModelField{
+		Name:       name,
+		Type:       cdto.VarcharColumnType,
+		Length:     length,
+		IsNullable: true,
+	}
+}
+
+func integerField(name string) cdto.ModelField {
+	return cdto.ModelField{
+		Name:       name,
+		Type:       cdto.IntegerColumnType,
+		IsNullable: true,
+	}
+}
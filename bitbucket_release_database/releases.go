@@ -0,0 +1,251 @@
+package bitbucket_release_database
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/container"
+	"github.com/sharovik/orm/clients"
+	cdto "github.com/sharovik/orm/dto"
+	"github.com/sharovik/orm/query"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrReleaseNotFound the error, which is returned when there is no release with selected ID
+	ErrReleaseNotFound = errors.New("The release was not found.")
+
+	// ErrReleasePullRequestNotFound the error, which is returned when the pull-request was not merged by any release
+	ErrReleasePullRequestNotFound = errors.New("The pull-request was not merged by any release.")
+)
+
+// SaveRelease stores the release run with the results of all its pull-requests
+func SaveRelease(release *bitbucketrelease_dto.Release) error {
+	model := releasesModel()
+	model.AddModelField(cdto.ModelField{Name: "user", Value: release.User})
+	model.AddModelField(cdto.ModelField{Name: "channel", Value: release.Channel})
+	model.AddModelField(cdto.ModelField{Name: "status", Value: release.Status})
+	model.AddModelField(cdto.ModelField{Name: "error", Value: release.Error})
+	model.AddModelField(cdto.ModelField{Name: "created_at", Value: release.CreatedAt.Unix()})
+	model.AddModelField(cdto.ModelField{Name: "finished_at", Value: release.FinishedAt.Unix()})
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(new(clients.Query).Insert(model))
+	if err != nil {
+		return errors.Wrap(err, "Failed to save the release")
+	}
+
+	release.ID = res.LastInsertID()
+
+	for i := range release.PullRequests {
+		release.PullRequests[i].ReleaseID = release.ID
+		if err = saveReleasePullRequest(&release.PullRequests[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SaveReleasePullRequest stores the result of the pull-request, which was merged after the release was saved, e.g. the release pull-request merged by the auto-merge
+func SaveReleasePullRequest(pullRequest *bitbucketrelease_dto.ReleasePullRequest) error {
+	return saveReleasePullRequest(pullRequest)
+}
+
+func saveReleasePullRequest(pullRequest *bitbucketrelease_dto.ReleasePullRequest) error {
+	model := releasePullRequestsModel()
+	model.AddModelField(cdto.ModelField{Name: "release_id", Value: pullRequest.ReleaseID})
+	model.AddModelField(cdto.ModelField{Name: "host", Value: pullRequest.Host})
+	model.AddModelField(cdto.ModelField{Name: "workspace", Value: pullRequest.Workspace})
+	model.AddModelField(cdto.ModelField{Name: "repository_slug", Value: pullRequest.RepositorySlug})
+	model.AddModelField(cdto.ModelField{Name: "pull_request_id", Value: pullRequest.PullRequestID})
+	model.AddModelField(cdto.ModelField{Name: "title", Value: pullRequest.Title})
+	model.AddModelField(cdto.ModelField{Name: "url", Value: pullRequest.URL})
+	model.AddModelField(cdto.ModelField{Name: "status", Value: pullRequest.Status})
+	model.AddModelField(cdto.ModelField{Name: "reason", Value: pullRequest.Reason})
+	model.AddModelField(cdto.ModelField{Name: "destination_branch", Value: pullRequest.DestinationBranch})
+	model.AddModelField(cdto.ModelField{Name: "merge_commit", Value: pullRequest.MergeCommit})
+	model.AddModelField(cdto.ModelField{Name: "release_branch", Value: pullRequest.ReleaseBranch})
+	model.AddModelField(cdto.ModelField{Name: "release_pull_request_link", Value: pullRequest.ReleasePullRequestLink})
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(new(clients.Query).Insert(model))
+	if err != nil {
+		return errors.Wrap(err, "Failed to save the release pull-request")
+	}
+
+	pullRequest.ID = res.LastInsertID()
+	return nil
+}
+
+// FindReleases returns the latest releases, which match the filter. The pull-requests of the releases are not loaded
+func FindReleases(filter bitbucketrelease_dto.ReleaseFilter) ([]bitbucketrelease_dto.Release, error) {
+	if filter.Repository != "" {
+		return findReleasesByRepository(filter)
+	}
+
+	q := new(clients.Query).
+		Select([]interface{}{}).
+		From(releasesModel())
+
+	if filter.User != "" {
+		q = q.Where(query.Where{First: "user", Operator: "=", Second: query.Bind{Field: "user", Value: filter.User}})
+	}
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(q.OrderBy("id", query.OrderDirectionDesc).Limit(query.Limit{From: 0, To: filter.Limit}))
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to find the releases")
+	}
+
+	var releases []bitbucketrelease_dto.Release
+	for _, item := range res.Items() {
+		releases = append(releases, releaseFromModel(item))
+	}
+
+	return releases, nil
+}
+
+func findReleasesByRepository(filter bitbucketrelease_dto.ReleaseFilter) ([]bitbucketrelease_dto.Release, error) {
+	q := new(clients.Query).
+		Select([]interface{}{"release_id"}).
+		From(releasePullRequestsModel()).
+		Where(query.Where{First: "repository_slug", Operator: "=", Second: query.Bind{Field: "repository_slug", Value: filter.Repository}}).
+		OrderBy("release_id", query.OrderDirectionDesc)
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to find the releases of the repository")
+	}
+
+	var (
+		releases []bitbucketrelease_dto.Release
+		found    = map[int64]bool{}
+	)
+
+	for _, item := range res.Items() {
+		if int64(len(releases)) >= filter.Limit {
+			break
+		}
+
+		releaseID := toInt64(item.GetField("release_id").Value)
+		if found[releaseID] {
+			continue
+		}
+
+		found[releaseID] = true
+
+		release, err := findRelease(releaseID)
+		if err != nil {
+			return nil, err
+		}
+
+		if filter.User != "" && release.User != filter.User {
+			continue
+		}
+
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+// FindRelease returns the release with the results of all its pull-requests
+func FindRelease(releaseID int64) (bitbucketrelease_dto.Release, error) {
+	release, err := findRelease(releaseID)
+	if err != nil {
+		return release, err
+	}
+
+	release.PullRequests, err = findReleasePullRequests(releaseID)
+	return release, err
+}
+
+func findRelease(releaseID int64) (bitbucketrelease_dto.Release, error) {
+	q := new(clients.Query).
+		Select([]interface{}{}).
+		From(releasesModel()).
+		Where(query.Where{First: "id", Operator: "=", Second: query.Bind{Field: "id", Value: releaseID}})
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(q)
+	if err != nil {
+		return bitbucketrelease_dto.Release{}, errors.Wrap(err, "Failed to find the release")
+	}
+
+	if len(res.Items()) == 0 {
+		return bitbucketrelease_dto.Release{}, ErrReleaseNotFound
+	}
+
+	return releaseFromModel(res.Items()[0]), nil
+}
+
+func findReleasePullRequests(releaseID int64) ([]bitbucketrelease_dto.ReleasePullRequest, error) {
+	q := new(clients.Query).
+		Select([]interface{}{}).
+		From(releasePullRequestsModel()).
+		Where(query.Where{First: "release_id", Operator: "=", Second: query.Bind{Field: "release_id", Value: releaseID}}).
+		OrderBy("id", query.OrderDirectionAsc)
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(q)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to find the release pull-requests")
+	}
+
+	var pullRequests []bitbucketrelease_dto.ReleasePullRequest
+	for _, item := range res.Items() {
+		pullRequests = append(pullRequests, releasePullRequestFromModel(item))
+	}
+
+	return pullRequests, nil
+}
+
+func releasePullRequestFromModel(item cdto.ModelInterface) bitbucketrelease_dto.ReleasePullRequest {
+	return bitbucketrelease_dto.ReleasePullRequest{
+		ID:                     toInt64(item.GetField("id").Value),
+		ReleaseID:              toInt64(item.GetField("release_id").Value),
+		Host:                   toString(item.GetField("host").Value),
+		Workspace:              toString(item.GetField("workspace").Value),
+		RepositorySlug:         toString(item.GetField("repository_slug").Value),
+		PullRequestID:          toInt64(item.GetField("pull_request_id").Value),
+		Title:                  toString(item.GetField("title").Value),
+		URL:                    toString(item.GetField("url").Value),
+		Status:                 toString(item.GetField("status").Value),
+		Reason:                 toString(item.GetField("reason").Value),
+		DestinationBranch:      toString(item.GetField("destination_branch").Value),
+		MergeCommit:            toString(item.GetField("merge_commit").Value),
+		ReleaseBranch:          toString(item.GetField("release_branch").Value),
+		ReleasePullRequestLink: toString(item.GetField("release_pull_request_link").Value),
+	}
+}
+
+func releaseFromModel(item cdto.ModelInterface) bitbucketrelease_dto.Release {
+	return bitbucketrelease_dto.Release{
+		ID:         toInt64(item.GetField("id").Value),
+		User:       toString(item.GetField("user").Value),
+		Channel:    toString(item.GetField("channel").Value),
+		Status:     toString(item.GetField("status").Value),
+		Error:      toString(item.GetField("error").Value),
+		CreatedAt:  time.Unix(toInt64(item.GetField("created_at").Value), 0),
+		FinishedAt: time.Unix(toInt64(item.GetField("finished_at").Value), 0),
+	}
+}
+
+// FindMergedReleasePullRequest returns the latest release result of the merged pull-request. The empty host means bitbucket.org
+func FindMergedReleasePullRequest(host string, workspace string, repository string, pullRequestID int64) (bitbucketrelease_dto.ReleasePullRequest, error) {
+	q := new(clients.Query).
+		Select([]interface{}{}).
+		From(releasePullRequestsModel()).
+		Where(query.Where{First: "pull_request_id", Operator: "=", Second: query.Bind{Field: "pull_request_id", Value: pullRequestID}}).
+		OrderBy("id", query.OrderDirectionDesc)
+
+	res, err := container.C.Dictionary.GetDBClient().Execute(q)
+	if err != nil {
+		return bitbucketrelease_dto.ReleasePullRequest{}, errors.Wrap(err, "Failed to find the release pull-request")
+	}
+
+	for _, item := range res.Items() {
+		pullRequest := releasePullRequestFromModel(item)
+		if strings.EqualFold(pullRequest.Host, host) && pullRequest.Workspace == workspace && pullRequest.RepositorySlug == repository && pullRequest.Status == bitbucketrelease_dto.PullRequestStatusMerged {
+			return pullRequest, nil
+		}
+	}
+
+	return bitbucketrelease_dto.ReleasePullRequest{}, ErrReleasePullRequestNotFound
+}
@@ -0,0 +1,35 @@
+package bitbucket_release_database
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// toString converts the value received from the database into string
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// toInt64 converts the value received from the database into int64
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	case float64:
+		return int64(v)
+	default:
+		result, _ := strconv.ParseInt(toString(v), 10, 64)
+		return result
+	}
+}
@@ -0,0 +1,245 @@
+package bitbucket_release_services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/internal/container"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	apiBaseURL      = "https://api.bitbucket.org/2.0"
+	apiTokenURL     = "https://bitbucket.org/site/oauth2/access_token"
+	apiTimeout      = 30 * time.Second
+	apiTokenRefresh = 60 * time.Second
+)
+
+// APIError the error, which is returned when the API of VCS provider responds with not successful status code
+type APIError struct {
+	//Host the host of the API, e.g. `api.bitbucket.org` or `api.github.com`
+	Host string
+
+	StatusCode int
+	Body       string
+
+	//RetryAfter the delay from Retry-After header of the response
+	RetryAfter time.Duration
+}
+
+func (e APIError) Error() string {
+	if e.Host == "" {
+		return fmt.Sprintf("The API responded with status code %d: %s", e.StatusCode, e.Body)
+	}
+
+	return fmt.Sprintf("The API of %s responded with status code %d: %s", e.Host, e.StatusCode, e.Body)
+}
+
+// apiClient the client for BitBucket API endpoints, which are not available in the devbot BitBucket client
+type apiClient struct {
+	mutex          sync.Mutex
+	httpClient     *http.Client
+	token          string
+	tokenExpiresAt time.Time
+}
+
+type apiTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+var api = &apiClient{
+	httpClient: &http.Client{Timeout: apiTimeout},
+}
+
+func (c *apiClient) accessToken(ctx context.Context) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.token != "" && time.Now().Before(c.tokenExpiresAt) {
+		return c.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, apiTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+
+	request.SetBasicAuth(container.C.Config.BitBucketConfig.ClientID, container.C.Config.BitBucketConfig.ClientSecret)
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var response apiTokenResponse
+	if err = c.do(request, &response); err != nil {
+		return "", errors.Wrap(err, "Failed to get BitBucket access token")
+	}
+
+	c.token = response.AccessToken
+	c.tokenExpiresAt = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - apiTokenRefresh)
+
+	return c.token, nil
+}
+
+// request sends the request to the BitBucket API endpoint and decodes the response into result
+func (c *apiClient) request(ctx context.Context, method string, endpoint string, body interface{}, result interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	if body != nil {
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	if !strings.HasPrefix(endpoint, "http") {
+		endpoint = apiBaseURL + endpoint
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	request.Header.Set("Content-Type", "application/json")
+
+	return c.do(request, result)
+}
+
+// requestRaw sends the GET request to the BitBucket API endpoint and returns the raw response body
+func (c *apiClient) requestRaw(ctx context.Context, endpoint string) ([]byte, error) {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, apiBaseURL+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	return c.send(request)
+}
+
+// requestForm sends the multipart form to the BitBucket API endpoint
+func (c *apiClient) requestForm(ctx context.Context, endpoint string, fields url.Values, files map[string][]byte) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	var (
+		body   = &bytes.Buffer{}
+		writer = multipart.NewWriter(body)
+	)
+
+	for name, values := range fields {
+		for _, value := range values {
+			if err = writer.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for path, content := range files {
+		part, err := writer.CreateFormFile(path, path)
+		if err != nil {
+			return err
+		}
+
+		if _, err = part.Write(content); err != nil {
+			return err
+		}
+	}
+
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, apiBaseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+
+	_, err = c.send(request)
+	return err
+}
+
+func (c *apiClient) do(request *http.Request, result interface{}) error {
+	content, err := c.send(request)
+	if err != nil {
+		return err
+	}
+
+	if result == nil || len(content) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(content, result)
+}
+
+// send sends the request. Only the reading requests are retried here, the changing requests are retried by the provider, which can check their result.
+// The requests of the context without retries are sent once
+func (c *apiClient) send(request *http.Request) (content []byte, err error) {
+	if !isIdempotentMethod(request.Method) || !retriesRequests(request.Context()) {
+		return c.sendOnce(request)
+	}
+
+	attempt := 0
+	err = withRetry(request.Context(), fmt.Sprintf("%s %s request", request.Method, request.URL.Path), func() error {
+		attempt++
+		if attempt > 1 && request.GetBody != nil {
+			if request.Body, err = request.GetBody(); err != nil {
+				return err
+			}
+		}
+
+		content, err = c.sendOnce(request)
+		return err
+	})
+
+	return content, err
+}
+
+func (c *apiClient) sendOnce(request *http.Request) ([]byte, error) {
+	response, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusMultipleChoices {
+		return nil, APIError{
+			Host:       request.URL.Hostname(),
+			StatusCode: response.StatusCode,
+			Body:       string(content),
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
+	}
+
+	return content, nil
+}
@@ -0,0 +1,117 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/container"
+	"strings"
+)
+
+// ApprovalPolicyFor returns the approval policy of the selected repository. The reviewers of the repository are always required, even when the approval rules are defined.
+// For bitbucket.org the required reviewers of the BitBucket configuration must always approve the pull-request
+func ApprovalPolicyFor(host string, workspace string, repository string) bitbucketrelease_dto.ApprovalPolicy {
+	config := RepositoryConfigFor(host, workspace, repository)
+
+	var policy bitbucketrelease_dto.ApprovalPolicy
+	if config.Approval != nil {
+		policy = *config.Approval
+	}
+
+	policy.RequiredApprovers = withRequiredApprovers(policy.RequiredApprovers, config.Reviewers)
+
+	if IsBitBucketCloud(host) {
+		policy.RequiredApprovers = withRequiredApprovers(policy.RequiredApprovers, requiredReviewerUUIDs())
+	}
+
+	return policy
+}
+
+// requiredReviewerUUIDs returns the UUIDs of the required reviewers of the BitBucket configuration
+func requiredReviewerUUIDs() []string {
+	var uuids []string
+	for _, reviewer := range container.C.Config.BitBucketConfig.RequiredReviewers {
+		uuids = append(uuids, reviewer.UUID)
+	}
+
+	return uuids
+}
+
+// withRequiredApprovers returns the approvers extended by the required ones without duplicates
+func withRequiredApprovers(approvers []string, required []string) []string {
+	var (
+		result = append([]string{}, approvers...)
+		known  = map[string]bool{}
+	)
+
+	for _, uuid := range approvers {
+		known[uuid] = true
+	}
+
+	for _, uuid := range required {
+		if uuid == "" || known[uuid] {
+			continue
+		}
+
+		known[uuid] = true
+		result = append(result, uuid)
+	}
+
+	return result
+}
+
+// repositoryKeys returns the keys, by which the repository can be defined in the configuration files, in priority order.
+// The repositories of other VCS providers are defined with their host only, so they are never mixed up with bitbucket.org repositories of the same name
+func repositoryKeys(host string, workspace string, repository string) []string {
+	if !IsBitBucketCloud(host) {
+		return []string{fmt.Sprintf("%s/%s/%s", strings.ToLower(host), workspace, repository)}
+	}
+
+	return []string{fmt.Sprintf("%s/%s/%s", bitBucketCloudHost, workspace, repository), fmt.Sprintf("%s/%s", workspace, repository), repository}
+}
+
+// CheckApprovalPolicy checks the pull-request approvals against the policy. The returned error explains which rule failed.
+// The author of the pull-request cannot approve it, so the author is not expected among the required approvers
+func CheckApprovalPolicy(policy bitbucketrelease_dto.ApprovalPolicy, pullRequest bitbucketrelease_dto.ProviderPullRequest) error {
+	approvedBy := map[string]bool{}
+	for _, user := range pullRequest.ApprovedBy {
+		if policy.ExcludeAuthor && user.ID == pullRequest.Author.ID {
+			continue
+		}
+
+		approvedBy[user.ID] = true
+	}
+
+	if len(approvedBy) < policy.MinApprovals {
+		return fmt.Errorf("The pull-request has %d approvals, but at least %d required.", len(approvedBy), policy.MinApprovals)
+	}
+
+	var missingApprovers []string
+	for _, uuid := range policy.RequiredApprovers {
+		if uuid == pullRequest.Author.ID {
+			continue
+		}
+
+		if !approvedBy[uuid] {
+			missingApprovers = append(missingApprovers, uuid)
+		}
+	}
+
+	if len(missingApprovers) > 0 {
+		return fmt.Errorf("The pull-request is not approved by required reviewers: %s.", strings.Join(missingApprovers, ", "))
+	}
+
+	for _, group := range policy.Groups {
+		var groupApprovals = 0
+		for _, uuid := range group.Members {
+			if approvedBy[uuid] {
+				groupApprovals++
+			}
+		}
+
+		if groupApprovals < group.MinApprovals {
+			return fmt.Errorf("The pull-request has %d approvals from group `%s`, but at least %d required.", groupApprovals, group.Name, group.MinApprovals)
+		}
+	}
+
+	return nil
+}
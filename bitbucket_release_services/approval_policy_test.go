@@ -0,0 +1,122 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func approvedPullRequest(author string, approvers ...string) bitbucketrelease_dto.ProviderPullRequest {
+	pullRequest := bitbucketrelease_dto.ProviderPullRequest{Author: bitbucketrelease_dto.ProviderUser{ID: author}}
+	for _, approver := range approvers {
+		pullRequest.ApprovedBy = append(pullRequest.ApprovedBy, bitbucketrelease_dto.ProviderUser{ID: approver})
+	}
+
+	return pullRequest
+}
+
+func TestCheckApprovalPolicy(t *testing.T) {
+	cases := []struct {
+		name        string
+		policy      bitbucketrelease_dto.ApprovalPolicy
+		pullRequest bitbucketrelease_dto.ProviderPullRequest
+		err         string
+	}{
+		{
+			name:        "empty policy",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{},
+			pullRequest: approvedPullRequest("{author}"),
+		},
+		{
+			name:        "enough approvals",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{MinApprovals: 2},
+			pullRequest: approvedPullRequest("{author}", "{first}", "{second}"),
+		},
+		{
+			name:        "not enough approvals",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{MinApprovals: 2},
+			pullRequest: approvedPullRequest("{author}", "{first}"),
+			err:         "has 1 approvals, but at least 2 required",
+		},
+		{
+			name:        "approval of the author is excluded",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{MinApprovals: 2, ExcludeAuthor: true},
+			pullRequest: approvedPullRequest("{author}", "{author}", "{first}"),
+			err:         "has 1 approvals, but at least 2 required",
+		},
+		{
+			name:        "required approver is missing",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{RequiredApprovers: []string{"{first}", "{second}"}},
+			pullRequest: approvedPullRequest("{author}", "{first}", "{third}"),
+			err:         "not approved by required reviewers: {second}",
+		},
+		{
+			name:        "required approver is the author",
+			policy:      bitbucketrelease_dto.ApprovalPolicy{RequiredApprovers: []string{"{author}", "{first}"}},
+			pullRequest: approvedPullRequest("{author}", "{first}"),
+		},
+		{
+			name: "group approvals",
+			policy: bitbucketrelease_dto.ApprovalPolicy{Groups: []bitbucketrelease_dto.ApprovalGroup{
+				{Name: "backend", Members: []string{"{first}", "{second}"}, MinApprovals: 1},
+			}},
+			pullRequest: approvedPullRequest("{author}", "{second}"),
+		},
+		{
+			name: "not enough group approvals",
+			policy: bitbucketrelease_dto.ApprovalPolicy{Groups: []bitbucketrelease_dto.ApprovalGroup{
+				{Name: "backend", Members: []string{"{first}", "{second}"}, MinApprovals: 2},
+			}},
+			pullRequest: approvedPullRequest("{author}", "{second}", "{third}"),
+			err:         "has 1 approvals from group `backend`, but at least 2 required",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := CheckApprovalPolicy(c.policy, c.pullRequest)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestApprovalPolicyForTakesCountFromConfiguration(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Default: bitbucketrelease_dto.RepositoryConfig{Reviewers: []string{"{reviewer}"}},
+		Repositories: map[string]bitbucketrelease_dto.RepositoryConfig{
+			"my-repository": {Approval: &bitbucketrelease_dto.ApprovalPolicy{MinApprovals: 3}},
+			"reviewed":      {Reviewers: []string{"{first}", "{second}"}, Approval: &bitbucketrelease_dto.ApprovalPolicy{RequiredApprovers: []string{"{second}", "{third}"}}},
+		},
+	}
+
+	if policy := ApprovalPolicyFor("", "my-workspace", "other-repository"); policy.MinApprovals != 0 || fmt.Sprint(policy.RequiredApprovers) != "[{reviewer}]" {
+		t.Errorf("expected the reviewers of the repository without approvals count, got %+v", policy)
+	}
+
+	if policy := ApprovalPolicyFor("", "my-workspace", "my-repository"); policy.MinApprovals != 3 || fmt.Sprint(policy.RequiredApprovers) != "[{reviewer}]" {
+		t.Errorf("expected the approvals count of the configuration with the reviewers of the repository, got %+v", policy)
+	}
+
+	if policy := ApprovalPolicyFor("", "my-workspace", "reviewed"); fmt.Sprint(policy.RequiredApprovers) != "[{second} {third} {first}]" {
+		t.Errorf("expected the required approvers merged with the reviewers of the repository, got %+v", policy)
+	}
+}
+
+func TestWithRequiredApprovers(t *testing.T) {
+	approvers := withRequiredApprovers([]string{"{first}"}, []string{"", "{first}", "{second}"})
+	if fmt.Sprint(approvers) != "[{first} {second}]" {
+		t.Errorf("expected the required approvers without duplicates, got %v", approvers)
+	}
+}
@@ -0,0 +1,277 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"github.com/sharovik/devbot/internal/container"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAutoMergeInterval = time.Minute
+	defaultAutoMergeTimeout  = 24 * time.Hour
+)
+
+var (
+	watchedPullRequests      = map[string]bitbucketrelease_dto.PullRequest{}
+	watchedPullRequestsMutex sync.Mutex
+)
+
+// WatchReleasePullRequest starts the watcher, which merges the release pull-request using merge strategy, once it satisfies the approval policy and the build is green.
+// The watcher is started only when the auto-merge is enabled in the configuration. The merged release pull-request is passed to the merged function, so it can be stored in the release history
+func WatchReleasePullRequest(message dto.BaseChatMessage, releaseID int64, pullRequest bitbucketrelease_dto.PullRequest, merged func(pullRequest bitbucketrelease_dto.ReleasePullRequest)) {
+	if !currentConfig().AutoMerge.Enabled || pullRequest.ID == 0 {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%d", pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
+
+	watchedPullRequestsMutex.Lock()
+	defer watchedPullRequestsMutex.Unlock()
+
+	if _, ok := watchedPullRequests[key]; ok {
+		return
+	}
+
+	watchedPullRequests[key] = pullRequest
+
+	go func() {
+		defer func() {
+			watchedPullRequestsMutex.Lock()
+			delete(watchedPullRequests, key)
+			watchedPullRequestsMutex.Unlock()
+		}()
+
+		watchReleasePullRequest(message, releaseID, pullRequest, merged)
+	}()
+}
+
+// WatchedReleasePullRequests returns the links to the release pull-requests, which are watched for the automatic merge at the moment
+func WatchedReleasePullRequests() []string {
+	watchedPullRequestsMutex.Lock()
+	defer watchedPullRequestsMutex.Unlock()
+
+	var links []string
+	for _, pullRequest := range watchedPullRequests {
+		links = append(links, pullRequest.URL())
+	}
+
+	sort.Strings(links)
+
+	return links
+}
+
+func watchReleasePullRequest(message dto.BaseChatMessage, releaseID int64, pullRequest bitbucketrelease_dto.PullRequest, merged func(pullRequest bitbucketrelease_dto.ReleasePullRequest)) {
+	var (
+		repository    = pullRequest.RepositorySlug
+		pullRequestID = pullRequest.ID
+		settings      = currentConfig().AutoMerge
+		interval      = durationOrDefault(settings.Interval, time.Second, defaultAutoMergeInterval)
+		deadline      = time.Now().Add(durationOrDefault(settings.Timeout, time.Hour, defaultAutoMergeTimeout))
+	)
+
+	log.Logger().Info().
+		Str("repository", repository).
+		Int64("pull_request_id", pullRequestID).
+		Msg("Started to watch the release pull-request")
+
+	for time.Now().Before(deadline) {
+		time.Sleep(interval)
+
+		done, err := tryMergeReleasePullRequest(message, releaseID, pullRequest, merged)
+		if err != nil {
+			log.Logger().AddError(err).
+				Str("repository", repository).
+				Int64("pull_request_id", pullRequestID).
+				Msg("Failed to check the release pull-request")
+		}
+
+		if done {
+			return
+		}
+	}
+
+	sendAutoMergeResult(message, fmt.Sprintf("I stopped to watch the release pull-request #%d of repository `%s`, because it was not approved in time. Please merge it manually.", pullRequestID, repository))
+}
+
+// autoMergeResult the result of one check of the watched release pull-request
+type autoMergeResult struct {
+	//Done true, when there is no need to watch the pull-request anymore
+	Done bool
+
+	//Text the message for the channel. It is empty, when there is nothing to tell
+	Text string
+
+	//MergeCommit the merge commit of the release pull-request, which should be tagged. It is empty, when the pull-request is not merged
+	MergeCommit string
+}
+
+// tryMergeReleasePullRequest merges the release pull-request when it is ready. Returns true, when there is no need to watch this pull-request anymore
+func tryMergeReleasePullRequest(message dto.BaseChatMessage, releaseID int64, pullRequest bitbucketrelease_dto.PullRequest, merged func(pullRequest bitbucketrelease_dto.ReleasePullRequest)) (bool, error) {
+	var (
+		host          = pullRequest.Host
+		workspace     = pullRequest.Workspace
+		repository    = pullRequest.RepositorySlug
+		pullRequestID = pullRequest.ID
+	)
+
+	info, err := ProviderFor(host).PullRequest(context.Background(), workspace, repository, pullRequestID)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := checkReleasePullRequest(context.Background(), host, workspace, repository, info, func() (bitbucketrelease_dto.ProviderPullRequest, error) {
+		return ProviderFor(host).MergePullRequest(context.Background(), workspace, repository, pullRequestID, info.Description, client.StrategyMerge)
+	})
+
+	if result.Text != "" {
+		sendAutoMergeResult(message, result.Text)
+	}
+
+	if result.MergeCommit != "" {
+		merged(mergedReleasePullRequest(releaseID, pullRequest, info, result.MergeCommit))
+		tagMergedPullRequests(message, []bitbucketrelease_dto.PullRequest{releasePullRequestOf(host, workspace, repository, info)}, func(bitbucketrelease_dto.PullRequest) string {
+			return result.MergeCommit
+		})
+	}
+
+	return result.Done, err
+}
+
+// checkReleasePullRequest merges the release pull-request by the merge function, when it is ready. The release pull-request, which was merged manually, is tagged as well
+func checkReleasePullRequest(ctx context.Context, host string, workspace string, repository string, info bitbucketrelease_dto.ProviderPullRequest, merge func() (bitbucketrelease_dto.ProviderPullRequest, error)) (autoMergeResult, error) {
+	switch info.State {
+	case bitbucketrelease_dto.ProviderPullRequestStateOpen:
+	case bitbucketrelease_dto.ProviderPullRequestStateMerged:
+		return autoMergeResult{
+			Done:        true,
+			Text:        fmt.Sprintf("The release pull-request %s was merged into `%s`, so I stopped to watch it.", info.Link, info.DestinationBranch),
+			MergeCommit: info.MergeCommit,
+		}, nil
+	default:
+		return autoMergeResult{
+			Done: true,
+			Text: fmt.Sprintf("The release pull-request %s is %s, so I stopped to watch it.", info.Link, info.State),
+		}, nil
+	}
+
+	if err := CheckApprovalPolicy(autoMergeApprovalPolicy(host, workspace, repository), info); err != nil {
+		log.Logger().Debug().Err(err).Int64("pull_request_id", info.ID).Msg("The release pull-request is not approved yet")
+		return autoMergeResult{}, nil
+	}
+
+	if err := CheckBuildStatuses(ctx, BuildStatusPolicyFor(host, workspace, repository), host, workspace, repository, info); err != nil {
+		log.Logger().Debug().Err(err).Int64("pull_request_id", info.ID).Msg("The build of the release pull-request is not green yet")
+		return autoMergeResult{}, nil
+	}
+
+	response, err := merge()
+	if err != nil {
+		return autoMergeResult{
+			Done: true,
+			Text: fmt.Sprintf("The release pull-request %s is approved, but I cannot merge it. Reason: `%s`", info.Link, err),
+		}, err
+	}
+
+	return autoMergeResult{
+		Done:        true,
+		Text:        fmt.Sprintf("The release pull-request %s was approved and I merged it into `%s`.", info.Link, info.DestinationBranch),
+		MergeCommit: response.MergeCommit,
+	}, nil
+}
+
+// autoMergeApprovalPolicy returns the approval policy of the repository, which requires at least one approval of the user, who is not the author of the release pull-request
+func autoMergeApprovalPolicy(host string, workspace string, repository string) bitbucketrelease_dto.ApprovalPolicy {
+	policy := ApprovalPolicyFor(host, workspace, repository)
+	policy.ExcludeAuthor = true
+	if policy.MinApprovals < 1 {
+		policy.MinApprovals = 1
+	}
+
+	return policy
+}
+
+// sendAutoMergeResult sends the result of the auto-merge to the user in the channel, where the release was triggered, and to the release channel
+func sendAutoMergeResult(message dto.BaseChatMessage, text string) {
+	SendMessageToTheChannel(message.Channel, fmt.Sprintf("<@%s> %s", message.OriginalMessage.User, text))
+
+	releaseChannel := container.C.Config.BitBucketConfig.ReleaseChannel
+	if container.C.Config.BitBucketConfig.ReleaseChannelMessageEnabled && releaseChannel != "" && releaseChannel != message.Channel {
+		SendMessageToTheChannel(releaseChannel, text)
+	}
+}
+
+// releasePullRequestOf returns the watched release pull-request with its information from the provider
+func releasePullRequestOf(host string, workspace string, repository string, info bitbucketrelease_dto.ProviderPullRequest) bitbucketrelease_dto.PullRequest {
+	providerHost, _ := ProviderHostFor(host)
+
+	return bitbucketrelease_dto.PullRequest{
+		Host:              host,
+		Provider:          providerHost.Type,
+		ID:                info.ID,
+		Workspace:         workspace,
+		RepositorySlug:    repository,
+		BranchName:        info.SourceBranch,
+		DestinationBranch: info.DestinationBranch,
+		Title:             info.Title,
+		Description:       info.Description,
+	}
+}
+
+// MergedReleasePullRequest returns the result of the release pull-request, which was merged without the auto-merge, from VCS provider. The error is returned, when it is not merged
+func MergedReleasePullRequest(releaseID int64, pullRequest bitbucketrelease_dto.PullRequest) (bitbucketrelease_dto.ReleasePullRequest, error) {
+	info, err := ProviderFor(pullRequest.Host).PullRequest(context.Background(), pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
+	if err != nil {
+		return bitbucketrelease_dto.ReleasePullRequest{}, errors.Wrap(err, "Failed to get the release pull-request")
+	}
+
+	if info.State != bitbucketrelease_dto.ProviderPullRequestStateMerged || info.MergeCommit == "" {
+		return bitbucketrelease_dto.ReleasePullRequest{}, fmt.Errorf("The release pull-request %s of the release branch `%s` is not merged, so the pull-request is not in `%s`. Please decline the release pull-request instead.", pullRequest.URL(), info.SourceBranch, info.DestinationBranch)
+	}
+
+	return mergedReleasePullRequest(releaseID, pullRequest, info, info.MergeCommit), nil
+}
+
+// mergedReleasePullRequest returns the result of the merged release pull-request for the release history. Its merge commit brought all pull-requests of the release branch into the destination branch
+func mergedReleasePullRequest(releaseID int64, pullRequest bitbucketrelease_dto.PullRequest, info bitbucketrelease_dto.ProviderPullRequest, mergeCommit string) bitbucketrelease_dto.ReleasePullRequest {
+	link := info.Link
+	if link == "" {
+		link = pullRequest.URL()
+	}
+
+	releaseBranch := info.SourceBranch
+	if releaseBranch == "" {
+		releaseBranch = pullRequest.BranchName
+	}
+
+	return bitbucketrelease_dto.ReleasePullRequest{
+		ReleaseID:              releaseID,
+		Host:                   pullRequest.Host,
+		Workspace:              pullRequest.Workspace,
+		RepositorySlug:         pullRequest.RepositorySlug,
+		PullRequestID:          pullRequest.ID,
+		Title:                  info.Title,
+		URL:                    link,
+		Status:                 bitbucketrelease_dto.PullRequestStatusMerged,
+		DestinationBranch:      info.DestinationBranch,
+		MergeCommit:            mergeCommit,
+		ReleaseBranch:          releaseBranch,
+		ReleasePullRequestLink: link,
+	}
+}
+
+// durationOrDefault returns the configured number of units or the default duration, when the value is not configured
+func durationOrDefault(value int64, unit time.Duration, defaultValue time.Duration) time.Duration {
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return time.Duration(value) * unit
+}
@@ -0,0 +1,143 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckReleasePullRequestTagsMergedPullRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		state       string
+		mergeCommit string
+	}{
+		{name: "merged manually", state: bitbucketrelease_dto.ProviderPullRequestStateMerged, mergeCommit: "abc"},
+		{name: "declined", state: bitbucketrelease_dto.ProviderPullRequestStateDeclined},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			info := bitbucketrelease_dto.ProviderPullRequest{ID: 1, State: c.state, MergeCommit: "abc", DestinationBranch: "master"}
+			result, err := checkReleasePullRequest(context.Background(), "", "my-workspace", "my-repository", info, func() (bitbucketrelease_dto.ProviderPullRequest, error) {
+				t.Error("expected the closed pull-request not to be merged")
+				return bitbucketrelease_dto.ProviderPullRequest{}, nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if !result.Done || result.MergeCommit != c.mergeCommit {
+				t.Errorf("expected to stop the watch with merge commit %q, got %+v", c.mergeCommit, result)
+			}
+		})
+	}
+}
+
+func TestCheckReleasePullRequestRequiresApprovalOfOtherUser(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Default: bitbucketrelease_dto.RepositoryConfig{BuildStatuses: &bitbucketrelease_dto.BuildStatusPolicy{Disabled: true}},
+	}
+
+	cases := []struct {
+		name   string
+		info   bitbucketrelease_dto.ProviderPullRequest
+		merged bool
+	}{
+		{name: "no approvals", info: approvedPullRequest("{bot}")},
+		{name: "approved by the author", info: approvedPullRequest("{bot}", "{bot}")},
+		{name: "approved by other user", info: approvedPullRequest("{bot}", "{reviewer}"), merged: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.info.State = bitbucketrelease_dto.ProviderPullRequestStateOpen
+
+			merged := false
+			result, err := checkReleasePullRequest(context.Background(), "", "my-workspace", "my-repository", c.info, func() (bitbucketrelease_dto.ProviderPullRequest, error) {
+				merged = true
+				return bitbucketrelease_dto.ProviderPullRequest{MergeCommit: "abc"}, nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if merged != c.merged || result.Done != c.merged {
+				t.Errorf("expected merged %v, got %v with %+v", c.merged, merged, result)
+			}
+		})
+	}
+}
+
+func TestWatchReleasePullRequestIsDisabledByDefault(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{}
+
+	WatchReleasePullRequest(dto.BaseChatMessage{}, 1, bitbucketrelease_dto.PullRequest{ID: 1, Workspace: "my-workspace", RepositorySlug: "my-repository"}, func(bitbucketrelease_dto.ReleasePullRequest) {
+		t.Error("expected the release pull-request not to be watched")
+	})
+	if links := WatchedReleasePullRequests(); len(links) != 0 {
+		t.Errorf("expected no watched release pull-requests, got %v", links)
+	}
+}
+
+func TestMergedReleasePullRequest(t *testing.T) {
+	cases := []struct {
+		name     string
+		response string
+		err      string
+	}{
+		{name: "merged", response: `{"number": 2, "title": "Release", "state": "closed", "merged": true, "merge_commit_sha": "abc", "html_url": "https://github.com/my-owner/api/pull/2", "head": {"ref": "release/1"}, "base": {"ref": "main"}}`},
+		{name: "open", response: `{"number": 2, "state": "open", "html_url": "https://github.com/my-owner/api/pull/2", "head": {"ref": "release/1"}, "base": {"ref": "main"}}`, err: "is not merged"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, "/reviews") {
+					_, _ = w.Write([]byte(`[]`))
+					return
+				}
+
+				_, _ = w.Write([]byte(c.response))
+			}))
+			defer server.Close()
+
+			previous := releaseConfig
+			t.Cleanup(func() {
+				releaseConfig = previous
+			})
+
+			releaseConfig = &bitbucketrelease_dto.Config{Servers: []bitbucketrelease_dto.ProviderHost{{Host: "github.com", Type: bitbucketrelease_dto.ProviderGitHub, URL: server.URL}}}
+
+			item, err := MergedReleasePullRequest(12, bitbucketrelease_dto.PullRequest{Host: "github.com", Provider: bitbucketrelease_dto.ProviderGitHub, ID: 2, Workspace: "my-owner", RepositorySlug: "api"})
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("expected the error with %q, got %v", c.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if item.ReleaseID != 12 || item.Host != "github.com" || item.PullRequestID != 2 || item.MergeCommit != "abc" || item.DestinationBranch != "main" || item.ReleaseBranch != "release/1" || item.Status != bitbucketrelease_dto.PullRequestStatusMerged || !item.IsReleasePullRequest() {
+				t.Errorf("expected the merged release pull-request of the release, got %+v", item)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/url"
+)
+
+// bitBucketProvider the bitbucket.org provider. It uses the own BitBucket API client, so all requests are retried by one transport
+type bitBucketProvider struct{}
+
+// PullRequest returns the pull-request with its approvals
+func (p bitBucketProvider) PullRequest(ctx context.Context, workspace string, repository string, pullRequestID int64) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var info bitbucketrelease_dto.BitBucketPullRequest
+	if err := api.request(ctx, "GET", pullRequestEndpoint(workspace, repository, pullRequestID), nil, &info); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, fmt.Sprintf("Failed to get the pull-request #%d", pullRequestID))
+	}
+
+	return bitBucketPullRequest(info), nil
+}
+
+// MergePullRequest merges the pull-request. When BitBucket merges it in the background, the pull-request is received again
+func (p bitBucketProvider) MergePullRequest(ctx context.Context, workspace string, repository string, pullRequestID int64, message string, strategy string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var info bitbucketrelease_dto.BitBucketPullRequest
+	err := api.request(ctx, "POST", pullRequestEndpoint(workspace, repository, pullRequestID)+"/merge", map[string]string{
+		"message":        message,
+		"merge_strategy": strategy,
+	}, &info)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	if info.ID == 0 {
+		return p.PullRequest(ctx, workspace, repository, pullRequestID)
+	}
+
+	return bitBucketPullRequest(info), nil
+}
+
+// ChangePullRequestDestination changes the destination branch and the title of the pull-request
+func (p bitBucketProvider) ChangePullRequestDestination(ctx context.Context, workspace string, repository string, pullRequestID int64, title string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var info bitbucketrelease_dto.BitBucketPullRequest
+	err := api.request(ctx, "PUT", pullRequestEndpoint(workspace, repository, pullRequestID), map[string]interface{}{
+		"title":       title,
+		"destination": bitbucketrelease_dto.BitBucketRef{Branch: bitbucketrelease_dto.BitBucketBranchName{Name: branchName}},
+	}, &info)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return bitBucketPullRequest(info), nil
+}
+
+// CreateBranch creates the branch from the selected branch or from the main branch of the repository
+func (p bitBucketProvider) CreateBranch(ctx context.Context, workspace string, repository string, branchName string, fromBranch string) (bitbucketrelease_dto.ProviderBranch, error) {
+	if fromBranch == "" {
+		mainBranch, err := p.MainBranch(ctx, workspace, repository)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderBranch{}, err
+		}
+
+		fromBranch = mainBranch
+	}
+
+	source, err := getBranch(ctx, workspace, repository, fromBranch)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, errors.Wrap(err, fmt.Sprintf("Failed to get the branch %s", fromBranch))
+	}
+
+	var created bitbucketrelease_dto.Branch
+	err = api.request(ctx, "POST", fmt.Sprintf("/repositories/%s/%s/refs/branches", workspace, repository), map[string]interface{}{
+		"name":   branchName,
+		"target": map[string]string{"hash": source.Target.Hash},
+	}, &created)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, err
+	}
+
+	return bitbucketrelease_dto.ProviderBranch{Name: created.Name, Hash: created.Target.Hash}, nil
+}
+
+// CreatePullRequest opens the pull-request. When the destination is not defined, BitBucket uses the main branch
+func (p bitBucketProvider) CreatePullRequest(ctx context.Context, workspace string, repository string, request bitbucketrelease_dto.ProviderPullRequestCreate) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	bitBucketRequest := bitbucketrelease_dto.BitBucketPullRequestCreate{
+		Title:             request.Title,
+		Description:       request.Description,
+		Source:            bitbucketrelease_dto.BitBucketRef{Branch: bitbucketrelease_dto.BitBucketBranchName{Name: request.SourceBranch}},
+		CloseSourceBranch: request.CloseSourceBranch,
+	}
+
+	if request.DestinationBranch != "" {
+		bitBucketRequest.Destination = &bitbucketrelease_dto.BitBucketRef{Branch: bitbucketrelease_dto.BitBucketBranchName{Name: request.DestinationBranch}}
+	}
+
+	for _, reviewer := range request.Reviewers {
+		bitBucketRequest.Reviewers = append(bitBucketRequest.Reviewers, bitbucketrelease_dto.BitBucketReviewer{UUID: reviewer})
+	}
+
+	var info bitbucketrelease_dto.BitBucketPullRequest
+	if err := api.request(ctx, "POST", fmt.Sprintf("/repositories/%s/%s/pullrequests", workspace, repository), bitBucketRequest, &info); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return bitBucketPullRequest(info), nil
+}
+
+// BranchExists returns true when the repository has the branch
+func (p bitBucketProvider) BranchExists(ctx context.Context, workspace string, repository string, branchName string) (bool, error) {
+	_, err := getBranch(ctx, workspace, repository, branchName)
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// MainBranch returns the main branch of the repository
+func (p bitBucketProvider) MainBranch(ctx context.Context, workspace string, repository string) (string, error) {
+	var response bitbucketrelease_dto.RepositoryResponse
+	if err := api.request(ctx, "GET", fmt.Sprintf("/repositories/%s/%s", workspace, repository), nil, &response); err != nil {
+		return "", errors.Wrap(err, "Failed to get the main branch of the repository")
+	}
+
+	return response.MainBranch.Name, nil
+}
+
+// DeleteBranch deletes the branch of the repository
+func (p bitBucketProvider) DeleteBranch(ctx context.Context, workspace string, repository string, branchName string) error {
+	return api.request(ctx, "DELETE", fmt.Sprintf("/repositories/%s/%s/refs/branches/%s", workspace, repository, url.PathEscape(branchName)), nil, nil)
+}
+
+// OpenPullRequest returns the open pull-request from the selected branch
+func (p bitBucketProvider) OpenPullRequest(ctx context.Context, workspace string, repository string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	q := url.QueryEscape(fmt.Sprintf(`source.branch.name="%s" AND state="%s"`, branchName, bitbucketrelease_dto.ProviderPullRequestStateOpen))
+
+	var response pullRequestsResponse
+	if err := api.request(ctx, "GET", fmt.Sprintf("/repositories/%s/%s/pullrequests?q=%s", workspace, repository, q), nil, &response); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, fmt.Sprintf("Failed to find the pull-requests of the branch %s", branchName))
+	}
+
+	if len(response.Values) == 0 {
+		return bitbucketrelease_dto.ProviderPullRequest{}, nil
+	}
+
+	return bitbucketrelease_dto.ProviderPullRequest{
+		ID:    response.Values[0].ID,
+		State: bitbucketrelease_dto.ProviderPullRequestStateOpen,
+		Link:  response.Values[0].Links.HTML.Href,
+	}, nil
+}
+
+// OpenPullRequests returns the open pull-requests of the repository
+func (p bitBucketProvider) OpenPullRequests(ctx context.Context, workspace string, repository string, destinationBranch string) ([]bitbucketrelease_dto.ProviderPullRequest, error) {
+	q := fmt.Sprintf(`state="%s"`, bitbucketrelease_dto.ProviderPullRequestStateOpen)
+	if destinationBranch != "" {
+		q += fmt.Sprintf(` AND destination.branch.name="%s"`, destinationBranch)
+	}
+
+	var (
+		pullRequests []bitbucketrelease_dto.ProviderPullRequest
+		endpoint     = fmt.Sprintf("/repositories/%s/%s/pullrequests?pagelen=50&q=%s", workspace, repository, url.QueryEscape(q))
+	)
+
+	for endpoint != "" {
+		var response pullRequestsResponse
+		if err := api.request(ctx, "GET", endpoint, nil, &response); err != nil {
+			return nil, errors.Wrap(err, "Failed to get the open pull-requests")
+		}
+
+		for _, item := range response.Values {
+			pullRequests = append(pullRequests, bitbucketrelease_dto.ProviderPullRequest{
+				ID:    item.ID,
+				State: bitbucketrelease_dto.ProviderPullRequestStateOpen,
+				Link:  item.Links.HTML.Href,
+			})
+		}
+
+		endpoint = response.Next
+	}
+
+	return pullRequests, nil
+}
+
+// BuildStatuses returns all build statuses of the selected commit
+func (p bitBucketProvider) BuildStatuses(ctx context.Context, workspace string, repository string, commitHash string) ([]bitbucketrelease_dto.BuildStatus, error) {
+	var (
+		statuses []bitbucketrelease_dto.BuildStatus
+		endpoint = fmt.Sprintf("/repositories/%s/%s/commit/%s/statuses?pagelen=100", workspace, repository, commitHash)
+	)
+
+	for endpoint != "" {
+		var response bitbucketrelease_dto.BuildStatusesResponse
+		if err := api.request(ctx, "GET", endpoint, nil, &response); err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, response.Values...)
+		endpoint = response.Next
+	}
+
+	return statuses, nil
+}
+
+func pullRequestEndpoint(workspace string, repository string, pullRequestID int64) string {
+	return fmt.Sprintf("/repositories/%s/%s/pullrequests/%d", workspace, repository, pullRequestID)
+}
+
+// bitBucketPullRequest converts the pull-request of bitbucket.org
+func bitBucketPullRequest(info bitbucketrelease_dto.BitBucketPullRequest) bitbucketrelease_dto.ProviderPullRequest {
+	pullRequest := bitbucketrelease_dto.ProviderPullRequest{
+		ID:                info.ID,
+		Title:             info.Title,
+		Description:       info.Description,
+		State:             info.State,
+		Author:            bitbucketrelease_dto.ProviderUser{ID: info.Author.UUID, Name: info.Author.DisplayName},
+		SourceBranch:      info.Source.Branch.Name,
+		DestinationBranch: info.Destination.Branch.Name,
+		Link:              info.Links.HTML.Href,
+	}
+
+	if info.Source.Repository != nil {
+		pullRequest.RepositorySlug = info.Source.Repository.Name
+	}
+
+	if info.Source.Commit != nil {
+		pullRequest.SourceCommit = info.Source.Commit.Hash
+	}
+
+	if info.MergeCommit != nil {
+		pullRequest.MergeCommit = info.MergeCommit.Hash
+	}
+
+	for _, participant := range info.Participants {
+		if participant.Approved {
+			pullRequest.ApprovedBy = append(pullRequest.ApprovedBy, bitbucketrelease_dto.ProviderUser{ID: participant.User.UUID, Name: participant.User.DisplayName})
+		}
+	}
+
+	return pullRequest
+}
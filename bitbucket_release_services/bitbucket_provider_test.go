@@ -0,0 +1,41 @@
+package bitbucket_release_services
+
+import (
+	"encoding/json"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"testing"
+)
+
+func TestBitBucketPullRequest(t *testing.T) {
+	cases := []struct {
+		name        string
+		response    string
+		mergeCommit string
+		approvedBy  int
+	}{
+		{
+			name:       "open pull-request",
+			response:   `{"id": 1, "state": "OPEN", "merge_commit": null, "source": {"branch": {"name": "feature"}, "commit": {"hash": "abc"}, "repository": {"name": "api"}}, "destination": {"branch": {"name": "master"}}, "participants": [{"user": {"uuid": "{reviewer}"}, "approved": true}, {"user": {"uuid": "{other}"}, "approved": false}]}`,
+			approvedBy: 1,
+		},
+		{
+			name:        "merged pull-request",
+			response:    `{"id": 1, "state": "MERGED", "merge_commit": {"hash": "def"}, "source": {"branch": {"name": "feature"}}, "destination": {"branch": {"name": "master"}}}`,
+			mergeCommit: "def",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var info bitbucketrelease_dto.BitBucketPullRequest
+			if err := json.Unmarshal([]byte(c.response), &info); err != nil {
+				t.Fatal(err)
+			}
+
+			pullRequest := bitBucketPullRequest(info)
+			if pullRequest.MergeCommit != c.mergeCommit || len(pullRequest.ApprovedBy) != c.approvedBy || pullRequest.DestinationBranch != "master" || pullRequest.SourceBranch != "feature" {
+				t.Errorf("expected merge commit %q and %d approvals, got %+v", c.mergeCommit, c.approvedBy, pullRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+)
+
+const (
+	buildStateSuccessful = "SUCCESSFUL"
+	buildStateInProgress = "INPROGRESS"
+	buildStateFailed     = "FAILED"
+)
+
+// BuildStatusPolicyFor returns the build status policy of the selected repository of the host
+func BuildStatusPolicyFor(host string, workspace string, repository string) bitbucketrelease_dto.BuildStatusPolicy {
+	if policy := RepositoryConfigFor(host, workspace, repository).BuildStatuses; policy != nil {
+		return *policy
+	}
+
+	return bitbucketrelease_dto.BuildStatusPolicy{}
+}
+
+// CheckBuildStatuses checks the build statuses of the pull-request source commit against the policy. The returned error explains which build failed.
+// The repository of the pull-request link is used, because the source repository of the pull-request can be a fork
+func CheckBuildStatuses(ctx context.Context, policy bitbucketrelease_dto.BuildStatusPolicy, host string, workspace string, repository string, pullRequest bitbucketrelease_dto.ProviderPullRequest) error {
+	if policy.Disabled {
+		return nil
+	}
+
+	if pullRequest.SourceCommit == "" {
+		return errors.New("The source commit of the pull-request is unknown, so the build status cannot be checked.")
+	}
+
+	statuses, err := ProviderFor(host).BuildStatuses(ctx, workspace, repository, pullRequest.SourceCommit)
+	if err != nil {
+		return errors.Wrap(err, "Failed to get the build statuses")
+	}
+
+	return checkBuildStatuses(policy, statuses)
+}
+
+func checkBuildStatuses(policy bitbucketrelease_dto.BuildStatusPolicy, statuses []bitbucketrelease_dto.BuildStatus) error {
+	var (
+		foundKeys = map[string]bool{}
+		failed    []string
+	)
+
+	for _, status := range statuses {
+		foundKeys[status.Key] = true
+
+		switch status.State {
+		case buildStateSuccessful:
+			continue
+		case buildStateInProgress:
+			failed = append(failed, fmt.Sprintf("build `%s` is still in progress %s", status.Key, status.URL))
+		default:
+			failed = append(failed, fmt.Sprintf("build `%s` is %s %s", status.Key, status.State, status.URL))
+		}
+	}
+
+	for _, key := range policy.RequiredKeys {
+		if !foundKeys[key] {
+			failed = append(failed, fmt.Sprintf("required build `%s` is missing", key))
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("The build is not green: %s.", strings.Join(failed, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckBuildStatuses(t *testing.T) {
+	cases := []struct {
+		name     string
+		policy   bitbucketrelease_dto.BuildStatusPolicy
+		statuses []bitbucketrelease_dto.BuildStatus
+		err      string
+	}{
+		{
+			name:     "all builds are green",
+			statuses: []bitbucketrelease_dto.BuildStatus{{Key: "unit", State: buildStateSuccessful}},
+		},
+		{
+			name:     "build is in progress",
+			statuses: []bitbucketrelease_dto.BuildStatus{{Key: "unit", State: buildStateInProgress}},
+			err:      "build `unit` is still in progress",
+		},
+		{
+			name:     "build is failed",
+			statuses: []bitbucketrelease_dto.BuildStatus{{Key: "unit", State: buildStateFailed}},
+			err:      "build `unit` is FAILED",
+		},
+		{
+			name:     "required build is missing",
+			policy:   bitbucketrelease_dto.BuildStatusPolicy{RequiredKeys: []string{"e2e"}},
+			statuses: []bitbucketrelease_dto.BuildStatus{{Key: "unit", State: buildStateSuccessful}},
+			err:      "required build `e2e` is missing",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkBuildStatuses(c.policy, c.statuses)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestGitHubBuildStatusesReadsAllPages(t *testing.T) {
+	const total = gitHubPageSize + 1
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		count := gitHubPageSize
+		if page == 2 {
+			count = total - gitHubPageSize
+		}
+
+		if page > 2 {
+			count = 0
+		}
+
+		var items []map[string]string
+		for i := 0; i < count; i++ {
+			items = append(items, map[string]string{
+				"context":    fmt.Sprintf("status-%d-%d", page, i),
+				"state":      "success",
+				"name":       fmt.Sprintf("check-%d-%d", page, i),
+				"status":     gitHubCheckCompleted,
+				"conclusion": "success",
+			})
+		}
+
+		key := "statuses"
+		if strings.HasSuffix(r.URL.Path, "/check-runs") {
+			key = "check_runs"
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"total_count": total, key: items})
+	}))
+	defer server.Close()
+
+	statuses, err := newGitHubProvider(bitbucketrelease_dto.ProviderHost{URL: server.URL}).BuildStatuses(context.Background(), "my-owner", "my-repository", "abc")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if len(statuses) != 2*total {
+		t.Errorf("expected %d statuses and check runs from all pages, got %d", 2*total, len(statuses))
+	}
+}
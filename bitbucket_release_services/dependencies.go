@@ -0,0 +1,248 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// dependsOnRegex the `Depends on {pull-request-link}` line of the pull-request description
+var dependsOnRegex = regexp.MustCompile(`(?i)depends\s+on:?\s*<?(https?://[^\s|>]+)`)
+
+// DefaultRepositoryOrder returns the repositories order of the release configuration
+func DefaultRepositoryOrder() []string {
+	return currentConfig().RepositoryOrder
+}
+
+// ParseRepositoryOrder parses the list of repositories separated by comma or `>`, e.g. `shared-lib,api,web`
+func ParseRepositoryOrder(value string) []string {
+	var order []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '>'
+	}) {
+		if item = strings.TrimSpace(item); item != "" {
+			order = append(order, item)
+		}
+	}
+
+	return order
+}
+
+// PullRequestDependencies returns the pull-requests defined by `Depends on {pull-request-link}` in the description
+func PullRequestDependencies(description string) []bitbucketrelease_dto.PullRequest {
+	var dependencies []bitbucketrelease_dto.PullRequest
+	for _, matches := range dependsOnRegex.FindAllStringSubmatch(description, -1) {
+		dependency, err := ParsePullRequestLink(matches[1])
+		if err != nil {
+			continue
+		}
+
+		dependencies = append(dependencies, dependency)
+	}
+
+	return dependencies
+}
+
+// OrderMergePlan sorts the repositories of the plan by the repositories order and by the dependencies between pull-requests. Inside of the repository the pull-requests are sorted by their dependencies.
+// When there is no dependency between items, they keep the received order
+func OrderMergePlan(plan bitbucketrelease_dto.MergePlan, repositoryOrder []string) (bitbucketrelease_dto.MergePlan, error) {
+	var (
+		repositories = plan.Repositories
+		edges        = map[int][]int{}
+	)
+
+	//The order of repositories means that each repository depends on the previous one
+	var previous = -1
+	for _, name := range repositoryOrder {
+		index := repositoryIndex(repositories, name)
+		if index == -1 {
+			continue
+		}
+
+		if previous != -1 {
+			edges[previous] = append(edges[previous], index)
+		}
+
+		previous = index
+	}
+
+	for i := range repositories {
+		for _, pullRequest := range repositories[i].PullRequests {
+			for _, dependency := range pullRequest.DependsOn {
+				index := dependencyIndex(repositories, dependency)
+				if index == -1 || index == i {
+					continue
+				}
+
+				edges[index] = append(edges[index], i)
+			}
+		}
+	}
+
+	order, err := stableTopologicalOrder(len(repositories), edges)
+	if err != nil {
+		return plan, fmt.Errorf("The repositories have circular dependency: %s", cycleText(err.(cycleError), func(i int) string {
+			return repositories[i].RepositorySlug
+		}))
+	}
+
+	var result bitbucketrelease_dto.MergePlan
+	for _, index := range order {
+		repositoryPlan := repositories[index]
+		repositoryPlan.DependsOn = nil
+		for prerequisite, dependents := range edges {
+			if containsIndex(dependents, index) && !containsKey(repositoryPlan.DependsOn, repositories[prerequisite].Key()) {
+				repositoryPlan.DependsOn = append(repositoryPlan.DependsOn, repositories[prerequisite].Key())
+			}
+		}
+
+		//The edges are kept in the map, so the prerequisites are sorted to get the same plan for the same message
+		sort.Slice(repositoryPlan.DependsOn, func(i, j int) bool {
+			return repositoryPlan.DependsOn[i].Less(repositoryPlan.DependsOn[j])
+		})
+
+		if repositoryPlan.PullRequests, err = orderPullRequests(repositoryPlan.PullRequests); err != nil {
+			return plan, err
+		}
+
+		result.Repositories = append(result.Repositories, repositoryPlan)
+	}
+
+	return result, nil
+}
+
+func orderPullRequests(pullRequests []bitbucketrelease_dto.PullRequest) ([]bitbucketrelease_dto.PullRequest, error) {
+	var edges = map[int][]int{}
+	for i, pullRequest := range pullRequests {
+		for _, dependency := range pullRequest.DependsOn {
+			for j, item := range pullRequests {
+				if i != j && item.Is(dependency) {
+					edges[j] = append(edges[j], i)
+				}
+			}
+		}
+	}
+
+	order, err := stableTopologicalOrder(len(pullRequests), edges)
+	if err != nil {
+		return nil, fmt.Errorf("The pull-requests have circular dependency: %s", cycleText(err.(cycleError), func(i int) string {
+			return fmt.Sprintf("#%d", pullRequests[i].ID)
+		}))
+	}
+
+	var result []bitbucketrelease_dto.PullRequest
+	for _, index := range order {
+		result = append(result, pullRequests[index])
+	}
+
+	return result, nil
+}
+
+// cycleError the error, which contains the items of the circular dependency
+type cycleError struct {
+	Items []int
+}
+
+func (e cycleError) Error() string {
+	return "circular dependency"
+}
+
+func cycleText(err cycleError, name func(int) string) string {
+	var names []string
+	for _, item := range err.Items {
+		names = append(names, name(item))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// stableTopologicalOrder returns the order of items, where each item goes after its prerequisites. The edges are defined as prerequisite => dependents.
+// From all items, which are ready, the item with the lowest index is always taken first, so the items without dependencies keep their order
+func stableTopologicalOrder(length int, edges map[int][]int) ([]int, error) {
+	var (
+		inDegree = make([]int, length)
+		done     = make([]bool, length)
+		order    []int
+	)
+
+	for _, dependents := range edges {
+		for _, dependent := range dependents {
+			inDegree[dependent]++
+		}
+	}
+
+	for len(order) < length {
+		next := -1
+		for i := 0; i < length; i++ {
+			if !done[i] && inDegree[i] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+			var cycle []int
+			for i := 0; i < length; i++ {
+				if !done[i] {
+					cycle = append(cycle, i)
+				}
+			}
+
+			return nil, cycleError{Items: cycle}
+		}
+
+		done[next] = true
+		order = append(order, next)
+		for _, dependent := range edges[next] {
+			inDegree[dependent]--
+		}
+	}
+
+	return order, nil
+}
+
+// repositoryIndex returns the index of the repository, which is defined as `{workspace}/{repository}` or `{repository}`
+func repositoryIndex(repositories []bitbucketrelease_dto.RepositoryMergePlan, name string) int {
+	for i, repository := range repositories {
+		for _, key := range repositoryKeys(repository.Host, repository.Workspace, repository.RepositorySlug) {
+			if strings.EqualFold(key, name) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// dependencyIndex returns the index of the repository of the pull-request dependency
+func dependencyIndex(repositories []bitbucketrelease_dto.RepositoryMergePlan, dependency bitbucketrelease_dto.PullRequest) int {
+	for i, repository := range repositories {
+		if repository.Is(dependency.Host, dependency.Workspace, dependency.RepositorySlug) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func containsIndex(items []int, item int) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsKey(items []bitbucketrelease_dto.RepositoryKey, item bitbucketrelease_dto.RepositoryKey) bool {
+	for _, value := range items {
+		if value == item {
+			return true
+		}
+	}
+
+	return false
+}
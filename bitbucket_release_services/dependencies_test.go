@@ -0,0 +1,182 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func pullRequestOf(host string, workspace string, repository string, id int64, dependsOn ...bitbucketrelease_dto.PullRequest) bitbucketrelease_dto.PullRequest {
+	return bitbucketrelease_dto.PullRequest{Host: host, Workspace: workspace, RepositorySlug: repository, ID: id, DependsOn: dependsOn}
+}
+
+func repositoriesOf(plan bitbucketrelease_dto.MergePlan) string {
+	var names []string
+	for _, repository := range plan.Repositories {
+		names = append(names, repository.RepositorySlug)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestStableTopologicalOrder(t *testing.T) {
+	cases := []struct {
+		name     string
+		length   int
+		edges    map[int][]int
+		expected string
+		cycle    string
+	}{
+		{name: "no edges", length: 3, edges: map[int][]int{}, expected: "[0 1 2]"},
+		{name: "reversed", length: 3, edges: map[int][]int{2: {1}, 1: {0}}, expected: "[2 1 0]"},
+		{name: "stable", length: 4, edges: map[int][]int{3: {0}}, expected: "[1 2 3 0]"},
+		{name: "diamond", length: 4, edges: map[int][]int{3: {1, 2}, 1: {0}, 2: {0}}, expected: "[3 1 2 0]"},
+		{name: "cycle", length: 3, edges: map[int][]int{0: {1}, 1: {2}, 2: {1}}, cycle: "[1 2]"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			order, err := stableTopologicalOrder(c.length, c.edges)
+			if c.cycle != "" {
+				cycle, ok := err.(cycleError)
+				if !ok || fmt.Sprint(cycle.Items) != c.cycle {
+					t.Errorf("expected the cycle %s, got %v", c.cycle, err)
+				}
+
+				return
+			}
+
+			if err != nil || fmt.Sprint(order) != c.expected {
+				t.Errorf("expected %s, got %v (%v)", c.expected, order, err)
+			}
+		})
+	}
+}
+
+func TestOrderMergePlan(t *testing.T) {
+	var (
+		lib = pullRequestOf("", "ws", "shared-lib", 1)
+		api = pullRequestOf("", "ws", "api", 2, lib)
+		web = pullRequestOf("", "ws", "web", 3, api, lib)
+	)
+
+	plan := bitbucketrelease_dto.MergePlan{}
+	for _, pullRequest := range []bitbucketrelease_dto.PullRequest{web, api, lib} {
+		plan.Add(pullRequest)
+	}
+
+	ordered, err := OrderMergePlan(plan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := repositoriesOf(ordered); actual != "shared-lib,api,web" {
+		t.Errorf("expected the repositories to be sorted by the dependencies, got %s", actual)
+	}
+
+	dependsOn := ordered.Repositories[2].DependsOn
+	if len(dependsOn) != 2 || dependsOn[0].RepositorySlug != "api" || dependsOn[1].RepositorySlug != "shared-lib" {
+		t.Errorf("expected the sorted prerequisites of web, got %+v", dependsOn)
+	}
+}
+
+func TestOrderMergePlanByRepositoryOrder(t *testing.T) {
+	plan := bitbucketrelease_dto.MergePlan{}
+	for _, pullRequest := range []bitbucketrelease_dto.PullRequest{pullRequestOf("", "ws", "web", 1), pullRequestOf("", "ws", "api", 2), pullRequestOf("", "ws", "docs", 3)} {
+		plan.Add(pullRequest)
+	}
+
+	ordered, err := OrderMergePlan(plan, []string{"api", "ws/web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := repositoriesOf(ordered); actual != "api,web,docs" {
+		t.Errorf("expected the configured order, got %s", actual)
+	}
+}
+
+func TestOrderMergePlanWithCircularDependency(t *testing.T) {
+	var (
+		first  = pullRequestOf("", "ws", "api", 1)
+		second = pullRequestOf("", "ws", "web", 2, first)
+	)
+
+	first.DependsOn = []bitbucketrelease_dto.PullRequest{second}
+
+	plan := bitbucketrelease_dto.MergePlan{}
+	plan.Add(first)
+	plan.Add(second)
+
+	if _, err := OrderMergePlan(plan, nil); err == nil || !strings.Contains(err.Error(), "circular dependency: api, web") {
+		t.Errorf("expected the circular dependency error, got %v", err)
+	}
+}
+
+func TestOrderMergePlanRespectsHost(t *testing.T) {
+	var (
+		cloud  = pullRequestOf("", "ws", "api", 1)
+		server = pullRequestOf("git.example.com", "ws", "api", 2)
+		web    = pullRequestOf("", "ws", "web", 3, pullRequestOf("git.example.com", "ws", "api", 2))
+	)
+
+	plan := bitbucketrelease_dto.MergePlan{}
+	for _, pullRequest := range []bitbucketrelease_dto.PullRequest{web, cloud, server} {
+		plan.Add(pullRequest)
+	}
+
+	ordered, err := OrderMergePlan(plan, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ordered.Repositories) != 3 || ordered.Repositories[1].Host != "git.example.com" || ordered.Repositories[2].RepositorySlug != "web" {
+		t.Fatalf("expected web after the server repository, got %+v", ordered.Repositories)
+	}
+
+	if dependsOn := ordered.Repositories[2].DependsOn; len(dependsOn) != 1 || dependsOn[0].Host != "git.example.com" {
+		t.Errorf("expected web to depend on the server repository only, got %+v", dependsOn)
+	}
+}
+
+func TestOrderPullRequests(t *testing.T) {
+	var (
+		first  = pullRequestOf("", "ws", "api", 1)
+		second = pullRequestOf("", "ws", "api", 2, first)
+		third  = pullRequestOf("", "ws", "api", 3)
+	)
+
+	ordered, err := orderPullRequests([]bitbucketrelease_dto.PullRequest{second, third, first})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for _, pullRequest := range ordered {
+		ids = append(ids, pullRequest.ID)
+	}
+
+	if fmt.Sprint(ids) != "[3 1 2]" {
+		t.Errorf("expected [3 1 2], got %v", ids)
+	}
+}
+
+func TestMergePlanRespectsHost(t *testing.T) {
+	plan := bitbucketrelease_dto.MergePlan{}
+	plan.Add(pullRequestOf("", "ws", "api", 1))
+	plan.Add(pullRequestOf("git.example.com", "ws", "api", 2))
+
+	if len(plan.Repositories) != 2 {
+		t.Fatalf("expected 2 repositories, got %d", len(plan.Repositories))
+	}
+
+	if repository, ok := plan.Repository("git.example.com", "ws", "api"); !ok || repository.PullRequests[0].ID != 2 {
+		t.Errorf("expected the server repository, got %+v", repository)
+	}
+
+	plan.RemoveRepository("git.example.com", "ws", "api")
+	if _, ok := plan.Repository("", "ws", "api"); !ok || plan.Len() != 1 {
+		t.Errorf("expected only the server repository to be removed, got %+v", plan)
+	}
+}
@@ -0,0 +1,363 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"github.com/sharovik/devbot/internal/log"
+	"net/http"
+	"net/url"
+)
+
+const (
+	gitHubStateOpen       = "open"
+	gitHubReviewApproved  = "APPROVED"
+	gitHubReviewCommented = "COMMENTED"
+	gitHubMergeSquash     = "squash"
+	gitHubMergeMerge      = "merge"
+	gitHubCheckCompleted  = "completed"
+	gitHubPageSize        = 100
+)
+
+// gitHubProvider the GitHub or GitHub Enterprise provider. The owner is used as the workspace
+type gitHubProvider struct {
+	host   bitbucketrelease_dto.ProviderHost
+	client restClient
+}
+
+func newGitHubProvider(host bitbucketrelease_dto.ProviderHost) gitHubProvider {
+	return gitHubProvider{
+		host: host,
+		client: newRestClient(host.URL, map[string]string{
+			"Authorization": fmt.Sprintf("Bearer %s", host.Token),
+			"Accept":        "application/vnd.github+json",
+		}),
+	}
+}
+
+// defaultGitHubURL returns the API URL of github.com or GitHub Enterprise host
+func defaultGitHubURL(host string) string {
+	if host == "github.com" {
+		return "https://api.github.com"
+	}
+
+	return "https://" + host + "/api/v3"
+}
+
+func (p gitHubProvider) repositoryEndpoint(owner string, repository string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(repository))
+}
+
+// PullRequest returns the pull-request with its approvals
+func (p gitHubProvider) PullRequest(ctx context.Context, owner string, repository string, pullRequestID int64) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var pullRequest bitbucketrelease_dto.GitHubPullRequest
+	if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d", p.repositoryEndpoint(owner, repository), pullRequestID), nil, &pullRequest); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	result := gitHubPullRequest(pullRequest)
+
+	approvedBy, err := p.approvedBy(ctx, owner, repository, pullRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, "Failed to get the reviews")
+	}
+
+	result.ApprovedBy = approvedBy
+	return result, nil
+}
+
+// approvedBy returns the users, whose latest review approves the pull-request
+func (p gitHubProvider) approvedBy(ctx context.Context, owner string, repository string, pullRequestID int64) ([]bitbucketrelease_dto.ProviderUser, error) {
+	var (
+		latestStates = map[string]string{}
+		users        []string
+	)
+
+	for page := 1; ; page++ {
+		var reviews []bitbucketrelease_dto.GitHubReview
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/pulls/%d/reviews?per_page=100&page=%d", p.repositoryEndpoint(owner, repository), pullRequestID, page), nil, &reviews); err != nil {
+			return nil, err
+		}
+
+		for _, review := range reviews {
+			//The comment does not change the previous decision of the reviewer
+			if review.State == gitHubReviewCommented {
+				continue
+			}
+
+			if _, ok := latestStates[review.User.Login]; !ok {
+				users = append(users, review.User.Login)
+			}
+
+			latestStates[review.User.Login] = review.State
+		}
+
+		if len(reviews) < 100 {
+			break
+		}
+	}
+
+	var approvedBy []bitbucketrelease_dto.ProviderUser
+	for _, user := range users {
+		if latestStates[user] == gitHubReviewApproved {
+			approvedBy = append(approvedBy, bitbucketrelease_dto.ProviderUser{ID: user, Name: user})
+		}
+	}
+
+	return approvedBy, nil
+}
+
+// MergePullRequest merges the pull-request
+func (p gitHubProvider) MergePullRequest(ctx context.Context, owner string, repository string, pullRequestID int64, message string, strategy string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	method := gitHubMergeMerge
+	if strategy == client.StrategySquash {
+		method = gitHubMergeSquash
+	}
+
+	var response bitbucketrelease_dto.GitHubMergeResponse
+	err := p.client.request(ctx, http.MethodPut, fmt.Sprintf("%s/pulls/%d/merge", p.repositoryEndpoint(owner, repository), pullRequestID), map[string]string{
+		"merge_method":   method,
+		"commit_message": message,
+	}, &response)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	pullRequest, err := p.PullRequest(ctx, owner, repository, pullRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	pullRequest.MergeCommit = response.SHA
+	return pullRequest, nil
+}
+
+// ChangePullRequestDestination changes the base branch and the title of the pull-request
+func (p gitHubProvider) ChangePullRequestDestination(ctx context.Context, owner string, repository string, pullRequestID int64, title string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var pullRequest bitbucketrelease_dto.GitHubPullRequest
+	err := p.client.request(ctx, http.MethodPatch, fmt.Sprintf("%s/pulls/%d", p.repositoryEndpoint(owner, repository), pullRequestID), map[string]string{
+		"title": title,
+		"base":  branchName,
+	}, &pullRequest)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return gitHubPullRequest(pullRequest), nil
+}
+
+// CreateBranch creates the branch from the selected branch or from the default branch of the repository
+func (p gitHubProvider) CreateBranch(ctx context.Context, owner string, repository string, branchName string, fromBranch string) (bitbucketrelease_dto.ProviderBranch, error) {
+	if fromBranch == "" {
+		defaultBranch, err := p.defaultBranch(ctx, owner, repository)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderBranch{}, err
+		}
+
+		fromBranch = defaultBranch
+	}
+
+	var head bitbucketrelease_dto.GitHubGitRef
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/git/ref/heads/%s", p.repositoryEndpoint(owner, repository), fromBranch), nil, &head)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, errors.Wrap(err, fmt.Sprintf("Failed to get the branch %s", fromBranch))
+	}
+
+	var created bitbucketrelease_dto.GitHubGitRef
+	err = p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/git/refs", p.repositoryEndpoint(owner, repository)), map[string]string{
+		"ref": "refs/heads/" + branchName,
+		"sha": head.Object.SHA,
+	}, &created)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, err
+	}
+
+	return bitbucketrelease_dto.ProviderBranch{Name: branchName, Hash: created.Object.SHA}, nil
+}
+
+// MainBranch returns the default branch of the repository
+func (p gitHubProvider) MainBranch(ctx context.Context, owner string, repository string) (string, error) {
+	return p.defaultBranch(ctx, owner, repository)
+}
+
+func (p gitHubProvider) defaultBranch(ctx context.Context, owner string, repository string) (string, error) {
+	var response bitbucketrelease_dto.GitHubRepository
+	if err := p.client.request(ctx, http.MethodGet, p.repositoryEndpoint(owner, repository), nil, &response); err != nil {
+		return "", errors.Wrap(err, "Failed to get the repository")
+	}
+
+	return response.DefaultBranch, nil
+}
+
+// CreatePullRequest opens the pull-request. When the request has no reviewers, they are taken from the host configuration
+func (p gitHubProvider) CreatePullRequest(ctx context.Context, owner string, repository string, request bitbucketrelease_dto.ProviderPullRequestCreate) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	destination := request.DestinationBranch
+	if destination == "" {
+		defaultBranch, err := p.defaultBranch(ctx, owner, repository)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderPullRequest{}, err
+		}
+
+		destination = defaultBranch
+	}
+
+	var pullRequest bitbucketrelease_dto.GitHubPullRequest
+	err := p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/pulls", p.repositoryEndpoint(owner, repository)), map[string]string{
+		"title": request.Title,
+		"body":  request.Description,
+		"head":  request.SourceBranch,
+		"base":  destination,
+	}, &pullRequest)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	if reviewers := requestReviewers(request, p.host); len(reviewers) > 0 {
+		err = p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/pulls/%d/requested_reviewers", p.repositoryEndpoint(owner, repository), pullRequest.Number), map[string][]string{
+			"reviewers": reviewers,
+		}, nil)
+		//The pull-request is already open, so the failed reviewers request doesn't fail its creation
+		if err != nil {
+			log.Logger().Warn().
+				Err(err).
+				Int64("pull_request_id", pullRequest.Number).
+				Interface("reviewers", reviewers).
+				Msg("Failed to request the reviewers of the pull-request")
+		}
+	}
+
+	return gitHubPullRequest(pullRequest), nil
+}
+
+// BranchExists returns true when the repository has the branch
+func (p gitHubProvider) BranchExists(ctx context.Context, owner string, repository string, branchName string) (bool, error) {
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/branches/%s", p.repositoryEndpoint(owner, repository), url.PathEscape(branchName)), nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// DeleteBranch deletes the branch of the repository
+func (p gitHubProvider) DeleteBranch(ctx context.Context, owner string, repository string, branchName string) error {
+	return p.client.request(ctx, http.MethodDelete, fmt.Sprintf("%s/git/refs/heads/%s", p.repositoryEndpoint(owner, repository), branchName), nil, nil)
+}
+
+// OpenPullRequest returns the open pull-request from the selected branch
+func (p gitHubProvider) OpenPullRequest(ctx context.Context, owner string, repository string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var pullRequests []bitbucketrelease_dto.GitHubPullRequest
+	endpoint := fmt.Sprintf("%s/pulls?state=open&head=%s", p.repositoryEndpoint(owner, repository), url.QueryEscape(owner+":"+branchName))
+	if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &pullRequests); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, fmt.Sprintf("Failed to find the pull-requests of the branch %s", branchName))
+	}
+
+	if len(pullRequests) == 0 {
+		return bitbucketrelease_dto.ProviderPullRequest{}, nil
+	}
+
+	return gitHubPullRequest(pullRequests[0]), nil
+}
+
+// OpenPullRequests returns the open pull-requests of the repository
+func (p gitHubProvider) OpenPullRequests(ctx context.Context, owner string, repository string, destinationBranch string) ([]bitbucketrelease_dto.ProviderPullRequest, error) {
+	var pullRequests []bitbucketrelease_dto.ProviderPullRequest
+	for page := 1; ; page++ {
+		endpoint := fmt.Sprintf("%s/pulls?state=open&per_page=100&page=%d", p.repositoryEndpoint(owner, repository), page)
+		if destinationBranch != "" {
+			endpoint += "&base=" + url.QueryEscape(destinationBranch)
+		}
+
+		var response []bitbucketrelease_dto.GitHubPullRequest
+		if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+			return nil, errors.Wrap(err, "Failed to get the open pull-requests")
+		}
+
+		for _, item := range response {
+			pullRequests = append(pullRequests, gitHubPullRequest(item))
+		}
+
+		if len(response) < 100 {
+			return pullRequests, nil
+		}
+	}
+}
+
+// BuildStatuses returns the commit statuses and the check runs of the commit. All pages of both lists are read
+func (p gitHubProvider) BuildStatuses(ctx context.Context, owner string, repository string, commitHash string) ([]bitbucketrelease_dto.BuildStatus, error) {
+	var statuses []bitbucketrelease_dto.BuildStatus
+	for page, received := 1, 0; ; page++ {
+		var combined bitbucketrelease_dto.GitHubCombinedStatus
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/commits/%s/status?per_page=%d&page=%d", p.repositoryEndpoint(owner, repository), commitHash, gitHubPageSize, page), nil, &combined); err != nil {
+			return nil, err
+		}
+
+		for _, status := range combined.Statuses {
+			state := buildStateFailed
+			switch status.State {
+			case "success":
+				state = buildStateSuccessful
+			case "pending":
+				state = buildStateInProgress
+			}
+
+			statuses = append(statuses, bitbucketrelease_dto.BuildStatus{Key: status.Context, Name: status.Context, State: state, URL: status.TargetURL})
+		}
+
+		received += len(combined.Statuses)
+		if len(combined.Statuses) < gitHubPageSize || received >= combined.TotalCount {
+			break
+		}
+	}
+
+	for page, received := 1, 0; ; page++ {
+		var checks bitbucketrelease_dto.GitHubCheckRuns
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/commits/%s/check-runs?per_page=%d&page=%d", p.repositoryEndpoint(owner, repository), commitHash, gitHubPageSize, page), nil, &checks); err != nil {
+			return nil, err
+		}
+
+		for _, check := range checks.CheckRuns {
+			state := buildStateFailed
+			switch {
+			case check.Status != gitHubCheckCompleted:
+				state = buildStateInProgress
+			case check.Conclusion == "success" || check.Conclusion == "neutral" || check.Conclusion == "skipped":
+				state = buildStateSuccessful
+			}
+
+			statuses = append(statuses, bitbucketrelease_dto.BuildStatus{Key: check.Name, Name: check.Name, State: state, URL: check.HTMLURL})
+		}
+
+		received += len(checks.CheckRuns)
+		if len(checks.CheckRuns) < gitHubPageSize || received >= checks.TotalCount {
+			return statuses, nil
+		}
+	}
+}
+
+// gitHubPullRequest converts GitHub pull-request. The logins are used as the user IDs
+func gitHubPullRequest(pullRequest bitbucketrelease_dto.GitHubPullRequest) bitbucketrelease_dto.ProviderPullRequest {
+	state := bitbucketrelease_dto.ProviderPullRequestStateDeclined
+	switch {
+	case pullRequest.Merged:
+		state = bitbucketrelease_dto.ProviderPullRequestStateMerged
+	case pullRequest.State == gitHubStateOpen:
+		state = bitbucketrelease_dto.ProviderPullRequestStateOpen
+	}
+
+	return bitbucketrelease_dto.ProviderPullRequest{
+		ID:                pullRequest.Number,
+		Title:             pullRequest.Title,
+		Description:       pullRequest.Body,
+		State:             state,
+		Author:            bitbucketrelease_dto.ProviderUser{ID: pullRequest.User.Login, Name: pullRequest.User.Login},
+		RepositorySlug:    pullRequest.Base.Repo.Name,
+		SourceBranch:      pullRequest.Head.Ref,
+		SourceCommit:      pullRequest.Head.SHA,
+		DestinationBranch: pullRequest.Base.Ref,
+		MergeCommit:       pullRequest.MergeCommitSHA,
+		Link:              pullRequest.HTMLURL,
+	}
+}
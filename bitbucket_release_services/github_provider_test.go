@@ -0,0 +1,36 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGitHubCreatePullRequestWithFailedReviewers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/requested_reviewers") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"number": 5, "state": "open", "html_url": "https://github.com/my-owner/api/pull/5"}`))
+	}))
+	defer server.Close()
+
+	pullRequest, err := newGitHubProvider(bitbucketrelease_dto.ProviderHost{URL: server.URL}).CreatePullRequest(context.Background(), "my-owner", "api", bitbucketrelease_dto.ProviderPullRequestCreate{
+		Title:             "Release pull-request",
+		SourceBranch:      "release/1",
+		DestinationBranch: "main",
+		Reviewers:         []string{"unknown-user"},
+	})
+	if err != nil {
+		t.Fatalf("expected the open pull-request without the error, got %s", err)
+	}
+
+	if pullRequest.ID != 5 || pullRequest.Link != "https://github.com/my-owner/api/pull/5" {
+		t.Errorf("expected the created pull-request, got %+v", pullRequest)
+	}
+}
@@ -0,0 +1,295 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"net/http"
+	"net/url"
+)
+
+const (
+	gitLabStateOpened = "opened"
+	gitLabStateMerged = "merged"
+)
+
+// gitLabProvider the GitLab provider. The namespace of the project is used as the workspace
+type gitLabProvider struct {
+	host   bitbucketrelease_dto.ProviderHost
+	client restClient
+}
+
+func newGitLabProvider(host bitbucketrelease_dto.ProviderHost) gitLabProvider {
+	return gitLabProvider{
+		host:   host,
+		client: newRestClient(host.URL, map[string]string{"PRIVATE-TOKEN": host.Token}),
+	}
+}
+
+func (p gitLabProvider) projectEndpoint(namespace string, project string) string {
+	return fmt.Sprintf("/projects/%s", url.PathEscape(namespace+"/"+project))
+}
+
+func (p gitLabProvider) mergeRequest(ctx context.Context, namespace string, project string, mergeRequestID int64) (bitbucketrelease_dto.GitLabMergeRequest, error) {
+	var mergeRequest bitbucketrelease_dto.GitLabMergeRequest
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", p.projectEndpoint(namespace, project), mergeRequestID), nil, &mergeRequest)
+	return mergeRequest, err
+}
+
+// PullRequest returns the merge request with its approvals
+func (p gitLabProvider) PullRequest(ctx context.Context, namespace string, project string, mergeRequestID int64) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	mergeRequest, err := p.mergeRequest(ctx, namespace, project, mergeRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return p.withApprovals(ctx, namespace, project, gitLabPullRequest(project, mergeRequest))
+}
+
+func (p gitLabProvider) withApprovals(ctx context.Context, namespace string, project string, pullRequest bitbucketrelease_dto.ProviderPullRequest) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var approvals bitbucketrelease_dto.GitLabApprovals
+	if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/approvals", p.projectEndpoint(namespace, project), pullRequest.ID), nil, &approvals); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, "Failed to get the approvals")
+	}
+
+	for _, approval := range approvals.ApprovedBy {
+		pullRequest.ApprovedBy = append(pullRequest.ApprovedBy, gitLabUser(approval.User))
+	}
+
+	return pullRequest, nil
+}
+
+// MergePullRequest merges the merge request. The commits are squashed for client.StrategySquash strategy
+func (p gitLabProvider) MergePullRequest(ctx context.Context, namespace string, project string, mergeRequestID int64, message string, strategy string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	request := map[string]interface{}{
+		"squash":               strategy == client.StrategySquash,
+		"merge_commit_message": message,
+	}
+
+	if strategy == client.StrategySquash {
+		request["squash_commit_message"] = message
+	}
+
+	var mergeRequest bitbucketrelease_dto.GitLabMergeRequest
+	if err := p.client.request(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d/merge", p.projectEndpoint(namespace, project), mergeRequestID), request, &mergeRequest); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return gitLabPullRequest(project, mergeRequest), nil
+}
+
+// ChangePullRequestDestination changes the target branch and the title of the merge request
+func (p gitLabProvider) ChangePullRequestDestination(ctx context.Context, namespace string, project string, mergeRequestID int64, title string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var mergeRequest bitbucketrelease_dto.GitLabMergeRequest
+	err := p.client.request(ctx, http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", p.projectEndpoint(namespace, project), mergeRequestID), map[string]string{
+		"title":         title,
+		"target_branch": branchName,
+	}, &mergeRequest)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return gitLabPullRequest(project, mergeRequest), nil
+}
+
+// CreateBranch creates the branch from the selected branch or from the default branch of the project
+func (p gitLabProvider) CreateBranch(ctx context.Context, namespace string, project string, branchName string, fromBranch string) (bitbucketrelease_dto.ProviderBranch, error) {
+	if fromBranch == "" {
+		defaultBranch, err := p.defaultBranch(ctx, namespace, project)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderBranch{}, err
+		}
+
+		fromBranch = defaultBranch
+	}
+
+	var branch bitbucketrelease_dto.GitLabBranch
+	endpoint := fmt.Sprintf("%s/repository/branches?branch=%s&ref=%s", p.projectEndpoint(namespace, project), url.QueryEscape(branchName), url.QueryEscape(fromBranch))
+	if err := p.client.request(ctx, http.MethodPost, endpoint, nil, &branch); err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, err
+	}
+
+	return bitbucketrelease_dto.ProviderBranch{Name: branch.Name, Hash: branch.Commit.ID}, nil
+}
+
+// MainBranch returns the default branch of the project
+func (p gitLabProvider) MainBranch(ctx context.Context, namespace string, project string) (string, error) {
+	return p.defaultBranch(ctx, namespace, project)
+}
+
+func (p gitLabProvider) defaultBranch(ctx context.Context, namespace string, project string) (string, error) {
+	var response bitbucketrelease_dto.GitLabProject
+	if err := p.client.request(ctx, http.MethodGet, p.projectEndpoint(namespace, project), nil, &response); err != nil {
+		return "", errors.Wrap(err, "Failed to get the project")
+	}
+
+	return response.DefaultBranch, nil
+}
+
+// CreatePullRequest opens the merge request. When the request has no reviewers, they are taken from the host configuration
+func (p gitLabProvider) CreatePullRequest(ctx context.Context, namespace string, project string, request bitbucketrelease_dto.ProviderPullRequestCreate) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	destination := request.DestinationBranch
+	if destination == "" {
+		defaultBranch, err := p.defaultBranch(ctx, namespace, project)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderPullRequest{}, err
+		}
+
+		destination = defaultBranch
+	}
+
+	reviewerIDs, err := p.userIDs(ctx, requestReviewers(request, p.host))
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, "Failed to find the reviewers")
+	}
+
+	var mergeRequest bitbucketrelease_dto.GitLabMergeRequest
+	err = p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/merge_requests", p.projectEndpoint(namespace, project)), map[string]interface{}{
+		"title":         request.Title,
+		"description":   request.Description,
+		"source_branch": request.SourceBranch,
+		"target_branch": destination,
+		"reviewer_ids":  reviewerIDs,
+	}, &mergeRequest)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return gitLabPullRequest(project, mergeRequest), nil
+}
+
+// userIDs returns the IDs of the users with the selected usernames
+func (p gitLabProvider) userIDs(ctx context.Context, usernames []string) ([]int64, error) {
+	var ids []int64
+	for _, username := range usernames {
+		var users []bitbucketrelease_dto.GitLabUser
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("/users?username=%s", url.QueryEscape(username)), nil, &users); err != nil {
+			return nil, err
+		}
+
+		if len(users) == 0 {
+			return nil, fmt.Errorf("The user %s is not found.", username)
+		}
+
+		ids = append(ids, users[0].ID)
+	}
+
+	return ids, nil
+}
+
+// BranchExists returns true when the project has the branch
+func (p gitLabProvider) BranchExists(ctx context.Context, namespace string, project string, branchName string) (bool, error) {
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/repository/branches/%s", p.projectEndpoint(namespace, project), url.PathEscape(branchName)), nil, nil)
+	if isNotFound(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// DeleteBranch deletes the branch of the project
+func (p gitLabProvider) DeleteBranch(ctx context.Context, namespace string, project string, branchName string) error {
+	return p.client.request(ctx, http.MethodDelete, fmt.Sprintf("%s/repository/branches/%s", p.projectEndpoint(namespace, project), url.PathEscape(branchName)), nil, nil)
+}
+
+// OpenPullRequest returns the open merge request from the selected branch
+func (p gitLabProvider) OpenPullRequest(ctx context.Context, namespace string, project string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var mergeRequests []bitbucketrelease_dto.GitLabMergeRequest
+	endpoint := fmt.Sprintf("%s/merge_requests?state=%s&source_branch=%s", p.projectEndpoint(namespace, project), gitLabStateOpened, url.QueryEscape(branchName))
+	if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &mergeRequests); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, fmt.Sprintf("Failed to find the merge requests of the branch %s", branchName))
+	}
+
+	if len(mergeRequests) == 0 {
+		return bitbucketrelease_dto.ProviderPullRequest{}, nil
+	}
+
+	return gitLabPullRequest(project, mergeRequests[0]), nil
+}
+
+// OpenPullRequests returns the open merge requests of the project
+func (p gitLabProvider) OpenPullRequests(ctx context.Context, namespace string, project string, destinationBranch string) ([]bitbucketrelease_dto.ProviderPullRequest, error) {
+	var pullRequests []bitbucketrelease_dto.ProviderPullRequest
+	for page := 1; ; page++ {
+		endpoint := fmt.Sprintf("%s/merge_requests?state=%s&per_page=100&page=%d", p.projectEndpoint(namespace, project), gitLabStateOpened, page)
+		if destinationBranch != "" {
+			endpoint += "&target_branch=" + url.QueryEscape(destinationBranch)
+		}
+
+		var response []bitbucketrelease_dto.GitLabMergeRequest
+		if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+			return nil, errors.Wrap(err, "Failed to get the open merge requests")
+		}
+
+		for _, item := range response {
+			pullRequests = append(pullRequests, gitLabPullRequest(project, item))
+		}
+
+		if len(response) < 100 {
+			return pullRequests, nil
+		}
+	}
+}
+
+// BuildStatuses returns the pipeline job statuses of the commit. All pages of the statuses are read
+func (p gitLabProvider) BuildStatuses(ctx context.Context, namespace string, project string, commitHash string) ([]bitbucketrelease_dto.BuildStatus, error) {
+	var statuses []bitbucketrelease_dto.BuildStatus
+	for page := 1; ; page++ {
+		var response []bitbucketrelease_dto.GitLabCommitStatus
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/repository/commits/%s/statuses?per_page=100&page=%d", p.projectEndpoint(namespace, project), commitHash, page), nil, &response); err != nil {
+			return nil, err
+		}
+
+		for _, status := range response {
+			state := buildStateFailed
+			switch status.Status {
+			case "success":
+				state = buildStateSuccessful
+			case "pending", "running", "created":
+				state = buildStateInProgress
+			}
+
+			statuses = append(statuses, bitbucketrelease_dto.BuildStatus{Key: status.Name, Name: status.Name, State: state, URL: status.TargetURL})
+		}
+
+		if len(response) < 100 {
+			return statuses, nil
+		}
+	}
+}
+
+// gitLabPullRequest converts GitLab merge request. The usernames are used as the user IDs
+func gitLabPullRequest(project string, mergeRequest bitbucketrelease_dto.GitLabMergeRequest) bitbucketrelease_dto.ProviderPullRequest {
+	state := bitbucketrelease_dto.ProviderPullRequestStateDeclined
+	switch mergeRequest.State {
+	case gitLabStateOpened:
+		state = bitbucketrelease_dto.ProviderPullRequestStateOpen
+	case gitLabStateMerged:
+		state = bitbucketrelease_dto.ProviderPullRequestStateMerged
+	}
+
+	mergeCommit := mergeRequest.MergeCommitSHA
+	if mergeCommit == "" {
+		mergeCommit = mergeRequest.SquashCommitSHA
+	}
+
+	return bitbucketrelease_dto.ProviderPullRequest{
+		ID:                mergeRequest.IID,
+		Title:             mergeRequest.Title,
+		Description:       mergeRequest.Description,
+		State:             state,
+		Author:            gitLabUser(mergeRequest.Author),
+		RepositorySlug:    project,
+		SourceBranch:      mergeRequest.SourceBranch,
+		SourceCommit:      mergeRequest.SHA,
+		DestinationBranch: mergeRequest.TargetBranch,
+		MergeCommit:       mergeCommit,
+		Link:              mergeRequest.WebURL,
+	}
+}
+
+func gitLabUser(user bitbucketrelease_dto.GitLabUser) bitbucketrelease_dto.ProviderUser {
+	return bitbucketrelease_dto.ProviderUser{ID: user.Username, Name: user.Name}
+}
@@ -0,0 +1,129 @@
+package bitbucket_release_services
+
+import (
+	"bufio"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	icalDateFormat      = "20060102"
+	icalDateTimeFormat  = "20060102T150405"
+	icalUTCTimeFormat   = "20060102T150405Z"
+	icalAllDayDuration  = 24 * time.Hour
+	icalPropertyStart   = "DTSTART"
+	icalPropertyEnd     = "DTEND"
+	icalPropertySummary = "SUMMARY"
+)
+
+// readICalendarFreezes reads the freeze periods from the iCalendar file. Each VEVENT is one freeze period
+func readICalendarFreezes(path string, location *time.Location) ([]bitbucketrelease_dto.FreezePeriod, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed to open the iCalendar file")
+	}
+
+	defer file.Close()
+
+	return parseICalendarFreezes(file, location)
+}
+
+func parseICalendarFreezes(reader io.Reader, location *time.Location) ([]bitbucketrelease_dto.FreezePeriod, error) {
+	var (
+		freezes []bitbucketrelease_dto.FreezePeriod
+		current *bitbucketrelease_dto.FreezePeriod
+	)
+
+	lines, err := unfoldICalendarLines(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		switch {
+		case line == "BEGIN:VEVENT":
+			current = &bitbucketrelease_dto.FreezePeriod{}
+			continue
+		case line == "END:VEVENT":
+			if current != nil {
+				if current.To.IsZero() {
+					current.To = current.From.Add(icalAllDayDuration)
+				}
+
+				freezes = append(freezes, *current)
+			}
+
+			current = nil
+			continue
+		case current == nil:
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		params := strings.Split(parts[0], ";")
+		switch strings.ToUpper(params[0]) {
+		case icalPropertyStart:
+			if current.From, err = parseICalendarTime(params[1:], parts[1], location); err != nil {
+				return nil, err
+			}
+		case icalPropertyEnd:
+			if current.To, err = parseICalendarTime(params[1:], parts[1], location); err != nil {
+				return nil, err
+			}
+		case icalPropertySummary:
+			current.Reason = parts[1]
+		}
+	}
+
+	return freezes, nil
+}
+
+// unfoldICalendarLines joins the folded lines, which start with the space or tab
+func unfoldICalendarLines(reader io.Reader) ([]string, error) {
+	var (
+		lines   []string
+		scanner = bufio.NewScanner(reader)
+	)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+func parseICalendarTime(params []string, value string, location *time.Location) (time.Time, error) {
+	for _, param := range params {
+		if strings.HasPrefix(strings.ToUpper(param), "TZID=") {
+			tz, err := time.LoadLocation(param[len("TZID="):])
+			if err != nil {
+				return time.Time{}, errors.Wrap(err, "Failed to parse the iCalendar timezone")
+			}
+
+			location = tz
+		}
+	}
+
+	switch {
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse(icalUTCTimeFormat, value)
+	case len(value) == len(icalDateFormat):
+		return time.ParseInLocation(icalDateFormat, value, location)
+	default:
+		return time.ParseInLocation(icalDateTimeFormat, value, location)
+	}
+}
@@ -0,0 +1,81 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+)
+
+// DescribeOnePullRequestScenario returns the text with the actions, which MergeOnePullRequestScenario will do for the selected pull-requests
+func DescribeOnePullRequestScenario(options bitbucketrelease_dto.ReleaseOptions, pullRequests []bitbucketrelease_dto.PullRequest) string {
+	var text = ""
+	for _, pullRequest := range pullRequests {
+		if options.Target != "" && pullRequest.DestinationBranch != options.Target {
+			text += fmt.Sprintf("- switch the destination of pull-request #%d from `%s` to `%s`\n", pullRequest.ID, pullRequest.DestinationBranch, options.Target)
+		}
+
+		config := RepositoryConfigFor(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug)
+		text += fmt.Sprintf("- merge pull-request #%d of repository `%s` into its destination branch using `%s` strategy\n", pullRequest.ID, pullRequest.RepositorySlug, mergeStrategy(pullRequest, releaseStrategy(options, config)))
+		if policy := VersioningPolicyFor(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug); policy.Enabled && IsBitBucketCloud(pullRequest.Host) {
+			text += fmt.Sprintf("- create the next version tag with prefix `%s` on the merge commit\n", policy.TagPrefix)
+		}
+	}
+
+	return text
+}
+
+// DescribeMultiplePullRequestsScenario returns the text with the actions, which MergeMultiplePullRequestsScenario will do for the selected repository
+func DescribeMultiplePullRequestsScenario(user string, options bitbucketrelease_dto.ReleaseOptions, repository string, pullRequests []bitbucketrelease_dto.PullRequest) string {
+	releaseBranch, err := ResolveReleaseBranch(pullRequests[0].Host, pullRequests[0].Workspace, repository, user, pullRequests)
+	if err != nil {
+		return fmt.Sprintf("- the release branch cannot be selected, because of `%s`\n", err)
+	}
+
+	var (
+		config = RepositoryConfigFor(pullRequests[0].Host, pullRequests[0].Workspace, repository)
+		target = "the main branch"
+		text   = fmt.Sprintf("- create release branch `%s` in repository `%s`\n", releaseBranch.Name, repository)
+	)
+
+	if branch := releaseTarget(options, config); branch != "" {
+		target = fmt.Sprintf("`%s`", branch)
+		text = fmt.Sprintf("- create release branch `%s` from `%s` in repository `%s`\n", releaseBranch.Name, branch, repository)
+	}
+
+	if releaseBranch.Exists {
+		text = fmt.Sprintf("- reuse the open release branch `%s` in repository `%s`\n", releaseBranch.Name, repository)
+	}
+
+	for _, pullRequest := range pullRequests {
+		text += fmt.Sprintf("- switch the destination of pull-request #%d to `%s` and rename it to `%s`\n", pullRequest.ID, releaseBranch.Name, prepareReleaseTitle(pullRequest.Title))
+	}
+
+	for _, pullRequest := range pullRequests {
+		text += fmt.Sprintf("- merge pull-request #%d into `%s` using `%s` strategy\n", pullRequest.ID, releaseBranch.Name, mergeStrategy(pullRequest, releaseStrategy(options, config)))
+	}
+
+	if releaseBranch.Exists {
+		return text + fmt.Sprintf("- keep the open release pull-request %s\n", releaseBranch.ReleasePullRequestLink)
+	}
+
+	text += fmt.Sprintf("- open release pull-request `%s` from `%s` into %s%s\n", releasePullRequestTitle(config, repository, releaseBranch.Name), releaseBranch.Name, target, reviewersText(pullRequests[0].Host, config))
+	if currentConfig().AutoMerge.Enabled {
+		text += "- merge the release pull-request using `merge` strategy, once it is approved and the build is green\n"
+	}
+
+	return text
+}
+
+// reviewersText returns the text with the reviewers, which will be added to the release pull-request
+func reviewersText(host string, config bitbucketrelease_dto.RepositoryConfig) string {
+	var reviewers []string
+	for _, reviewer := range releaseReviewers(host, config) {
+		reviewers = append(reviewers, fmt.Sprintf("`%s`", reviewer))
+	}
+
+	if len(reviewers) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" with reviewers %s", strings.Join(reviewers, ", "))
+}
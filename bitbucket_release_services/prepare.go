@@ -0,0 +1,178 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+)
+
+// PreparedRepository the repository, where the release branch is ready and the destinations of the pull-requests are switched to it
+type PreparedRepository struct {
+	//Host the host of the VCS provider. It is empty for bitbucket.org repositories
+	Host string
+
+	Workspace      string
+	RepositorySlug string
+	ReleaseBranch  ReleaseBranch
+
+	//Branch the release branch, which is used for the release pull-request creation
+	Branch bitbucketrelease_dto.ProviderBranch
+
+	//Switched the pull-requests, which destinations were switched to the release branch. They keep the original destination branch and title
+	Switched []bitbucketrelease_dto.PullRequest
+
+	//Failed the pull-requests, which destinations cannot be switched to the release branch
+	Failed []bitbucketrelease_dto.PullRequest
+}
+
+// PrepareRepository selects or creates the release branch of the repository and switches the destinations of the pull-requests to it. Nothing is merged
+func PrepareRepository(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, options bitbucketrelease_dto.ReleaseOptions, repository string, pullRequests []bitbucketrelease_dto.PullRequest) (PreparedRepository, error) {
+	var prepared = PreparedRepository{
+		Host:           pullRequests[0].Host,
+		Workspace:      pullRequests[0].Workspace,
+		RepositorySlug: repository,
+	}
+
+	if err := ValidateTarget(context.Background(), prepared.Host, prepared.Workspace, repository, options.Target); err != nil {
+		failPullRequests(release, pullRequests, err.Error())
+		return prepared, err
+	}
+
+	releaseBranch, err := ResolveReleaseBranch(prepared.Host, prepared.Workspace, repository, message.OriginalMessage.User, pullRequests)
+	if err != nil {
+		log.Logger().AddError(err).Msg("Received an error during the release branch name selection")
+		failPullRequests(release, pullRequests, fmt.Sprintf("The release-branch cannot be selected: %s", err))
+		return prepared, errors.Wrap(err, fmt.Sprintf("\nThe release-branch for repository %s cannot be selected, because of `%s`", repository, err))
+	}
+
+	prepared.ReleaseBranch = releaseBranch
+	if releaseBranch.Exists {
+		prepared.Branch = bitbucketrelease_dto.ProviderBranch{Name: releaseBranch.Name}
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("For repository `%s` we have more then 1 pull-request. The release-branch `%s` is already open, so I will use it.", repository, releaseBranch.Name))
+	} else {
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("For repository `%s` we have more then 1 pull-request. I will create a release-branch `%s`.", repository, releaseBranch.Name))
+
+		prepared.Branch, err = ProviderFor(prepared.Host).CreateBranch(context.Background(), prepared.Workspace, repository, releaseBranch.Name, releaseTarget(options, RepositoryConfigFor(prepared.Host, prepared.Workspace, repository)))
+		if err != nil {
+			log.Logger().AddError(err).Msg("Received an error during the release branch creation")
+			failPullRequests(release, pullRequests, fmt.Sprintf("The release-branch cannot be created: %s", err))
+
+			return prepared, errors.Wrap(err, fmt.Sprintf("\nThe release-branch for repository %s cannot be created, because of `%s`", repository, err))
+		}
+	}
+
+	for _, pullRequest := range pullRequests {
+		//We switch the destination of the pull-request to the release branch
+		_, err := ProviderFor(pullRequest.Host).ChangePullRequestDestination(
+			context.Background(),
+			pullRequest.Workspace,
+			pullRequest.RepositorySlug,
+			pullRequest.ID,
+			prepareReleaseTitle(pullRequest.Title),
+			releaseBranch.Name)
+		if err != nil {
+			SendMessageToTheChannel(message.Channel, fmt.Sprintf("I've tried to switch the destination for pull-request #%d and I failed. Reason: `%s`\nNote! This pull-request will not be merged into release branch!", pullRequest.ID, err))
+			log.Logger().AddError(err).Msg("Received an error during the branch destination switch")
+			release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, fmt.Sprintf("The destination cannot be switched to the release branch: %s", err))
+			prepared.Failed = append(prepared.Failed, pullRequest)
+			continue
+		}
+
+		prepared.Switched = append(prepared.Switched, pullRequest)
+	}
+
+	return prepared, nil
+}
+
+// ValidateTarget checks, that the `--target` branch exists in the repository. Nothing is checked, when the target is not defined.
+// The provider request is cancelled, when the context is done or the check timeout is over
+func ValidateTarget(ctx context.Context, host string, workspace string, repository string, target string) error {
+	if target == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout())
+	defer cancel()
+
+	exists, err := ProviderFor(host).BranchExists(ctx, workspace, repository, target)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("The target branch %s of repository %s cannot be checked", target, repository))
+	}
+
+	if !exists {
+		return fmt.Errorf("The target branch `%s` does not exist in repository `%s`.", target, repository)
+	}
+
+	return nil
+}
+
+// RestorePullRequests switches the destinations and titles of the pull-requests back to the original ones
+func RestorePullRequests(pullRequests []bitbucketrelease_dto.PullRequest) error {
+	var failed []string
+	for _, pullRequest := range pullRequests {
+		_, err := ProviderFor(pullRequest.Host).ChangePullRequestDestination(
+			context.Background(),
+			pullRequest.Workspace,
+			pullRequest.RepositorySlug,
+			pullRequest.ID,
+			pullRequest.Title,
+			pullRequest.DestinationBranch)
+		if err != nil {
+			log.Logger().AddError(err).
+				Int64("pull_request_id", pullRequest.ID).
+				Str("destination", pullRequest.DestinationBranch).
+				Msg("Failed to restore the pull-request destination")
+			failed = append(failed, pullRequest.URL())
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(fmt.Sprintf("The destination of the pull-requests cannot be restored: %s", failed))
+	}
+
+	return nil
+}
+
+// CompensateRepository restores the destinations and titles of the prepared pull-requests, which were not merged into the release branch.
+// When nothing was merged and the release branch was created by this release, the branch is deleted if `delete_failed_branch` is enabled in the release configuration
+func CompensateRepository(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, prepared PreparedRepository, reason string) {
+	var (
+		notMerged []bitbucketrelease_dto.PullRequest
+		merged    = 0
+	)
+
+	for _, pullRequest := range prepared.Switched {
+		if release.PullRequestResult(pullRequest).Status == bitbucketrelease_dto.PullRequestStatusMerged {
+			merged++
+			continue
+		}
+
+		notMerged = append(notMerged, pullRequest)
+		if release.PullRequestResult(pullRequest).Status == "" {
+			release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, reason)
+		}
+	}
+
+	if len(notMerged) > 0 {
+		if err := RestorePullRequests(notMerged); err != nil {
+			SendMessageToTheChannel(message.Channel, fmt.Sprintf("I failed to restore the pull-requests of repository `%s`, please check them manually. Reason: `%s`", prepared.RepositorySlug, err))
+		} else {
+			SendMessageToTheChannel(message.Channel, fmt.Sprintf("I switched back the destination and the title of %d pull-request(s) of repository `%s`, which were not merged.", len(notMerged), prepared.RepositorySlug))
+		}
+	}
+
+	if merged > 0 || prepared.ReleaseBranch.Exists || prepared.Branch.Name == "" || !currentConfig().DeleteFailedBranch {
+		return
+	}
+
+	if err := ProviderFor(prepared.Host).DeleteBranch(context.Background(), prepared.Workspace, prepared.RepositorySlug, prepared.ReleaseBranch.Name); err != nil {
+		log.Logger().AddError(err).Str("branch", prepared.ReleaseBranch.Name).Msg("Failed to delete the release branch")
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("I failed to delete the empty release-branch `%s` of repository `%s`. Reason: `%s`", prepared.ReleaseBranch.Name, prepared.RepositorySlug, err))
+		return
+	}
+
+	SendMessageToTheChannel(message.Channel, fmt.Sprintf("I deleted the empty release-branch `%s` of repository `%s`.", prepared.ReleaseBranch.Name, prepared.RepositorySlug))
+}
@@ -0,0 +1,87 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/branches/develop"):
+			_, _ = w.Write([]byte(`{"name": "develop"}`))
+		case strings.HasSuffix(r.URL.Path, "/branches/forbidden"):
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", Type: bitbucketrelease_dto.ProviderGitHub, URL: server.URL}},
+	}
+
+	cases := []struct {
+		target string
+		err    string
+	}{
+		{target: ""},
+		{target: "develop"},
+		{target: "missing", err: "The target branch `missing` does not exist in repository `api`."},
+		{target: "forbidden", err: "The target branch forbidden of repository api cannot be checked"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.target, func(t *testing.T) {
+			err := ValidateTarget(context.Background(), "git.example.com", "my-owner", "api", c.target)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateTargetTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", Type: bitbucketrelease_dto.ProviderGitHub, URL: server.URL}},
+		Checks:  bitbucketrelease_dto.ChecksConfig{Timeout: 1},
+		Retry:   bitbucketrelease_dto.RetryConfig{Attempts: 1},
+	}
+
+	started := time.Now()
+	if err := ValidateTarget(context.Background(), "git.example.com", "my-owner", "api", "develop"); err == nil {
+		t.Error("expected the error, when the target branch cannot be checked in the check timeout")
+	}
+
+	if elapsed := time.Since(started); elapsed > 3*time.Second {
+		t.Errorf("expected the check to be cancelled after the check timeout, but it took %s", elapsed)
+	}
+}
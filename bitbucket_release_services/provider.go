@@ -0,0 +1,72 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+)
+
+// Provider the VCS provider operations, which are used by the release flow
+type Provider interface {
+	//PullRequest returns the pull-request with its approvals
+	PullRequest(ctx context.Context, workspace string, repository string, pullRequestID int64) (bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//MergePullRequest merges the pull-request using client.StrategySquash or client.StrategyMerge strategy
+	MergePullRequest(ctx context.Context, workspace string, repository string, pullRequestID int64, message string, strategy string) (bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//ChangePullRequestDestination changes the destination branch and the title of the pull-request
+	ChangePullRequestDestination(ctx context.Context, workspace string, repository string, pullRequestID int64, title string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//CreateBranch creates the branch from the selected branch. When the source branch is not defined, the main branch is used
+	CreateBranch(ctx context.Context, workspace string, repository string, branchName string, fromBranch string) (bitbucketrelease_dto.ProviderBranch, error)
+
+	//CreatePullRequest opens the pull-request. When the destination is not defined, the main branch is used
+	CreatePullRequest(ctx context.Context, workspace string, repository string, request bitbucketrelease_dto.ProviderPullRequestCreate) (bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//MainBranch returns the main branch of the repository
+	MainBranch(ctx context.Context, workspace string, repository string) (string, error)
+
+	//BranchExists returns true when the repository has the branch
+	BranchExists(ctx context.Context, workspace string, repository string, branchName string) (bool, error)
+
+	//DeleteBranch deletes the branch of the repository
+	DeleteBranch(ctx context.Context, workspace string, repository string, branchName string) error
+
+	//OpenPullRequest returns the open pull-request from the selected branch. The ID is 0 when there is no such pull-request
+	OpenPullRequest(ctx context.Context, workspace string, repository string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//OpenPullRequests returns the open pull-requests of the repository. When the destination branch is defined, only the pull-requests into this branch are returned
+	OpenPullRequests(ctx context.Context, workspace string, repository string, destinationBranch string) ([]bitbucketrelease_dto.ProviderPullRequest, error)
+
+	//BuildStatuses returns the build statuses of the commit in BitBucket format: SUCCESSFUL, INPROGRESS or FAILED
+	BuildStatuses(ctx context.Context, workspace string, repository string, commitHash string) ([]bitbucketrelease_dto.BuildStatus, error)
+}
+
+// ProviderFor returns the provider of the selected host with the retries of failed requests. The empty host means bitbucket.org
+func ProviderFor(host string) Provider {
+	providerHost, ok := ProviderHostFor(host)
+	if !ok {
+		return retryProvider{Provider: bitBucketProvider{}}
+	}
+
+	switch providerHost.Type {
+	case bitbucketrelease_dto.ProviderGitHub:
+		return retryProvider{Provider: newGitHubProvider(providerHost)}
+	case bitbucketrelease_dto.ProviderGitLab:
+		return retryProvider{Provider: newGitLabProvider(providerHost)}
+	default:
+		return retryProvider{Provider: newBitBucketServerProvider(providerHost)}
+	}
+}
+
+// errNotSupportedByProvider the error for the features, which are available for bitbucket.org only
+var errNotSupportedByProvider = errors.New("This feature is supported for bitbucket.org only.")
+
+// requestReviewers returns the reviewers of the pull-request creation request. When the request has no reviewers, the reviewers of the host configuration are used
+func requestReviewers(request bitbucketrelease_dto.ProviderPullRequestCreate, host bitbucketrelease_dto.ProviderHost) []string {
+	if len(request.Reviewers) > 0 {
+		return request.Reviewers
+	}
+
+	return host.Reviewers
+}
@@ -0,0 +1,127 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const bitBucketCloudHost = "bitbucket.org"
+
+// ErrNotPullRequestLink the error, which is returned when the link does not point to a pull-request
+var ErrNotPullRequestLink = errors.New("The link is not a pull-request link.")
+
+// ParsePullRequestLink parses the link to the pull-request of bitbucket.org or of the configured provider host.
+// The query string, the fragment and the path segments after the pull-request ID, e.g. `/diff`, are ignored
+func ParsePullRequestLink(link string) (bitbucketrelease_dto.PullRequest, error) {
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Host == "" {
+		return bitbucketrelease_dto.PullRequest{}, ErrNotPullRequestLink
+	}
+
+	var (
+		host     = strings.ToLower(parsed.Host)
+		segments = strings.FieldsFunc(parsed.Path, func(r rune) bool {
+			return r == '/'
+		})
+	)
+
+	if !isPullRequestPath(segments) {
+		return bitbucketrelease_dto.PullRequest{}, ErrNotPullRequestLink
+	}
+
+	if host == bitBucketCloudHost || host == "www."+bitBucketCloudHost {
+		return parseBitBucketLink(segments)
+	}
+
+	providerHost, ok := ProviderHostFor(host)
+	if !ok {
+		return bitbucketrelease_dto.PullRequest{}, fmt.Errorf("The host %s is not configured in the `servers` of the release configuration.", host)
+	}
+
+	var pullRequest bitbucketrelease_dto.PullRequest
+	switch providerHost.Type {
+	case bitbucketrelease_dto.ProviderGitHub:
+		pullRequest, err = parseGitHubLink(segments)
+	case bitbucketrelease_dto.ProviderGitLab:
+		pullRequest, err = parseGitLabLink(segments)
+	default:
+		pullRequest, err = parseBitBucketServerLink(segments)
+	}
+
+	if err != nil {
+		return bitbucketrelease_dto.PullRequest{}, err
+	}
+
+	pullRequest.Host = providerHost.Host
+	pullRequest.Provider = providerHost.Type
+	return pullRequest, nil
+}
+
+// isPullRequestPath returns true when the path has the pull-request segment of any provider
+func isPullRequestPath(segments []string) bool {
+	for _, segment := range segments {
+		switch segment {
+		case "pull-requests", "pull", "merge_requests":
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBitBucketLink parses /{workspace}/{repository}/pull-requests/{id} path
+func parseBitBucketLink(segments []string) (bitbucketrelease_dto.PullRequest, error) {
+	if len(segments) < 4 || segments[2] != "pull-requests" {
+		return bitbucketrelease_dto.PullRequest{}, errors.New("The link should look like https://bitbucket.org/{workspace}/{repository}/pull-requests/{id}.")
+	}
+
+	return newPullRequestReference(segments[0], segments[1], segments[3])
+}
+
+// parseBitBucketServerLink parses /projects/{project}/repos/{repository}/pull-requests/{id} path. The server can have the context path before it
+func parseBitBucketServerLink(segments []string) (bitbucketrelease_dto.PullRequest, error) {
+	for i := 0; i+5 < len(segments); i++ {
+		if strings.EqualFold(segments[i], "projects") && segments[i+2] == "repos" && segments[i+4] == "pull-requests" {
+			return newPullRequestReference(segments[i+1], segments[i+3], segments[i+5])
+		}
+	}
+
+	return bitbucketrelease_dto.PullRequest{}, errors.New("The link should look like https://{host}/projects/{project}/repos/{repository}/pull-requests/{id}.")
+}
+
+// parseGitHubLink parses /{owner}/{repository}/pull/{id} path
+func parseGitHubLink(segments []string) (bitbucketrelease_dto.PullRequest, error) {
+	if len(segments) < 4 || segments[2] != "pull" {
+		return bitbucketrelease_dto.PullRequest{}, errors.New("The link should look like https://{host}/{owner}/{repository}/pull/{id}.")
+	}
+
+	return newPullRequestReference(segments[0], segments[1], segments[3])
+}
+
+// parseGitLabLink parses /{namespace}/{project}/-/merge_requests/{id} path, where the namespace can contain the subgroups
+func parseGitLabLink(segments []string) (bitbucketrelease_dto.PullRequest, error) {
+	for i := 2; i+2 < len(segments); i++ {
+		if segments[i] == "-" && segments[i+1] == "merge_requests" {
+			return newPullRequestReference(strings.Join(segments[:i-1], "/"), segments[i-1], segments[i+2])
+		}
+	}
+
+	return bitbucketrelease_dto.PullRequest{}, errors.New("The link should look like https://{host}/{namespace}/{project}/-/merge_requests/{id}.")
+}
+
+func newPullRequestReference(workspace string, repository string, id string) (bitbucketrelease_dto.PullRequest, error) {
+	pullRequestID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || pullRequestID <= 0 {
+		return bitbucketrelease_dto.PullRequest{}, fmt.Errorf("The pull-request ID `%s` should be a positive number.", id)
+	}
+
+	return bitbucketrelease_dto.PullRequest{
+		Workspace:      workspace,
+		RepositorySlug: repository,
+		ID:             pullRequestID,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package bitbucket_release_services
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func TestParsePullRequestLink(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{Servers: []bitbucketrelease_dto.ProviderHost{
+		{Type: bitbucketrelease_dto.ProviderBitBucketServer, Host: "git.example.com"},
+		{Type: bitbucketrelease_dto.ProviderGitHub, Host: "github.com"},
+		{Type: bitbucketrelease_dto.ProviderGitLab, Host: "gitlab.example.com"},
+	}}
+
+	cases := []struct {
+		link       string
+		host       string
+		workspace  string
+		repository string
+		id         int64
+		err        string
+	}{
+		{link: "https://bitbucket.org/my-workspace/my-repository/pull-requests/12", workspace: "my-workspace", repository: "my-repository", id: 12},
+		{link: "https://www.bitbucket.org/my-workspace/my-repository/pull-requests/12/diff?w=1#comment", workspace: "my-workspace", repository: "my-repository", id: 12},
+		{link: "https://git.example.com/context/projects/PROJ/repos/my-repository/pull-requests/3/overview", host: "git.example.com", workspace: "PROJ", repository: "my-repository", id: 3},
+		{link: "https://github.com/my-organisation/my-repository/pull/7/files", host: "github.com", workspace: "my-organisation", repository: "my-repository", id: 7},
+		{link: "https://gitlab.example.com/group/subgroup/my-project/-/merge_requests/5", host: "gitlab.example.com", workspace: "group/subgroup", repository: "my-project", id: 5},
+		{link: "https://bitbucket.org/my-workspace/my-repository/pull-requests/abc", err: "should be a positive number"},
+		{link: "https://bitbucket.org/my-workspace/pull-requests/1", err: "The link should look like"},
+		{link: "https://unknown.example.com/my-workspace/my-repository/pull/1", err: "is not configured"},
+		{link: "https://bitbucket.org/my-workspace/my-repository/src/master", err: ErrNotPullRequestLink.Error()},
+	}
+
+	for _, c := range cases {
+		t.Run(c.link, func(t *testing.T) {
+			pullRequest, err := ParsePullRequestLink(c.link)
+			if c.err != "" {
+				if err == nil || !strings.Contains(err.Error(), c.err) {
+					t.Errorf("expected the error with %q, got %v", c.err, err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if pullRequest.Host != c.host || pullRequest.Workspace != c.workspace || pullRequest.RepositorySlug != c.repository || pullRequest.ID != c.id {
+				t.Errorf("expected %s %s/%s#%d, got %+v", c.host, c.workspace, c.repository, c.id, pullRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//defaultReleaseBranchTemplate the template of the release branch name, which is used when there is no template in the release configuration
+	defaultReleaseBranchTemplate = "release/{date}"
+
+	//maxReleaseBranchAttempts the maximum number of names, which will be checked before we give up
+	maxReleaseBranchAttempts = 50
+)
+
+// ReleaseBranch the release branch, which should be used for the repository
+type ReleaseBranch struct {
+	Name string
+
+	//ReleasePullRequestID the ID of the open release pull-request of the existing release branch
+	ReleasePullRequestID int64
+
+	//ReleasePullRequestLink the link to the open release pull-request of the existing release branch
+	ReleasePullRequestLink string
+
+	//Exists when true, the open release branch will be reused and no new branch and release pull-request will be created
+	Exists bool
+}
+
+// pullRequestsResponse the response of BitBucket pull-requests list endpoint
+type pullRequestsResponse struct {
+	Values []struct {
+		ID    int64 `json:"id"`
+		Links struct {
+			HTML struct {
+				Href string `json:"href"`
+			} `json:"html"`
+		} `json:"links"`
+	} `json:"values"`
+	Next string `json:"next"`
+}
+
+// releaseBranchTemplate returns the template of the release branch name. The template of the repository configuration has the priority
+func releaseBranchTemplate(host string, workspace string, repository string) string {
+	if template := RepositoryConfigFor(host, workspace, repository).ReleaseBranchTemplate; template != "" {
+		return template
+	}
+
+	return defaultReleaseBranchTemplate
+}
+
+// releaseBranchVariables the patterns of the release branch template variables
+var releaseBranchVariables = map[string]string{
+	"{date}":     `\d{4}\.\d{2}\.\d{2}`,
+	"{time}":     `\d{2}\.\d{2}`,
+	"{sequence}": `\d+`,
+	"{version}":  `\d+\.\d+\.\d+`,
+	"{user}":     `[\w.-]+`,
+}
+
+// releaseBranchRegex returns the regular expression, which matches the names created by the release branch template, including the `-N` suffix
+func releaseBranchRegex(template string) *regexp.Regexp {
+	pattern := regexp.QuoteMeta(template)
+	for variable, variablePattern := range releaseBranchVariables {
+		pattern = strings.Replace(pattern, regexp.QuoteMeta(variable), variablePattern, -1)
+	}
+
+	if !strings.Contains(template, "{sequence}") {
+		pattern += `(?:-\d+)?`
+	}
+
+	return regexp.MustCompile("^" + pattern + "$")
+}
+
+// isReleaseBranchName returns true when the branch name was created by the release branch template of the repository
+func isReleaseBranchName(host string, workspace string, repository string, branchName string) bool {
+	return releaseBranchRegex(releaseBranchTemplate(host, workspace, repository)).MatchString(branchName)
+}
+
+// newReleaseBranchName returns the release branch name from the template. Available variables: {date}, {time}, {sequence}, {version}, {user}
+func newReleaseBranchName(template string, now time.Time, sequence int, user string, version string) string {
+	name := strings.NewReplacer(
+		"{date}", now.Format("2006.01.02"),
+		"{time}", now.Format("15.04"),
+		"{sequence}", strconv.Itoa(sequence),
+		"{version}", version,
+		"{user}", strings.ToLower(user),
+	).Replace(template)
+
+	if sequence > 1 && !strings.Contains(template, "{sequence}") {
+		name = fmt.Sprintf("%s-%d", name, sequence)
+	}
+
+	return name
+}
+
+// ResolveReleaseBranch returns the release branch for the repository. If the branch with the same name already exists and it has open pull-request, it will be reused. Otherwise the next free name is selected
+func ResolveReleaseBranch(host string, workspace string, repository string, user string, pullRequests []bitbucketrelease_dto.PullRequest) (ReleaseBranch, error) {
+	var (
+		template = releaseBranchTemplate(host, workspace, repository)
+		now      = time.Now()
+		version  = ""
+	)
+
+	if strings.Contains(template, "{version}") {
+		if !IsBitBucketCloud(host) {
+			return ReleaseBranch{}, errors.New("The `{version}` variable of the release branch template is supported for bitbucket.org only.")
+		}
+
+		nextVersion, err := nextReleaseVersion(host, workspace, repository, pullRequests)
+		if err != nil {
+			return ReleaseBranch{}, err
+		}
+
+		version = nextVersion
+	}
+
+	for sequence := 1; sequence <= maxReleaseBranchAttempts; sequence++ {
+		name := newReleaseBranchName(template, now, sequence, user, version)
+
+		exists, err := ProviderFor(host).BranchExists(context.Background(), workspace, repository, name)
+		if err != nil {
+			return ReleaseBranch{}, errors.Wrap(err, fmt.Sprintf("Failed to check the branch %s", name))
+		}
+
+		if !exists {
+			return ReleaseBranch{Name: name}, nil
+		}
+
+		pullRequest, err := ProviderFor(host).OpenPullRequest(context.Background(), workspace, repository, name)
+		if err != nil {
+			return ReleaseBranch{}, err
+		}
+
+		if pullRequest.Link != "" {
+			log.Logger().Debug().
+				Str("repository", repository).
+				Str("branch", name).
+				Msg("Found the open release branch, it will be reused")
+			return ReleaseBranch{Name: name, ReleasePullRequestID: pullRequest.ID, ReleasePullRequestLink: pullRequest.Link, Exists: true}, nil
+		}
+	}
+
+	return ReleaseBranch{}, fmt.Errorf("I cannot find the free name for the release branch, all %d names are already used.", maxReleaseBranchAttempts)
+}
+
+// nextReleaseVersion returns the next version of the repository for the release branch name
+func nextReleaseVersion(host string, workspace string, repository string, pullRequests []bitbucketrelease_dto.PullRequest) (string, error) {
+	policy := VersioningPolicyFor(host, workspace, repository)
+
+	latest, hasLatest, err := LatestVersion(context.Background(), workspace, repository, policy.TagPrefix)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the latest version for the release branch name")
+	}
+
+	version, err := NextVersion(policy, latest, hasLatest, pullRequests)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the next version for the release branch name")
+	}
+
+	return version.String(), nil
+}
@@ -0,0 +1,58 @@
+package bitbucket_release_services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewReleaseBranchName(t *testing.T) {
+	now := time.Date(2026, 3, 7, 9, 5, 0, 0, time.UTC)
+
+	cases := []struct {
+		template string
+		sequence int
+		expected string
+	}{
+		{template: "release/{date}", sequence: 1, expected: "release/2026.03.07"},
+		{template: "release/{date}", sequence: 3, expected: "release/2026.03.07-3"},
+		{template: "release/{date}-{sequence}", sequence: 2, expected: "release/2026.03.07-2"},
+		{template: "release/{version}", sequence: 1, expected: "release/1.2.0"},
+		{template: "release/{user}/{time}", sequence: 1, expected: "release/u123/09.05"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.template, func(t *testing.T) {
+			if name := newReleaseBranchName(c.template, now, c.sequence, "U123", "1.2.0"); name != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, name)
+			}
+		})
+	}
+}
+
+func TestReleaseBranchRegex(t *testing.T) {
+	cases := []struct {
+		template string
+		branch   string
+		expected bool
+	}{
+		{template: "release/{date}", branch: "release/2026.03.07", expected: true},
+		{template: "release/{date}", branch: "release/2026.03.07-2", expected: true},
+		{template: "release/{date}", branch: "release/new-login", expected: false},
+		{template: "release/{date}", branch: "release/2026.03.07/extra", expected: false},
+		{template: "release/{date}", branch: "feature/release/2026.03.07", expected: false},
+		{template: "release/{date}-{sequence}", branch: "release/2026.03.07-12", expected: true},
+		{template: "release/{date}-{sequence}", branch: "release/2026.03.07", expected: false},
+		{template: "release/{version}", branch: "release/1.10.0", expected: true},
+		{template: "release/{version}", branch: "release/", expected: false},
+		{template: "rc.{user}.{time}", branch: "rc.john.doe.09.05", expected: true},
+		{template: "rc.{user}.{time}", branch: "rcx09.05", expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.template+" "+c.branch, func(t *testing.T) {
+			if actual := releaseBranchRegex(c.template).MatchString(c.branch); actual != c.expected {
+				t.Errorf("expected %t, got %t", c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"regexp"
+	"strings"
+)
+
+const (
+	//PullRequestTypeFeature the pull-request adds new functionality
+	PullRequestTypeFeature = "feature"
+
+	//PullRequestTypeFix the pull-request fixes the bug
+	PullRequestTypeFix = "fix"
+
+	//PullRequestTypeChore the pull-request doesn't change the functionality
+	PullRequestTypeChore = "chore"
+
+	issueKeyRegex = `\b[A-Z][A-Z0-9]+-\d+\b`
+
+	//conventionalTypes the types of the conventional commits title prefix
+	conventionalTypes = `feat|feature|fix|bugfix|hotfix|chore|docs|refactor|perf|test|ci|build|style|revert`
+)
+
+var (
+	//conventionalTitleRegex matches the conventional commits title prefix, e.g. `feat(api)!: new endpoint`
+	conventionalTitleRegex = regexp.MustCompile(`(?i)^(` + conventionalTypes + `)(\([^)]*\))?(!)?:\s+`)
+
+	//bracketTitleRegex matches the title prefix in brackets, e.g. `[fix] wrong response` or `[feat(api)!]: new endpoint`
+	bracketTitleRegex = regexp.MustCompile(`(?i)^\[(` + conventionalTypes + `)(\([^)]*\))?(!)?\]:?\s*`)
+
+	//preparedTitleRegex matches the prefix, which is added to the title of the pull-request prepared for the release
+	preparedTitleRegex = regexp.MustCompile(`^\s*\[PREPARED-FOR-RELEASE\]\s*`)
+
+	branchTypeRegex     = regexp.MustCompile(`(?i)^(feat|feature|fix|bugfix|hotfix)/`)
+	breakingChangeRegex = regexp.MustCompile(`BREAKING[ -]CHANGE`)
+
+	releaseNotesSections = []struct {
+		Type  string
+		Title string
+	}{
+		{Type: PullRequestTypeFeature, Title: "Features"},
+		{Type: PullRequestTypeFix, Title: "Fixes"},
+		{Type: PullRequestTypeChore, Title: "Chores"},
+	}
+)
+
+// conventionalTitle the parsed prefix of the pull-request title
+type conventionalTitle struct {
+	//Type the lower case type of the prefix, e.g. `feat`
+	Type string
+
+	//Breaking true when the prefix is marked by `!`
+	Breaking bool
+
+	//Subject the title without the prefix
+	Subject string
+}
+
+// parseConventionalTitle parses the conventional commits prefix or the prefix in brackets of the title. Returns false when the title has no prefix
+func parseConventionalTitle(title string) (conventionalTitle, bool) {
+	title = preparedTitleRegex.ReplaceAllString(strings.TrimSpace(title), "")
+
+	for _, regex := range []*regexp.Regexp{conventionalTitleRegex, bracketTitleRegex} {
+		matches := regex.FindStringSubmatch(title)
+		if len(matches) == 0 {
+			continue
+		}
+
+		return conventionalTitle{
+			Type:     strings.ToLower(matches[1]),
+			Breaking: matches[3] != "",
+			Subject:  strings.TrimSpace(title[len(matches[0]):]),
+		}, true
+	}
+
+	return conventionalTitle{Subject: title}, false
+}
+
+// PullRequestType returns the type of the pull-request, which is defined by the conventional commits prefix of the title or by the source branch name
+func PullRequestType(pullRequest bitbucketrelease_dto.PullRequest) string {
+	prefix := ""
+	if title, ok := parseConventionalTitle(pullRequest.Title); ok {
+		prefix = title.Type
+	} else if matches := branchTypeRegex.FindStringSubmatch(pullRequest.BranchName); len(matches) > 1 {
+		prefix = strings.ToLower(matches[1])
+	}
+
+	switch prefix {
+	case "feat", "feature":
+		return PullRequestTypeFeature
+	case "fix", "bugfix", "hotfix":
+		return PullRequestTypeFix
+	default:
+		return PullRequestTypeChore
+	}
+}
+
+// IsBreakingChange returns true when the pull-request is marked as breaking change by `!` in the title prefix or by `BREAKING CHANGE` in the description
+func IsBreakingChange(pullRequest bitbucketrelease_dto.PullRequest) bool {
+	if title, ok := parseConventionalTitle(pullRequest.Title); ok && title.Breaking {
+		return true
+	}
+
+	return breakingChangeRegex.MatchString(pullRequest.Description)
+}
+
+// IssueKeys returns the issue keys, e.g. `PROJ-123`, found in the title, branch name and description of the pull-request
+func IssueKeys(pullRequest bitbucketrelease_dto.PullRequest) []string {
+	var (
+		keys  []string
+		found = map[string]bool{}
+	)
+
+	for _, key := range regexp.MustCompile(issueKeyRegex).FindAllString(strings.Join([]string{pullRequest.Title, pullRequest.BranchName, pullRequest.Description}, "\n"), -1) {
+		if found[key] {
+			continue
+		}
+
+		found[key] = true
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// ReleaseNotes returns the release notes in Markdown for the pull-requests of the repository, grouped by the pull-request type. Inside of the group the pull-requests keep the received order
+func ReleaseNotes(repository string, pullRequests []bitbucketrelease_dto.PullRequest) string {
+	var (
+		text   = fmt.Sprintf("## Release notes of `%s`\n", repository)
+		byType = map[string][]bitbucketrelease_dto.PullRequest{}
+	)
+
+	for _, pullRequest := range pullRequests {
+		pullRequestType := PullRequestType(pullRequest)
+		byType[pullRequestType] = append(byType[pullRequestType], pullRequest)
+	}
+
+	for _, section := range releaseNotesSections {
+		if len(byType[section.Type]) == 0 {
+			continue
+		}
+
+		text += fmt.Sprintf("\n### %s\n", section.Title)
+		for _, pullRequest := range byType[section.Type] {
+			text += releaseNoteLine(pullRequest)
+		}
+	}
+
+	return text
+}
+
+func releaseNoteLine(pullRequest bitbucketrelease_dto.PullRequest) string {
+	title := ""
+	if conventional, ok := parseConventionalTitle(pullRequest.Title); ok {
+		title = conventional.Subject
+	}
+
+	if title == "" {
+		title = pullRequest.Title
+	}
+
+	line := fmt.Sprintf("- %s ([#%d](%s))", title, pullRequest.ID, pullRequest.URL())
+	if pullRequest.Author != "" {
+		line += fmt.Sprintf(" by %s", pullRequest.Author)
+	}
+
+	if keys := IssueKeys(pullRequest); len(keys) > 0 {
+		line += fmt.Sprintf(" - %s", strings.Join(keys, ", "))
+	}
+
+	if IsBreakingChange(pullRequest) {
+		line += " **BREAKING CHANGE**"
+	}
+
+	return line + "\n"
+}
+
+// releaseNotesPullRequests returns the pull-requests described in the release notes of the release pull-request. Only the type and breaking change mark of the pull-requests are restored
+func releaseNotesPullRequests(releaseNotes string) []bitbucketrelease_dto.PullRequest {
+	var (
+		pullRequests []bitbucketrelease_dto.PullRequest
+		sectionType  = ""
+	)
+
+	for _, line := range strings.Split(releaseNotes, "\n") {
+		line = strings.TrimSpace(line)
+		for _, section := range releaseNotesSections {
+			if line == fmt.Sprintf("### %s", section.Title) {
+				sectionType = section.Type
+			}
+		}
+
+		if sectionType == "" || !strings.HasPrefix(line, "- ") {
+			continue
+		}
+
+		pullRequest := bitbucketrelease_dto.PullRequest{
+			Title: fmt.Sprintf("%s: %s", sectionType, strings.TrimPrefix(line, "- ")),
+		}
+
+		if strings.Contains(line, "**BREAKING CHANGE**") {
+			pullRequest.Description = "BREAKING CHANGE"
+		}
+
+		pullRequests = append(pullRequests, pullRequest)
+	}
+
+	if len(pullRequests) == 0 {
+		return []bitbucketrelease_dto.PullRequest{{Title: releaseNotes}}
+	}
+
+	return pullRequests
+}
@@ -0,0 +1,112 @@
+package bitbucket_release_services
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func TestParseConventionalTitle(t *testing.T) {
+	cases := []struct {
+		title    string
+		ok       bool
+		prefix   string
+		breaking bool
+		subject  string
+	}{
+		{title: "feat: new endpoint", ok: true, prefix: "feat", subject: "new endpoint"},
+		{title: "feat(api)!: new endpoint", ok: true, prefix: "feat", breaking: true, subject: "new endpoint"},
+		{title: "Fix(ui): wrong colour", ok: true, prefix: "fix", subject: "wrong colour"},
+		{title: "perf: faster search", ok: true, prefix: "perf", subject: "faster search"},
+		{title: "[PREPARED-FOR-RELEASE] chore: bump dependencies", ok: true, prefix: "chore", subject: "bump dependencies"},
+		{title: "[fix] wrong response", ok: true, prefix: "fix", subject: "wrong response"},
+		{title: "[feat(api)!]: new endpoint", ok: true, prefix: "feat", breaking: true, subject: "new endpoint"},
+		{title: "fixture: new test data", ok: false},
+		{title: "Feature flags cleanup", ok: false},
+		{title: "fix:no space after the colon", ok: false},
+		{title: "fix the login page", ok: false},
+		{title: "Update README", ok: false},
+		{title: "[WIP] feat: new endpoint", ok: false},
+		{title: "", ok: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			title, ok := parseConventionalTitle(c.title)
+			if ok != c.ok {
+				t.Fatalf("expected the prefix to be found: %t, got %t", c.ok, ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if title.Type != c.prefix || title.Breaking != c.breaking || title.Subject != c.subject {
+				t.Errorf("expected %s (breaking: %t) %q, got %+v", c.prefix, c.breaking, c.subject, title)
+			}
+		})
+	}
+}
+
+func TestPullRequestType(t *testing.T) {
+	cases := []struct {
+		title    string
+		branch   string
+		expected string
+	}{
+		{title: "feat: new endpoint", expected: PullRequestTypeFeature},
+		{title: "[hotfix] wrong response", expected: PullRequestTypeFix},
+		{title: "docs: readme", expected: PullRequestTypeChore},
+		{title: "fixture: new test data", expected: PullRequestTypeChore},
+		{title: "Feature flags cleanup", expected: PullRequestTypeChore},
+		{title: "New endpoint", branch: "feature/new-endpoint", expected: PullRequestTypeFeature},
+		{title: "chore: cleanup", branch: "feature/cleanup", expected: PullRequestTypeChore},
+	}
+
+	for _, c := range cases {
+		t.Run(c.title, func(t *testing.T) {
+			if actual := PullRequestType(bitbucketrelease_dto.PullRequest{Title: c.title, BranchName: c.branch}); actual != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestIsBreakingChange(t *testing.T) {
+	cases := []struct {
+		pullRequest bitbucketrelease_dto.PullRequest
+		expected    bool
+	}{
+		{pullRequest: bitbucketrelease_dto.PullRequest{Title: "feat!: drop v1"}, expected: true},
+		{pullRequest: bitbucketrelease_dto.PullRequest{Title: "[fix!] drop v1"}, expected: true},
+		{pullRequest: bitbucketrelease_dto.PullRequest{Title: "feat: drop v1", Description: "BREAKING CHANGE: v1 is removed"}, expected: true},
+		{pullRequest: bitbucketrelease_dto.PullRequest{Title: "Wow! Big change: drop v1"}, expected: false},
+		{pullRequest: bitbucketrelease_dto.PullRequest{Title: "feat: drop v1"}, expected: false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.pullRequest.Title, func(t *testing.T) {
+			if actual := IsBreakingChange(c.pullRequest); actual != c.expected {
+				t.Errorf("expected %t, got %t", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestReleaseNotes(t *testing.T) {
+	notes := ReleaseNotes("my-repository", []bitbucketrelease_dto.PullRequest{
+		{ID: 1, Workspace: "my-workspace", RepositorySlug: "my-repository", Title: "fix: wrong response PROJ-1"},
+		{ID: 2, Workspace: "my-workspace", RepositorySlug: "my-repository", Title: "feat(api)!: new endpoint"},
+		{ID: 3, Workspace: "my-workspace", RepositorySlug: "my-repository", Title: "Update README"},
+	})
+
+	for _, expected := range []string{"### Features\n- new endpoint", "**BREAKING CHANGE**", "### Fixes\n- wrong response PROJ-1", "- PROJ-1", "### Chores\n- Update README"} {
+		if !strings.Contains(notes, expected) {
+			t.Errorf("expected the release notes to contain %q, got:\n%s", expected, notes)
+		}
+	}
+
+	if strings.Index(notes, "### Features") > strings.Index(notes, "### Fixes") {
+		t.Errorf("expected the features before the fixes, got:\n%s", notes)
+	}
+}
@@ -0,0 +1,165 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"time"
+)
+
+const (
+	releaseWindowTimeFormat = "15:04"
+)
+
+// CheckReleaseWindow checks if the release is allowed at the selected time. The returned error explains why the release is not allowed
+func CheckReleaseWindow(now time.Time) error {
+	return checkReleaseWindow(currentConfig().ReleaseWindows, now)
+}
+
+func checkReleaseWindow(windows bitbucketrelease_dto.ReleaseWindows, now time.Time) error {
+	location := time.UTC
+	if windows.Timezone != "" {
+		tz, err := time.LoadLocation(windows.Timezone)
+		if err != nil {
+			return errors.Wrap(err, "Failed to load the release windows timezone")
+		}
+
+		location = tz
+	}
+
+	now = now.In(location)
+
+	freezes := windows.Freezes
+	if windows.ICalendarFile != "" {
+		icalFreezes, err := readICalendarFreezes(windows.ICalendarFile, location)
+		if err != nil {
+			return err
+		}
+
+		freezes = append(freezes, icalFreezes...)
+	}
+
+	for _, freeze := range freezes {
+		if !now.Before(freeze.From) && now.Before(freeze.To) {
+			return fmt.Errorf("The release is frozen till %s. Reason: %s", freeze.To.In(location).Format("2006-01-02 15:04 MST"), freeze.Reason)
+		}
+	}
+
+	if len(windows.Windows) == 0 {
+		return nil
+	}
+
+	for _, window := range windows.Windows {
+		allowed, err := isInReleaseWindow(window, now)
+		if err != nil {
+			return err
+		}
+
+		if allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("The release is not allowed on %s at %s. Allowed release windows: %s", now.Weekday(), now.Format("15:04 MST"), releaseWindowsText(windows.Windows))
+}
+
+// isInReleaseWindow returns true when the time is in the window. The window, which ends before it starts, e.g. 22:00-02:00, crosses midnight:
+// it starts on its weekday and ends on the next day
+func isInReleaseWindow(window bitbucketrelease_dto.ReleaseWindow, now time.Time) (bool, error) {
+	from, to, err := releaseWindowMinutes(window)
+	if err != nil {
+		return false, err
+	}
+
+	minutes := now.Hour()*60 + now.Minute()
+	if from < to {
+		return hasWeekday(window, now.Weekday()) && minutes >= from && minutes < to, nil
+	}
+
+	if minutes >= from {
+		return hasWeekday(window, now.Weekday()), nil
+	}
+
+	return minutes < to && hasWeekday(window, (now.Weekday()+6)%7), nil
+}
+
+// releaseWindowMinutes returns the start and the end of the window in minutes since midnight
+func releaseWindowMinutes(window bitbucketrelease_dto.ReleaseWindow) (int, int, error) {
+	from, err := time.Parse(releaseWindowTimeFormat, window.From)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to parse the start time of the release window")
+	}
+
+	to, err := time.Parse(releaseWindowTimeFormat, window.To)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "Failed to parse the end time of the release window")
+	}
+
+	return from.Hour()*60 + from.Minute(), to.Hour()*60 + to.Minute(), nil
+}
+
+// hasWeekday returns true when the window is defined for the weekday. The window without weekdays is defined for every day
+func hasWeekday(window bitbucketrelease_dto.ReleaseWindow, weekday time.Weekday) bool {
+	if len(window.Weekdays) == 0 {
+		return true
+	}
+
+	for _, item := range window.Weekdays {
+		if strings.EqualFold(item, weekday.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateReleaseWindows checks the timezone and the windows of the configuration
+func validateReleaseWindows(windows bitbucketrelease_dto.ReleaseWindows) error {
+	if _, err := time.LoadLocation(windows.Timezone); err != nil {
+		return errors.Wrap(err, "Failed to load the release windows timezone")
+	}
+
+	for _, window := range windows.Windows {
+		from, to, err := releaseWindowMinutes(window)
+		if err != nil {
+			return err
+		}
+
+		if from == to {
+			return fmt.Errorf("The release window %s-%s is empty. Please use different start and end time.", window.From, window.To)
+		}
+
+		for _, weekday := range window.Weekdays {
+			if !isWeekday(weekday) {
+				return fmt.Errorf("The weekday `%s` of the release window is unknown.", weekday)
+			}
+		}
+	}
+
+	return nil
+}
+
+func isWeekday(name string) bool {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(name, weekday.String()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func releaseWindowsText(windows []bitbucketrelease_dto.ReleaseWindow) string {
+	var result []string
+	for _, window := range windows {
+		weekdays := "every day"
+		if len(window.Weekdays) > 0 {
+			weekdays = strings.Join(window.Weekdays, ", ")
+		}
+
+		result = append(result, fmt.Sprintf("%s %s-%s", weekdays, window.From, window.To))
+	}
+
+	return strings.Join(result, "; ")
+}
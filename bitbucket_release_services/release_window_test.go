@@ -0,0 +1,220 @@
+package bitbucket_release_services
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckReleaseWindow(t *testing.T) {
+	var (
+		workingHours = bitbucketrelease_dto.ReleaseWindow{Weekdays: []string{"monday", "tuesday"}, From: "09:00", To: "16:00"}
+		night        = bitbucketrelease_dto.ReleaseWindow{Weekdays: []string{"friday"}, From: "22:00", To: "02:00"}
+		holidays     = bitbucketrelease_dto.FreezePeriod{
+			From:   time.Date(2026, 12, 20, 0, 0, 0, 0, time.UTC),
+			To:     time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC),
+			Reason: "Holidays",
+		}
+	)
+
+	cases := []struct {
+		name    string
+		windows bitbucketrelease_dto.ReleaseWindows
+		now     time.Time
+		err     string
+	}{
+		{
+			name: "no windows",
+			now:  time.Date(2026, 10, 18, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "inside the window",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}},
+			now:     time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "at the end of the window",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}},
+			now:     time.Date(2026, 10, 19, 16, 0, 0, 0, time.UTC),
+			err:     "not allowed on Monday at 16:00",
+		},
+		{
+			name:    "other weekday",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}},
+			now:     time.Date(2026, 10, 21, 10, 0, 0, 0, time.UTC),
+			err:     "not allowed on Wednesday",
+		},
+		{
+			name:    "window in the timezone",
+			windows: bitbucketrelease_dto.ReleaseWindows{Timezone: "Europe/Berlin", Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}},
+			now:     time.Date(2026, 10, 19, 14, 30, 0, 0, time.UTC),
+			err:     "not allowed on Monday at 16:30 CEST",
+		},
+		{
+			name:    "weekday in the timezone",
+			windows: bitbucketrelease_dto.ReleaseWindows{Timezone: "America/Los_Angeles", Windows: []bitbucketrelease_dto.ReleaseWindow{night}},
+			now:     time.Date(2026, 10, 24, 6, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "other weekday in the timezone",
+			windows: bitbucketrelease_dto.ReleaseWindows{Timezone: "Asia/Tokyo", Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}},
+			now:     time.Date(2026, 10, 20, 23, 30, 0, 0, time.UTC),
+			err:     "not allowed on Wednesday at 08:30 JST",
+		},
+		{
+			name:    "window crossing midnight before midnight",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{night}},
+			now:     time.Date(2026, 10, 23, 23, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "window crossing midnight after midnight",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{night}},
+			now:     time.Date(2026, 10, 24, 1, 59, 0, 0, time.UTC),
+		},
+		{
+			name:    "window crossing midnight after its end",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{night}},
+			now:     time.Date(2026, 10, 24, 2, 0, 0, 0, time.UTC),
+			err:     "not allowed on Saturday",
+		},
+		{
+			name:    "window crossing midnight after midnight of other weekday",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{night}},
+			now:     time.Date(2026, 10, 23, 1, 0, 0, 0, time.UTC),
+			err:     "not allowed on Friday",
+		},
+		{
+			name:    "freeze period inside the window",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{workingHours}, Freezes: []bitbucketrelease_dto.FreezePeriod{holidays}},
+			now:     time.Date(2026, 12, 21, 10, 0, 0, 0, time.UTC),
+			err:     "frozen till 2027-01-04 00:00 UTC. Reason: Holidays",
+		},
+		{
+			name:    "wrong time of the window",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{{From: "9am", To: "16:00"}}},
+			now:     time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC),
+			err:     "Failed to parse the start time",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := checkReleaseWindow(c.windows, c.now)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestValidateReleaseWindows(t *testing.T) {
+	cases := []struct {
+		name    string
+		windows bitbucketrelease_dto.ReleaseWindows
+		err     string
+	}{
+		{
+			name:    "valid windows",
+			windows: bitbucketrelease_dto.ReleaseWindows{Timezone: "Europe/Berlin", Windows: []bitbucketrelease_dto.ReleaseWindow{{Weekdays: []string{"Monday"}, From: "22:00", To: "02:00"}}},
+		},
+		{
+			name:    "unknown timezone",
+			windows: bitbucketrelease_dto.ReleaseWindows{Timezone: "Mars/Olympus"},
+			err:     "Failed to load the release windows timezone",
+		},
+		{
+			name:    "empty window",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{{From: "10:00", To: "10:00"}}},
+			err:     "is empty",
+		},
+		{
+			name:    "unknown weekday",
+			windows: bitbucketrelease_dto.ReleaseWindows{Windows: []bitbucketrelease_dto.ReleaseWindow{{Weekdays: []string{"mon"}, From: "10:00", To: "12:00"}}},
+			err:     "The weekday `mon` of the release window is unknown",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := validateReleaseWindows(c.windows)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestParseICalendarFreezes(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calendar := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"DTSTART:20261220T080000Z",
+		"DTEND:20261220T100000Z",
+		"SUMMARY:Maintenance of the",
+		"  database",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20261224",
+		"SUMMARY:Christmas",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;TZID=America/New_York:20261231T180000",
+		"DTEND;TZID=America/New_York:20261231T200000",
+		"SUMMARY:New year",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	freezes, err := parseICalendarFreezes(strings.NewReader(calendar), berlin)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	expected := []bitbucketrelease_dto.FreezePeriod{
+		{From: time.Date(2026, 12, 20, 8, 0, 0, 0, time.UTC), To: time.Date(2026, 12, 20, 10, 0, 0, 0, time.UTC), Reason: "Maintenance of the database"},
+		{From: time.Date(2026, 12, 24, 0, 0, 0, 0, berlin), To: time.Date(2026, 12, 25, 0, 0, 0, 0, berlin), Reason: "Christmas"},
+		{From: time.Date(2026, 12, 31, 23, 0, 0, 0, time.UTC), To: time.Date(2027, 1, 1, 1, 0, 0, 0, time.UTC), Reason: "New year"},
+	}
+
+	if len(freezes) != len(expected) {
+		t.Fatalf("expected %d freezes, got %+v", len(expected), freezes)
+	}
+
+	for i, freeze := range freezes {
+		if !freeze.From.Equal(expected[i].From) || !freeze.To.Equal(expected[i].To) || freeze.Reason != expected[i].Reason {
+			t.Errorf("expected the freeze %+v, got %+v", expected[i], freeze)
+		}
+	}
+}
+
+func TestCheckReleaseWindowWithICalendarFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "freezes.ics")
+	if err := os.WriteFile(path, []byte("BEGIN:VEVENT\nDTSTART;VALUE=DATE:20261224\nSUMMARY:Christmas\nEND:VEVENT\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	windows := bitbucketrelease_dto.ReleaseWindows{Timezone: "Europe/Berlin", ICalendarFile: path}
+	if err := checkReleaseWindow(windows, time.Date(2026, 12, 24, 12, 0, 0, 0, time.UTC)); err == nil || !strings.Contains(err.Error(), "Christmas") {
+		t.Errorf("expected the release to be frozen by the iCalendar event, got %v", err)
+	}
+
+	if err := checkReleaseWindow(windows, time.Date(2026, 12, 24, 23, 30, 0, 0, time.UTC)); err != nil {
+		t.Errorf("expected the release after the all-day event in the timezone, got %s", err)
+	}
+}
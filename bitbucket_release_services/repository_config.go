@@ -0,0 +1,325 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"github.com/sharovik/devbot/internal/container"
+	"github.com/sharovik/devbot/internal/log"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//configFileEnv the environment variable with the path to the release configuration json or yaml file
+	configFileEnv = "BITBUCKET_RELEASE_CONFIG_FILE"
+
+	//defaultReleasePullRequestTitle the title of the release pull-request, which is used when there is no title template in the configuration
+	defaultReleasePullRequestTitle = "Release pull-request"
+
+	//defaultCheckTimeout the time, during which the pull-request should be checked, when there is no timeout in the configuration
+	defaultCheckTimeout = 30 * time.Second
+
+	//configCheckInterval the minimal time between two checks of the release configuration file modification time
+	configCheckInterval = 5 * time.Second
+)
+
+var (
+	releaseConfig        *bitbucketrelease_dto.Config
+	releaseConfigModTime time.Time
+	releaseConfigMutex   sync.Mutex
+
+	//releaseConfigCheckedAt the time of the last check of the release configuration file. The file is checked once per configCheckInterval, not on every configuration read
+	releaseConfigCheckedAt time.Time
+
+	//releaseStrategies the merge strategies, which can be selected by their names
+	releaseStrategies = map[string]string{
+		"merge":  client.StrategyMerge,
+		"squash": client.StrategySquash,
+	}
+)
+
+// ReleaseStrategy returns the merge strategy by its name: `merge` or `squash`
+func ReleaseStrategy(name string) (string, bool) {
+	strategy, ok := releaseStrategies[strings.ToLower(name)]
+	return strategy, ok
+}
+
+// LoadConfig loads the release configuration from the file defined in BITBUCKET_RELEASE_CONFIG_FILE environment variable
+func LoadConfig() error {
+	releaseConfigMutex.Lock()
+	defer releaseConfigMutex.Unlock()
+
+	return loadConfig()
+}
+
+// loadConfig loads the release configuration. The caller should hold releaseConfigMutex
+func loadConfig() error {
+	path := os.Getenv(configFileEnv)
+	if path == "" {
+		releaseConfig = &bitbucketrelease_dto.Config{}
+		return nil
+	}
+
+	releaseConfigCheckedAt = time.Now()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return errors.Wrap(err, "Failed to read the release configuration file")
+	}
+
+	//We remember the modification time even for the broken file, so it is not reloaded till the next change
+	releaseConfigModTime = info.ModTime()
+
+	config, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	releaseConfig = &config
+	return nil
+}
+
+func readConfig(path string) (bitbucketrelease_dto.Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return bitbucketrelease_dto.Config{}, errors.Wrap(err, "Failed to read the release configuration file")
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if content, err = yamlToJSON(content); err != nil {
+			return bitbucketrelease_dto.Config{}, errors.Wrap(err, "Failed to parse the release configuration file")
+		}
+	}
+
+	var config bitbucketrelease_dto.Config
+	if err = json.Unmarshal(content, &config); err != nil {
+		return bitbucketrelease_dto.Config{}, errors.Wrap(err, "Failed to parse the release configuration file")
+	}
+
+	if err = validateConfig(&config); err != nil {
+		return bitbucketrelease_dto.Config{}, err
+	}
+
+	return config, nil
+}
+
+// yamlToJSON converts the yaml document into json, so the same field names are used for both formats
+func yamlToJSON(content []byte) ([]byte, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(document)
+}
+
+func validateConfig(config *bitbucketrelease_dto.Config) error {
+	if err := validateRepositoryConfig("default", config.Default); err != nil {
+		return err
+	}
+
+	for key, repositoryConfig := range config.Repositories {
+		if err := validateRepositoryConfig(key, repositoryConfig); err != nil {
+			return err
+		}
+	}
+
+	if err := validateReleaseWindows(config.ReleaseWindows); err != nil {
+		return err
+	}
+
+	return prepareServers(config.Servers)
+}
+
+func validateRepositoryConfig(key string, config bitbucketrelease_dto.RepositoryConfig) error {
+	if _, ok := ReleaseStrategy(config.Strategy); config.Strategy != "" && !ok {
+		return fmt.Errorf("The strategy `%s` of `%s` configuration is not supported. Please use `merge` or `squash`.", config.Strategy, key)
+	}
+
+	return validateVersioningPolicy(key, config.Versioning)
+}
+
+// configChanged returns true when the release configuration file was changed after the last load. The file is not checked more often than configCheckInterval
+func configChanged() bool {
+	path := os.Getenv(configFileEnv)
+	if path == "" || time.Since(releaseConfigCheckedAt) < configCheckInterval {
+		return false
+	}
+
+	releaseConfigCheckedAt = time.Now()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return !info.ModTime().Equal(releaseConfigModTime)
+}
+
+// currentConfig returns the release configuration. The file is reloaded, when it was changed since the last load
+func currentConfig() bitbucketrelease_dto.Config {
+	releaseConfigMutex.Lock()
+	defer releaseConfigMutex.Unlock()
+
+	if releaseConfig == nil || configChanged() {
+		if err := loadConfig(); err != nil {
+			log.Logger().AddError(err).Msg("Failed to load the release configuration. The previous configuration will be used.")
+			if releaseConfig == nil {
+				releaseConfig = &bitbucketrelease_dto.Config{}
+			}
+		}
+	}
+
+	return *releaseConfig
+}
+
+// Config returns the release configuration. The file is reloaded, when it was changed since the last load
+func Config() bitbucketrelease_dto.Config {
+	return currentConfig()
+}
+
+// CheckTimeout returns the time, during which the pull-request and the branches of the release should be checked: the `checks.timeout` of the configuration or defaultCheckTimeout
+func CheckTimeout() time.Duration {
+	return durationOrDefault(currentConfig().Checks.Timeout, time.Second, defaultCheckTimeout)
+}
+
+// RepositoryConfigFor returns the configuration of the selected repository merged with the default configuration
+func RepositoryConfigFor(host string, workspace string, repository string) bitbucketrelease_dto.RepositoryConfig {
+	config := currentConfig()
+	for _, key := range repositoryKeys(host, workspace, repository) {
+		if repositoryConfig, ok := config.Repositories[key]; ok {
+			return mergeRepositoryConfig(config.Default, repositoryConfig)
+		}
+	}
+
+	return config.Default
+}
+
+// mergeRepositoryConfig returns the repository configuration, where the empty values are taken from the default configuration
+func mergeRepositoryConfig(defaults bitbucketrelease_dto.RepositoryConfig, config bitbucketrelease_dto.RepositoryConfig) bitbucketrelease_dto.RepositoryConfig {
+	if config.MainBranch == "" {
+		config.MainBranch = defaults.MainBranch
+	}
+
+	if config.Strategy == "" {
+		config.Strategy = defaults.Strategy
+	}
+
+	if config.ReleaseBranchTemplate == "" {
+		config.ReleaseBranchTemplate = defaults.ReleaseBranchTemplate
+	}
+
+	if config.ReleasePullRequestTitle == "" {
+		config.ReleasePullRequestTitle = defaults.ReleasePullRequestTitle
+	}
+
+	if len(config.Reviewers) == 0 {
+		config.Reviewers = defaults.Reviewers
+	}
+
+	if config.Approval == nil {
+		config.Approval = defaults.Approval
+	}
+
+	if config.BuildStatuses == nil {
+		config.BuildStatuses = defaults.BuildStatuses
+	}
+
+	if config.Versioning == nil {
+		config.Versioning = defaults.Versioning
+	}
+
+	if config.ReleaseBranches == nil {
+		config.ReleaseBranches = defaults.ReleaseBranches
+	}
+
+	return config
+}
+
+// MainBranch returns the main branch of the repository: the `main_branch` of the configuration or the main branch of the VCS provider repository
+func MainBranch(ctx context.Context, host string, workspace string, repository string) (string, error) {
+	if mainBranch := RepositoryConfigFor(host, workspace, repository).MainBranch; mainBranch != "" {
+		return mainBranch, nil
+	}
+
+	return ProviderFor(host).MainBranch(ctx, workspace, repository)
+}
+
+// UsesReleaseBranch returns true when the pull-requests of the repository are released through the release branch and the release pull-request
+func UsesReleaseBranch(host string, workspace string, repository string) bool {
+	config := RepositoryConfigFor(host, workspace, repository)
+	return config.ReleaseBranches == nil || *config.ReleaseBranches
+}
+
+// releaseStrategy returns the merge strategy of the release. The strategy of the command has the priority, then the strategy of the repository configuration. The squash strategy is used by default
+func releaseStrategy(options bitbucketrelease_dto.ReleaseOptions, config bitbucketrelease_dto.RepositoryConfig) string {
+	if options.Strategy != "" {
+		return options.Strategy
+	}
+
+	if strategy, ok := ReleaseStrategy(config.Strategy); ok {
+		return strategy
+	}
+
+	return client.StrategySquash
+}
+
+// releaseTarget returns the branch, from which the release branch is created and into which the release pull-request is opened. It is empty for the main branch of the repository
+func releaseTarget(options bitbucketrelease_dto.ReleaseOptions, config bitbucketrelease_dto.RepositoryConfig) string {
+	if options.Target != "" {
+		return options.Target
+	}
+
+	return config.MainBranch
+}
+
+// releasePullRequestTitle returns the title of the release pull-request from the template. Available variables: {branch}, {repository}, {date}
+func releasePullRequestTitle(config bitbucketrelease_dto.RepositoryConfig, repository string, releaseBranch string) string {
+	if config.ReleasePullRequestTitle == "" {
+		return defaultReleasePullRequestTitle
+	}
+
+	return strings.NewReplacer(
+		"{branch}", releaseBranch,
+		"{repository}", repository,
+		"{date}", time.Now().Format("2006.01.02"),
+	).Replace(config.ReleasePullRequestTitle)
+}
+
+// releaseReviewers returns the reviewers of the release pull-request. The reviewers of the repository configuration have the priority.
+// Otherwise the required reviewers of bitbucket.org or the reviewers of the host configuration are used
+func releaseReviewers(host string, config bitbucketrelease_dto.RepositoryConfig) []string {
+	if len(config.Reviewers) > 0 {
+		return config.Reviewers
+	}
+
+	if !IsBitBucketCloud(host) {
+		providerHost, _ := ProviderHostFor(host)
+		return providerHost.Reviewers
+	}
+
+	//The author of the release pull-request is the current user, so we don't add it to the reviewers
+	var reviewers []string
+	for _, reviewer := range container.C.Config.BitBucketConfig.RequiredReviewers {
+		if reviewer.UUID != container.C.Config.BitBucketConfig.CurrentUserUUID {
+			reviewers = append(reviewers, reviewer.UUID)
+		}
+	}
+
+	return reviewers
+}
+
+// RepositoryReviewers returns the reviewers of the pull-requests, which the bot opens in the repository
+func RepositoryReviewers(host string, workspace string, repository string) []string {
+	return releaseReviewers(host, RepositoryConfigFor(host, workspace, repository))
+}
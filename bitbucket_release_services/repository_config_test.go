@@ -0,0 +1,187 @@
+package bitbucket_release_services
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testYAMLConfig = `
+default:
+  strategy: squash
+  reviewers: ["{default-reviewer}"]
+  approval:
+    min_approvals: 2
+repositories:
+  my-workspace/my-repository:
+    main_branch: develop
+    strategy: merge
+    reviewers: ["{repository-reviewer}"]
+  my-small-repository:
+    release_branches: false
+  git.example.com/my-workspace/my-repository:
+    main_branch: main
+servers:
+  - host: git.example.com
+all_or_nothing: true
+retry:
+  attempts: 7
+auto_merge:
+  enabled: true
+`
+
+func TestLoadConfigFromYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.yaml")
+	if err := ioutil.WriteFile(path, []byte(testYAMLConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+	t.Setenv(configFileEnv, path)
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("expected the configuration to be loaded, got %s", err)
+	}
+
+	config := Config()
+	if !config.AllOrNothing || !config.AutoMerge.Enabled || config.Retry.Attempts != 7 {
+		t.Errorf("expected the global settings to be loaded, got %+v", config)
+	}
+
+	repository := RepositoryConfigFor("", "my-workspace", "my-repository")
+	if repository.MainBranch != "develop" || repository.Strategy != "merge" {
+		t.Errorf("expected the repository values, got %+v", repository)
+	}
+
+	if server := RepositoryConfigFor("git.example.com", "my-workspace", "my-repository"); server.MainBranch != "main" || server.Strategy != "squash" {
+		t.Errorf("expected the values of the repository of the host, got %+v", server)
+	}
+
+	if len(repository.Reviewers) != 1 || repository.Reviewers[0] != "{repository-reviewer}" {
+		t.Errorf("expected the repository reviewers, got %v", repository.Reviewers)
+	}
+
+	if repository.Approval == nil || repository.Approval.MinApprovals != 2 {
+		t.Errorf("expected the default approval policy, got %+v", repository.Approval)
+	}
+
+	if reviewers := RepositoryReviewers("", "other-workspace", "other-repository"); len(reviewers) != 1 || reviewers[0] != "{default-reviewer}" {
+		t.Errorf("expected the default reviewers, got %v", reviewers)
+	}
+
+	if UsesReleaseBranch("", "my-workspace", "my-small-repository") {
+		t.Error("expected the release branches to be disabled by the repository key without workspace")
+	}
+}
+
+func TestRepositoryConfigForHost(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Repositories: map[string]bitbucketrelease_dto.RepositoryConfig{
+			"my-workspace/api":                 {MainBranch: "develop"},
+			"bitbucket.org/my-workspace/web":   {MainBranch: "production"},
+			"git.example.com/my-workspace/api": {MainBranch: "main"},
+			"web":                              {MainBranch: "master"},
+		},
+		Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com"}, {Host: "github.com", Type: bitbucketrelease_dto.ProviderGitHub}},
+	}
+
+	cases := []struct {
+		host       string
+		workspace  string
+		repository string
+		mainBranch string
+	}{
+		{workspace: "my-workspace", repository: "api", mainBranch: "develop"},
+		{workspace: "my-workspace", repository: "web", mainBranch: "production"},
+		{workspace: "other-workspace", repository: "web", mainBranch: "master"},
+		{host: "git.example.com", workspace: "my-workspace", repository: "api", mainBranch: "main"},
+		{host: "Git.Example.com", workspace: "my-workspace", repository: "api", mainBranch: "main"},
+		{host: "git.example.com", workspace: "my-workspace", repository: "web"},
+		{host: "github.com", workspace: "my-workspace", repository: "api"},
+	}
+
+	for _, c := range cases {
+		if mainBranch := RepositoryConfigFor(c.host, c.workspace, c.repository).MainBranch; mainBranch != c.mainBranch {
+			t.Errorf("expected the main branch %q of %s/%s/%s, got %q", c.mainBranch, c.host, c.workspace, c.repository, mainBranch)
+		}
+	}
+}
+
+func TestCurrentConfigKeepsPreviousConfigWhenFileIsBroken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.json")
+	if err := ioutil.WriteFile(path, []byte(`{"all_or_nothing": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+	t.Setenv(configFileEnv, path)
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("expected the configuration to be loaded, got %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"all_or_nothing": `), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	//The modification time of the file should be changed and the check interval should pass to trigger the reload
+	changed := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	releaseConfigCheckedAt = time.Time{}
+
+	if !Config().AllOrNothing {
+		t.Error("expected the previous configuration to be used, when the changed file is broken")
+	}
+}
+
+func TestCurrentConfigChecksFileOncePerInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.json")
+	if err := ioutil.WriteFile(path, []byte(`{"all_or_nothing": false}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+	t.Setenv(configFileEnv, path)
+
+	if err := LoadConfig(); err != nil {
+		t.Fatalf("expected the configuration to be loaded, got %s", err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(`{"all_or_nothing": true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+
+	if Config().AllOrNothing {
+		t.Error("expected the file not to be checked again before the check interval")
+	}
+
+	releaseConfigCheckedAt = time.Now().Add(-configCheckInterval)
+	if !Config().AllOrNothing {
+		t.Error("expected the changed file to be reloaded after the check interval")
+	}
+}
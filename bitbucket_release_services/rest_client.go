@@ -0,0 +1,54 @@
+package bitbucket_release_services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"net/http"
+)
+
+// restClient the JSON REST API client of VCS provider host
+type restClient struct {
+	baseURL   string
+	headers   map[string]string
+	transport *apiClient
+}
+
+func newRestClient(baseURL string, headers map[string]string) restClient {
+	return restClient{
+		baseURL:   baseURL,
+		headers:   headers,
+		transport: &apiClient{httpClient: &http.Client{Timeout: apiTimeout}},
+	}
+}
+
+// request sends the request to the endpoint and decodes the response into result
+func (c restClient) request(ctx context.Context, method string, endpoint string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	for name, value := range c.headers {
+		request.Header.Set(name, value)
+	}
+
+	return c.transport.do(request, result)
+}
+
+// isNotFound returns true when the provider responded with 404 status code
+func isNotFound(err error) bool {
+	apiErr, ok := errors.Cause(err).(APIError)
+	return ok && apiErr.StatusCode == http.StatusNotFound
+}
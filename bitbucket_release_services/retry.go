@@ -0,0 +1,253 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 4
+	defaultRetryDelay    = 500 * time.Millisecond
+	maxRetryDelay        = 30 * time.Second
+)
+
+// retryContextKey the key of the context value, which disables the retries of the requests
+type retryContextKey struct{}
+
+// retryProvider the provider, which retries the changing requests failed because of the rate limits, server errors or timeouts.
+// The reading requests are retried by the transport, so the changing requests are retried only when their result can be checked before the next attempt
+type retryProvider struct {
+	Provider
+}
+
+// MergePullRequest merges the pull-request. When the attempt failed, but the pull-request was merged, the merge is treated as successful
+func (p retryProvider) MergePullRequest(ctx context.Context, workspace string, repository string, pullRequestID int64, message string, strategy string) (response bitbucketrelease_dto.ProviderPullRequest, err error) {
+	err = withCheckedRetry(ctx, fmt.Sprintf("pull-request #%d merge", pullRequestID), func(ctx context.Context) bool {
+		info, infoErr := p.Provider.PullRequest(ctx, workspace, repository, pullRequestID)
+		if infoErr != nil || info.State != bitbucketrelease_dto.ProviderPullRequestStateMerged {
+			return false
+		}
+
+		response = info
+		return true
+	}, func() error {
+		response, err = p.Provider.MergePullRequest(ctx, workspace, repository, pullRequestID, message, strategy)
+		return err
+	})
+
+	return response, err
+}
+
+// ChangePullRequestDestination changes the destination branch and the title of the pull-request. When the attempt failed, but the pull-request was changed, the change is treated as successful
+func (p retryProvider) ChangePullRequestDestination(ctx context.Context, workspace string, repository string, pullRequestID int64, title string, branchName string) (response bitbucketrelease_dto.ProviderPullRequest, err error) {
+	err = withCheckedRetry(ctx, fmt.Sprintf("pull-request #%d destination change", pullRequestID), func(ctx context.Context) bool {
+		info, infoErr := p.Provider.PullRequest(ctx, workspace, repository, pullRequestID)
+		if infoErr != nil || info.DestinationBranch != branchName || info.Title != title {
+			return false
+		}
+
+		response = info
+		return true
+	}, func() error {
+		response, err = p.Provider.ChangePullRequestDestination(ctx, workspace, repository, pullRequestID, title, branchName)
+		return err
+	})
+
+	return response, err
+}
+
+// CreateBranch creates the branch in the repository. When the attempt failed, but the branch was created, the creation is treated as successful
+func (p retryProvider) CreateBranch(ctx context.Context, workspace string, repository string, branchName string, fromBranch string) (response bitbucketrelease_dto.ProviderBranch, err error) {
+	err = withCheckedRetry(ctx, fmt.Sprintf("branch %s creation", branchName), func(ctx context.Context) bool {
+		exists, existsErr := p.Provider.BranchExists(ctx, workspace, repository, branchName)
+		if existsErr != nil || !exists {
+			return false
+		}
+
+		response = bitbucketrelease_dto.ProviderBranch{Name: branchName}
+		return true
+	}, func() error {
+		response, err = p.Provider.CreateBranch(ctx, workspace, repository, branchName, fromBranch)
+		return err
+	})
+
+	return response, err
+}
+
+// CreatePullRequest creates the pull-request in the repository. When the attempt failed, but the pull-request was opened, the creation is treated as successful
+func (p retryProvider) CreatePullRequest(ctx context.Context, workspace string, repository string, request bitbucketrelease_dto.ProviderPullRequestCreate) (response bitbucketrelease_dto.ProviderPullRequest, err error) {
+	err = withCheckedRetry(ctx, fmt.Sprintf("pull-request creation in %s", repository), func(ctx context.Context) bool {
+		opened, openedErr := p.Provider.OpenPullRequest(ctx, workspace, repository, request.SourceBranch)
+		if openedErr != nil || opened.ID == 0 {
+			return false
+		}
+
+		response = opened
+		return true
+	}, func() error {
+		response, err = p.Provider.CreatePullRequest(ctx, workspace, repository, request)
+		return err
+	})
+
+	return response, err
+}
+
+// DeleteBranch deletes the branch of the repository. When the attempt failed, but the branch was deleted, the removal is treated as successful
+func (p retryProvider) DeleteBranch(ctx context.Context, workspace string, repository string, branchName string) error {
+	return withCheckedRetry(ctx, fmt.Sprintf("branch %s removal", branchName), func(ctx context.Context) bool {
+		exists, existsErr := p.Provider.BranchExists(ctx, workspace, repository, branchName)
+		return existsErr == nil && !exists
+	}, func() error {
+		return p.Provider.DeleteBranch(ctx, workspace, repository, branchName)
+	})
+}
+
+// withRetry runs the request till it succeeds, fails with not retryable error, the attempts are over or the context is done
+func withRetry(ctx context.Context, operation string, request func() error) error {
+	return withCheckedRetry(ctx, operation, nil, request)
+}
+
+// withCheckedRetry runs the request like withRetry, but before every next attempt it checks whether the previous attempt succeeded. It is used for the requests, which are not idempotent.
+// The requests of the check are sent once, because the check itself is repeated before every attempt
+func withCheckedRetry(ctx context.Context, operation string, done func(ctx context.Context) bool, request func() error) error {
+	var (
+		attempts = retryAttempts()
+		err      error
+	)
+
+	if err = ctx.Err(); err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		//The previous attempt could be done before the connection was lost
+		if attempt > 1 && done != nil && done(withoutRetry(ctx)) {
+			return nil
+		}
+
+		if err = request(); err == nil {
+			return nil
+		}
+
+		if !isRetryable(err) {
+			return err
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		delay := retryDelay(err, attempt)
+		log.Logger().Warn().
+			Err(err).
+			Str("operation", operation).
+			Int("attempt", attempt).
+			Dur("delay", delay).
+			Msg("The provider request failed, I will try again")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Wrap(err, fmt.Sprintf("The %s was cancelled after %d attempts", operation, attempt))
+		case <-timer.C:
+		}
+	}
+
+	return errors.Wrap(err, fmt.Sprintf("The provider is not available for the %s after %d attempts", operation, attempts))
+}
+
+// isRetryable returns true for the rate limit, server errors, timeouts and lost connections. The client errors and the cancelled requests are not retried
+func isRetryable(err error) bool {
+	var apiErr APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withoutRetry returns the context, which requests are sent once
+func withoutRetry(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retryContextKey{}, false)
+}
+
+// retriesRequests returns false, when the retries are disabled by withoutRetry
+func retriesRequests(ctx context.Context) bool {
+	retries, ok := ctx.Value(retryContextKey{}).(bool)
+	return !ok || retries
+}
+
+// retryDelay returns the delay before the next attempt. The Retry-After value is used when BitBucket sent it, otherwise the exponential backoff with full jitter.
+// The delay is never longer than maxRetryDelay
+func retryDelay(err error, attempt int) time.Duration {
+	var apiErr APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > maxRetryDelay {
+			return maxRetryDelay
+		}
+
+		return apiErr.RetryAfter
+	}
+
+	backoff := durationOrDefault(currentConfig().Retry.Delay, time.Millisecond, defaultRetryDelay) << uint(attempt-1)
+	if backoff <= 0 || backoff > maxRetryDelay {
+		backoff = maxRetryDelay
+	}
+
+	return time.Duration(rand.Int63n(int64(backoff)) + 1)
+}
+
+// isIdempotentMethod returns true for the requests, which can be sent again without the side effects
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+func retryAttempts() int {
+	if attempts := currentConfig().Retry.Attempts; attempts > 0 {
+		return attempts
+	}
+
+	return defaultRetryAttempts
+}
+
+// parseRetryAfter parses the Retry-After header, which can contain the seconds or the date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+
+	return 0
+}
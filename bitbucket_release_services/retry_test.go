@@ -0,0 +1,228 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{name: "rate limit", err: APIError{StatusCode: http.StatusTooManyRequests}, expected: true},
+		{name: "server error", err: APIError{StatusCode: http.StatusBadGateway}, expected: true},
+		{name: "not found", err: APIError{StatusCode: http.StatusNotFound}, expected: false},
+		{name: "wrapped server error", err: errors.Wrap(APIError{StatusCode: http.StatusServiceUnavailable}, "Failed to merge"), expected: true},
+		{name: "status code in the text only", err: errors.New("Received status code 500 from the BitBucket"), expected: false},
+		{name: "connection reset", err: &url.Error{Op: "Post", URL: "https://api.bitbucket.org", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, expected: true},
+		{name: "connection refused", err: errors.Wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, "Failed to create the tag"), expected: true},
+		{name: "connection closed", err: &url.Error{Op: "Get", URL: "https://api.bitbucket.org", Err: io.EOF}, expected: true},
+		{name: "cancelled request", err: &url.Error{Op: "Get", URL: "https://api.bitbucket.org", Err: context.Canceled}, expected: false},
+		{name: "other error", err: errors.New("The branch name is invalid"), expected: false},
+	}
+
+	for _, c := range cases {
+		if actual := isRetryable(c.err); actual != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.name, c.expected, actual)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if delay := retryDelay(APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Second}, 1); delay != 2*time.Second {
+		t.Errorf("expected Retry-After delay 2s, got %s", delay)
+	}
+
+	if delay := retryDelay(APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}, 1); delay != maxRetryDelay {
+		t.Errorf("expected Retry-After delay capped by %s, got %s", maxRetryDelay, delay)
+	}
+
+	for attempt := 1; attempt <= 100; attempt++ {
+		if delay := retryDelay(APIError{StatusCode: http.StatusBadGateway}, attempt); delay <= 0 || delay > maxRetryDelay {
+			t.Errorf("attempt %d: expected the delay between 0 and %s, got %s", attempt, maxRetryDelay, delay)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if delay := parseRetryAfter("3"); delay != 3*time.Second {
+		t.Errorf("expected 3s, got %s", delay)
+	}
+
+	if delay := parseRetryAfter(""); delay != 0 {
+		t.Errorf("expected no delay, got %s", delay)
+	}
+
+	if delay := parseRetryAfter("tomorrow"); delay != 0 {
+		t.Errorf("expected no delay for the invalid value, got %s", delay)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	setRetryConfig(t, 3, 1)
+
+	calls := 0
+	err := withRetry(context.Background(), "test", func() error {
+		calls++
+		return APIError{StatusCode: http.StatusBadGateway}
+	})
+	if err == nil || calls != 3 {
+		t.Errorf("expected the error after 3 attempts, got %v after %d attempts", err, calls)
+	}
+
+	calls = 0
+	err = withRetry(context.Background(), "test", func() error {
+		calls++
+		return APIError{StatusCode: http.StatusNotFound}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected the client error without retries, got %v after %d attempts", err, calls)
+	}
+
+	calls = 0
+	err = withRetry(context.Background(), "test", func() error {
+		calls++
+		if calls == 1 {
+			return APIError{StatusCode: http.StatusTooManyRequests}
+		}
+
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("expected the success on the second attempt, got %v after %d attempts", err, calls)
+	}
+}
+
+func TestWithCheckedRetry(t *testing.T) {
+	setRetryConfig(t, 3, 1)
+
+	var calls, checks int
+	err := withCheckedRetry(context.Background(), "test", func(ctx context.Context) bool {
+		checks++
+		return true
+	}, func() error {
+		calls++
+		return APIError{StatusCode: http.StatusGatewayTimeout}
+	})
+	if err != nil || calls != 1 || checks != 1 {
+		t.Errorf("expected the success after the check, got %v after %d attempts and %d checks", err, calls, checks)
+	}
+
+	calls, checks = 0, 0
+	err = withCheckedRetry(context.Background(), "test", func(ctx context.Context) bool {
+		checks++
+		return false
+	}, func() error {
+		calls++
+		return APIError{StatusCode: http.StatusGatewayTimeout}
+	})
+	if err == nil || calls != 3 || checks != 2 {
+		t.Errorf("expected the error after 3 attempts and 2 checks, got %v after %d attempts and %d checks", err, calls, checks)
+	}
+}
+
+func TestSendRetriesOnlyReadingRequests(t *testing.T) {
+	setRetryConfig(t, 3, 1)
+
+	calls := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := &apiClient{httpClient: server.Client()}
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete} {
+		request, err := http.NewRequest(method, server.URL, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err = client.send(request); err == nil {
+			t.Errorf("%s: expected the error", method)
+		}
+	}
+
+	expected := map[string]int{http.MethodGet: 3, http.MethodPost: 1, http.MethodPut: 1, http.MethodDelete: 1}
+	if fmt.Sprint(calls) != fmt.Sprint(expected) {
+		t.Errorf("expected the requests %v, got %v", expected, calls)
+	}
+
+	//The checks of withCheckedRetry are repeated by the retry itself, so their requests are sent once
+	request, err := http.NewRequestWithContext(withoutRetry(context.Background()), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = client.send(request); err == nil || calls[http.MethodGet] != 4 {
+		t.Errorf("expected one reading request without retries, got %d requests", calls[http.MethodGet]-3)
+	}
+}
+
+func TestAPIErrorNamesTheHost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("Not Found"))
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequestWithContext(withoutRetry(context.Background()), http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (&apiClient{httpClient: server.Client()}).send(request)
+	expected := fmt.Sprintf("The API of %s responded with status code 404: Not Found", request.URL.Hostname())
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected the error %q, got %v", expected, err)
+	}
+
+	if actual := (APIError{StatusCode: http.StatusBadGateway, Body: "Bad Gateway"}).Error(); actual != "The API responded with status code 502: Bad Gateway" {
+		t.Errorf("expected the error without the host, got %q", actual)
+	}
+}
+
+func TestWithRetryStopsWhenContextIsDone(t *testing.T) {
+	setRetryConfig(t, 3, 60000)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	calls := 0
+	started := time.Now()
+	err := withRetry(ctx, "test", func() error {
+		calls++
+		return APIError{StatusCode: http.StatusBadGateway}
+	})
+	if err == nil || calls != 1 {
+		t.Errorf("expected the error after 1 attempt, got %v after %d attempts", err, calls)
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("expected the retry to stop with the context, but it took %s", elapsed)
+	}
+}
+
+func setRetryConfig(t *testing.T, attempts int, delay int64) {
+	t.Helper()
+
+	previous := releaseConfig
+	releaseConfig = &bitbucketrelease_dto.Config{Retry: bitbucketrelease_dto.RetryConfig{Attempts: attempts, Delay: delay}}
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+}
@@ -0,0 +1,247 @@
+package bitbucket_release_services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	diffStatusAdded   = "added"
+	diffStatusRenamed = "renamed"
+)
+
+// RevertPullRequest creates the revert branch with the changes of the merged pull-request reverted and opens the revert pull-request into the pull-request destination branch.
+// BitBucket API doesn't have the revert endpoint, so every file changed by the merge commit is restored to its state in the parent of the merge commit.
+// It is the exact inverse of the merge commit only when these files were not changed after the merge, so otherwise the revert is refused.
+func RevertPullRequest(pullRequest bitbucketrelease_dto.ReleasePullRequest) (string, error) {
+	if pullRequest.MergeCommit == "" {
+		return "", errors.New("The merge commit of the pull-request is unknown.")
+	}
+
+	//The results, which were saved before the host was stored, have the empty host, so their link is checked as well
+	if !IsBitBucketCloud(pullRequest.Host) || !strings.HasPrefix(pullRequest.URL, "https://bitbucket.org/") {
+		return "", errNotSupportedByProvider
+	}
+
+	if pullRequest.ReleaseBranch != "" && !pullRequest.IsReleasePullRequest() {
+		return "", fmt.Errorf("The pull-request was merged into the release branch `%s`, not into `%s`. Please revert the release pull-request %s instead.", pullRequest.ReleaseBranch, pullRequest.DestinationBranch, pullRequest.ReleasePullRequestLink)
+	}
+
+	ctx := context.Background()
+	commit, err := getCommit(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.MergeCommit)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the merge commit")
+	}
+
+	if len(commit.Parents) == 0 {
+		return "", errors.New("The merge commit doesn't have the parent commit.")
+	}
+
+	destination, err := getBranch(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.DestinationBranch)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the destination branch")
+	}
+
+	mergeBase, err := getMergeBase(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.MergeCommit, destination.Target.Hash)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to check the merge commit in the destination branch")
+	}
+
+	if !sameCommit(mergeBase.Hash, pullRequest.MergeCommit) {
+		return "", fmt.Errorf("The merge commit %s is not in the branch `%s`.", pullRequest.MergeCommit, pullRequest.DestinationBranch)
+	}
+
+	diffStats, err := getDiffStats(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.MergeCommit)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the changes of the merge commit")
+	}
+
+	changed, err := changedAfterMerge(diffStats, pullRequest.MergeCommit, destination.Target.Hash, func(hash string, path string) ([]byte, bool, error) {
+		return getFile(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, hash, path)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(changed) > 0 {
+		return "", fmt.Errorf("The files were changed in `%s` after the merge, so I cannot revert it automatically: %s.", pullRequest.DestinationBranch, strings.Join(changed, ", "))
+	}
+
+	fields, files, err := revertChanges(ctx, pullRequest, diffStats, commit.Parents[0].Hash)
+	if err != nil {
+		return "", err
+	}
+
+	revertBranchName := fmt.Sprintf("revert/%s-%d-%s", pullRequest.RepositorySlug, pullRequest.PullRequestID, time.Now().Format("20060102150405"))
+	fields.Set("branch", revertBranchName)
+	fields.Set("parents", destination.Target.Hash)
+	fields.Set("message", fmt.Sprintf("Revert pull-request #%d %s", pullRequest.PullRequestID, pullRequest.Title))
+
+	//The commit creation is not idempotent, so before the next attempt we check, that the revert branch was not created by the previous one
+	endpoint := fmt.Sprintf("/repositories/%s/%s/src", pullRequest.Workspace, pullRequest.RepositorySlug)
+	err = withCheckedRetry(ctx, fmt.Sprintf("revert branch %s creation", revertBranchName), func(ctx context.Context) bool {
+		_, err := getBranch(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, revertBranchName)
+		return err == nil
+	}, func() error {
+		return api.requestForm(ctx, endpoint, fields, files)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create the revert branch")
+	}
+
+	log.Logger().Info().
+		Str("branch", revertBranchName).
+		Int64("pull_request_id", pullRequest.PullRequestID).
+		Msg("Created revert branch")
+
+	response, err := ProviderFor(pullRequest.Host).CreatePullRequest(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, bitbucketrelease_dto.ProviderPullRequestCreate{
+		Title:             fmt.Sprintf("Revert \"%s\"", pullRequest.Title),
+		Description:       fmt.Sprintf("This reverts pull-request %s", pullRequest.URL),
+		SourceBranch:      revertBranchName,
+		DestinationBranch: pullRequest.DestinationBranch,
+		CloseSourceBranch: true,
+		Reviewers:         RepositoryReviewers(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to create the revert pull-request")
+	}
+
+	return response.Link, nil
+}
+
+// changedAfterMerge returns the files of the merge commit, which are different in the head of the destination branch.
+// The read function returns the content of the file in the commit and false, when there is no such file
+func changedAfterMerge(diffStats []bitbucketrelease_dto.DiffStat, mergeCommit string, head string, read func(hash string, path string) ([]byte, bool, error)) ([]string, error) {
+	if sameCommit(mergeCommit, head) {
+		return nil, nil
+	}
+
+	var (
+		changed []string
+		checked = map[string]bool{}
+	)
+
+	for _, diffStat := range diffStats {
+		for _, path := range []*bitbucketrelease_dto.DiffStatPath{diffStat.Old, diffStat.New} {
+			if path == nil || checked[path.Path] {
+				continue
+			}
+
+			checked[path.Path] = true
+
+			merged, mergedExists, err := read(mergeCommit, path.Path)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Failed to get the file %s", path.Path))
+			}
+
+			current, currentExists, err := read(head, path.Path)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("Failed to get the file %s", path.Path))
+			}
+
+			if mergedExists != currentExists || !bytes.Equal(merged, current) {
+				changed = append(changed, path.Path)
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// revertChanges returns the form fields with the deleted files and the contents of the files, which should be restored from the parent commit
+func revertChanges(ctx context.Context, pullRequest bitbucketrelease_dto.ReleasePullRequest, diffStats []bitbucketrelease_dto.DiffStat, parentHash string) (url.Values, map[string][]byte, error) {
+	var (
+		fields = url.Values{}
+		files  = map[string][]byte{}
+	)
+
+	for _, diffStat := range diffStats {
+		if diffStat.New != nil && (diffStat.Status == diffStatusAdded || diffStat.Status == diffStatusRenamed) {
+			fields.Add("files", diffStat.New.Path)
+		}
+
+		if diffStat.Old == nil || diffStat.Status == diffStatusAdded {
+			continue
+		}
+
+		content, err := api.requestRaw(ctx, fmt.Sprintf("/repositories/%s/%s/src/%s/%s", pullRequest.Workspace, pullRequest.RepositorySlug, parentHash, diffStat.Old.Path))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, fmt.Sprintf("Failed to get the file %s", diffStat.Old.Path))
+		}
+
+		files[diffStat.Old.Path] = content
+	}
+
+	if len(files) == 0 && len(fields) == 0 {
+		return nil, nil, errors.New("The merge commit doesn't have any changes to revert.")
+	}
+
+	return fields, files, nil
+}
+
+// sameCommit returns true when the hashes point to the same commit. BitBucket returns the short hash of the merge commit
+func sameCommit(first string, second string) bool {
+	if first == "" || second == "" {
+		return false
+	}
+
+	return strings.HasPrefix(first, second) || strings.HasPrefix(second, first)
+}
+
+// getFile returns the content of the file in the commit and false, when the commit doesn't have the file
+func getFile(ctx context.Context, workspace string, repository string, hash string, path string) ([]byte, bool, error) {
+	content, err := api.requestRaw(ctx, fmt.Sprintf("/repositories/%s/%s/src/%s/%s", workspace, repository, hash, path))
+	if isNotFound(err) {
+		return nil, false, nil
+	}
+
+	return content, err == nil, err
+}
+
+// getMergeBase returns the best common ancestor of the commits. It is the first commit, when the first commit is in the history of the second one
+func getMergeBase(ctx context.Context, workspace string, repository string, first string, second string) (bitbucketrelease_dto.Commit, error) {
+	var commit bitbucketrelease_dto.Commit
+	err := api.request(ctx, "GET", fmt.Sprintf("/repositories/%s/%s/merge-base/%s..%s", workspace, repository, first, second), nil, &commit)
+
+	return commit, err
+}
+
+func getCommit(ctx context.Context, workspace string, repository string, hash string) (bitbucketrelease_dto.Commit, error) {
+	var commit bitbucketrelease_dto.Commit
+	err := api.request(ctx, "GET", fmt.Sprintf("/repositories/%s/%s/commit/%s", workspace, repository, hash), nil, &commit)
+
+	return commit, err
+}
+
+func getBranch(ctx context.Context, workspace string, repository string, branchName string) (bitbucketrelease_dto.Branch, error) {
+	var branch bitbucketrelease_dto.Branch
+	err := api.request(ctx, "GET", fmt.Sprintf("/repositories/%s/%s/refs/branches/%s", workspace, repository, url.PathEscape(branchName)), nil, &branch)
+
+	return branch, err
+}
+
+func getDiffStats(ctx context.Context, workspace string, repository string, hash string) ([]bitbucketrelease_dto.DiffStat, error) {
+	var (
+		diffStats []bitbucketrelease_dto.DiffStat
+		endpoint  = fmt.Sprintf("/repositories/%s/%s/diffstat/%s?pagelen=500", workspace, repository, hash)
+	)
+
+	for endpoint != "" {
+		var response bitbucketrelease_dto.DiffStatResponse
+		if err := api.request(ctx, "GET", endpoint, nil, &response); err != nil {
+			return nil, err
+		}
+
+		diffStats = append(diffStats, response.Values...)
+		endpoint = response.Next
+	}
+
+	return diffStats, nil
+}
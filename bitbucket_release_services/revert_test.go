@@ -0,0 +1,105 @@
+package bitbucket_release_services
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func TestChangedAfterMerge(t *testing.T) {
+	diffStats := []bitbucketrelease_dto.DiffStat{
+		{Status: "modified", Old: &bitbucketrelease_dto.DiffStatPath{Path: "modified.go"}, New: &bitbucketrelease_dto.DiffStatPath{Path: "modified.go"}},
+		{Status: diffStatusAdded, New: &bitbucketrelease_dto.DiffStatPath{Path: "added.go"}},
+		{Status: "removed", Old: &bitbucketrelease_dto.DiffStatPath{Path: "removed.go"}},
+	}
+
+	merged := map[string]string{"modified.go": "merged", "added.go": "added"}
+
+	cases := []struct {
+		name    string
+		head    string
+		files   map[string]string
+		changed string
+	}{
+		{
+			name: "destination branch is the merge commit",
+			head: "abc",
+		},
+		{
+			name:  "files are not changed after the merge",
+			head:  "def",
+			files: map[string]string{"modified.go": "merged", "added.go": "added"},
+		},
+		{
+			name:    "file is changed after the merge",
+			head:    "def",
+			files:   map[string]string{"modified.go": "changed", "added.go": "added"},
+			changed: "[modified.go]",
+		},
+		{
+			name:    "added file is deleted and removed file is restored after the merge",
+			head:    "def",
+			files:   map[string]string{"modified.go": "merged", "removed.go": "restored"},
+			changed: "[added.go removed.go]",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			changed, err := changedAfterMerge(diffStats, "abc", c.head, func(hash string, path string) ([]byte, bool, error) {
+				files := c.files
+				if hash == "abc" {
+					files = merged
+				}
+
+				content, ok := files[path]
+				return []byte(content), ok, nil
+			})
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			if c.changed == "" && len(changed) > 0 || c.changed != "" && fmt.Sprint(changed) != c.changed {
+				t.Errorf("expected changed files %q, got %v", c.changed, changed)
+			}
+		})
+	}
+}
+
+func TestRevertPullRequestOfReleaseBranch(t *testing.T) {
+	_, err := RevertPullRequest(bitbucketrelease_dto.ReleasePullRequest{
+		URL:                    "https://bitbucket.org/my-workspace/my-repository/pull-requests/1",
+		MergeCommit:            "abc",
+		DestinationBranch:      "master",
+		ReleaseBranch:          "release/1",
+		ReleasePullRequestLink: "https://bitbucket.org/my-workspace/my-repository/pull-requests/2",
+	})
+	if err == nil || !strings.Contains(err.Error(), "merged into the release branch `release/1`") {
+		t.Errorf("expected the revert of the release branch pull-request to be refused, got %v", err)
+	}
+}
+
+func TestSameCommit(t *testing.T) {
+	if !sameCommit("abcdef123456", "abcdef1234567890") || sameCommit("abcdef", "123456") || sameCommit("", "abc") {
+		t.Error("expected the commits to be compared by the short hash")
+	}
+}
+
+func TestRevertPullRequestOfOtherHost(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", URL: "https://git.example.com"}}}
+
+	for _, pullRequest := range []bitbucketrelease_dto.ReleasePullRequest{
+		{Host: "git.example.com", URL: "https://git.example.com/projects/PRJ/repos/api/pull-requests/1", MergeCommit: "abc"},
+		{URL: "https://git.example.com/projects/PRJ/repos/api/pull-requests/1", MergeCommit: "abc"},
+	} {
+		if _, err := RevertPullRequest(pullRequest); err != errNotSupportedByProvider {
+			t.Errorf("expected the revert of %q to be refused, got %v", pullRequest.Host, err)
+		}
+	}
+}
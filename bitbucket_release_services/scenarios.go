@@ -1,19 +1,26 @@
 package bitbucket_release_services
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
-	"github.com/sharovik/devbot/internal/client"
-	"github.com/sharovik/devbot/internal/container"
 	"github.com/sharovik/devbot/internal/dto"
 	"github.com/sharovik/devbot/internal/log"
-	"time"
+	"strings"
 )
 
-func MergeOnePullRequestScenario(message dto.BaseChatMessage, canBeMergedPullRequestList map[string]bitbucketrelease_dto.PullRequest) error {
+func MergeOnePullRequestScenario(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, options bitbucketrelease_dto.ReleaseOptions, canBeMergedPullRequestList []bitbucketrelease_dto.PullRequest) error {
 	log.Logger().Debug().Msg("There is only 1 received pull-request. Trying to merge it.")
-	newText, err := MergePullRequests(canBeMergedPullRequestList, client.StrategySquash)
+
+	canBeMergedPullRequestList, err := switchToTarget(message, release, options.Target, canBeMergedPullRequestList)
+	if err != nil {
+		log.Logger().FinishMessage("Merge of received pull-requests")
+		return err
+	}
+
+	config := RepositoryConfigFor(canBeMergedPullRequestList[0].Host, canBeMergedPullRequestList[0].Workspace, canBeMergedPullRequestList[0].RepositorySlug)
+	newText, err := MergePullRequests(release, canBeMergedPullRequestList, releaseStrategy(options, config))
 	if err != nil {
 		log.Logger().AddError(err).Msg("Failed to merge the pull-request")
 		log.Logger().FinishMessage("Merge of received pull-requests")
@@ -21,74 +28,261 @@ func MergeOnePullRequestScenario(message dto.BaseChatMessage, canBeMergedPullReq
 	}
 
 	SendMessageToTheChannel(message.Channel, fmt.Sprintf("%s\n", newText))
+
+	tagMergedPullRequests(message, canBeMergedPullRequestList, func(pullRequest bitbucketrelease_dto.PullRequest) string {
+		return release.PullRequestResult(pullRequest).MergeCommit
+	})
+
 	log.Logger().FinishMessage("Merge of received pull-requests")
 	return nil
 }
 
-func MergeMultiplePullRequestsScenario(message dto.BaseChatMessage, repository string, pullRequests map[string]bitbucketrelease_dto.PullRequest) error {
-	//This is for multiple pull-requests links
-	var (
-		repositories                  = map[string]dto.BitBucketResponseBranchCreate{}
-		workspace                     = ""
-		releasePullRequestDescription = ""
-		pullRequestsToMerge           = map[string]bitbucketrelease_dto.PullRequest{}
-		releaseBranchName             = fmt.Sprintf("release/%s", time.Now().Format("2006.01.02"))
-	)
+// tagMergedPullRequests creates one version tag for the pull-requests of the repository, which were merged into its main branch.
+// The tag is created on the merge commit of the last of them, and the version is bumped by all of them. The pull-requests merged into other branches are not tagged
+func tagMergedPullRequests(message dto.BaseChatMessage, pullRequests []bitbucketrelease_dto.PullRequest, mergeCommit func(pullRequest bitbucketrelease_dto.PullRequest) string) {
+	if len(pullRequests) == 0 {
+		return
+	}
+
+	repository := pullRequests[0]
+	if !VersioningPolicyFor(repository.Host, repository.Workspace, repository.RepositorySlug).Enabled {
+		return
+	}
 
-	SendMessageToTheChannel(message.Channel, fmt.Sprintf("For repository `%s` we have more then 1 pull-request. I will create a release-branch.", repository))
+	if !IsBitBucketCloud(repository.Host) {
+		reportTagFailure(message, repository, errNotSupportedByProvider)
+		return
+	}
 
-	//In that case we have multiple pull-requests for that repository, so we have to create a release branch
-	for _, pullRequest := range pullRequests {
-		if workspace == "" {
-			workspace = pullRequest.Workspace
-		}
+	mainBranch, err := MainBranch(context.Background(), repository.Host, repository.Workspace, repository.RepositorySlug)
+	if err != nil {
+		reportTagFailure(message, repository, err)
+		return
+	}
 
-		releasePullRequestDescription += fmt.Sprintf("%s\n", pullRequest.Title)
+	lastMergeCommit, released := mainBranchRelease(pullRequests, mainBranch, mergeCommit)
+	if lastMergeCommit == "" {
+		log.Logger().Debug().Str("repository", repository.RepositorySlug).Str("main_branch", mainBranch).Msg("Nothing was merged into the main branch, so the tag is not created")
+		return
+	}
 
-		//If we don't have any created release branch for this repository the we need to create it
-		if repositories[repository].Name == "" {
-			branchResponse, err := container.C.BibBucketClient.CreateBranch(pullRequest.Workspace, pullRequest.RepositorySlug, releaseBranchName)
-			if err != nil {
-				log.Logger().AddError(err).Msg("Received an error during the release branch creation")
-				return errors.Wrap(err, fmt.Sprintf("\nThe release-branch for repository %s cannot be created, because of `%s`", repository, err))
-			}
+	tagName, err := TagRelease(repository.Host, repository.Workspace, repository.RepositorySlug, lastMergeCommit, released)
+	if err != nil {
+		reportTagFailure(message, repository, err)
+		return
+	}
+
+	if tagName != "" {
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("I created tag `%s` in repository `%s`.", tagName, repository.RepositorySlug))
+	}
+}
 
-			repositories[repository] = branchResponse
+// mainBranchRelease returns the merge commit of the last pull-request merged into the main branch and all pull-requests released into the main branch.
+// The release pull-requests are replaced by the pull-requests from their release notes
+func mainBranchRelease(pullRequests []bitbucketrelease_dto.PullRequest, mainBranch string, mergeCommit func(pullRequest bitbucketrelease_dto.PullRequest) string) (string, []bitbucketrelease_dto.PullRequest) {
+	var (
+		lastMergeCommit string
+		released        []bitbucketrelease_dto.PullRequest
+	)
+
+	for _, pullRequest := range pullRequests {
+		commit := mergeCommit(pullRequest)
+		if commit == "" || pullRequest.DestinationBranch != mainBranch {
+			continue
 		}
 
-		//We switch the destination of the pull-request to the release branch
-		_, err := container.C.BibBucketClient.ChangePullRequestDestination(
-			pullRequest.Workspace,
-			pullRequest.RepositorySlug,
-			pullRequest.ID,
-			prepareReleaseTitle(pullRequest.Title),
-			releaseBranchName)
-		if err != nil {
-			SendMessageToTheChannel(message.Channel, fmt.Sprintf("I've tried to switch the destination for pull-request #%d and I failed. Reason: `%s`\nNote! This pull-request will not be merged into release branch!", pullRequest.ID, err))
-			log.Logger().AddError(err).Msg("Received an error during the branch destination switch")
+		lastMergeCommit = commit
+		if isReleaseBranchName(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.BranchName) {
+			released = append(released, releaseNotesPullRequests(pullRequest.Description)...)
 			continue
 		}
 
-		pullRequestsToMerge[repository] = pullRequest
+		released = append(released, pullRequest)
 	}
 
-	SendMessageToTheChannel(message.Channel, fmt.Sprintf("Trying to merge the %d pull-requests to the `%s` branch  of `%s` repository", len(pullRequests), releaseBranchName, repository))
-	newText, err := MergePullRequests(pullRequestsToMerge, client.StrategySquash)
+	return lastMergeCommit, released
+}
+
+func reportTagFailure(message dto.BaseChatMessage, pullRequest bitbucketrelease_dto.PullRequest, err error) {
+	log.Logger().AddError(err).Int64("pull_request_id", pullRequest.ID).Msg("Failed to create the release tag")
+	SendMessageToTheChannel(message.Channel, fmt.Sprintf("I failed to create the version tag for repository `%s`. Reason: `%s`", pullRequest.RepositorySlug, err))
+}
+
+func MergeMultiplePullRequestsScenario(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, options bitbucketrelease_dto.ReleaseOptions, repository string, pullRequests []bitbucketrelease_dto.PullRequest) error {
+	//This is for multiple pull-requests links
+	prepared, err := PrepareRepository(message, release, options, repository, pullRequests)
 	if err != nil {
-		log.Logger().AddError(err).Msg("Received error during multiple pull-request merge")
-		log.Logger().FinishMessage("Merge of received pull-requests")
 		return err
 	}
 
-	SendMessageToTheChannel(message.Channel, newText)
+	return MergePreparedRepository(message, release, options, prepared)
+}
+
+// MergePreparedRepository merges the pull-requests into the prepared release branch and opens the release pull-request
+func MergePreparedRepository(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, options bitbucketrelease_dto.ReleaseOptions, prepared PreparedRepository) error {
+	var (
+		repository        = prepared.RepositorySlug
+		releaseBranchName = prepared.ReleaseBranch.Name
+		repositoryKey     = bitbucketrelease_dto.RepositoryKey{Host: prepared.Host, Workspace: prepared.Workspace, RepositorySlug: repository}
+		config            = RepositoryConfigFor(prepared.Host, prepared.Workspace, repository)
+	)
+
+	SendMessageToTheChannel(message.Channel, fmt.Sprintf("Trying to merge the %d pull-requests to the `%s` branch  of `%s` repository", len(prepared.Switched)+len(prepared.Failed), releaseBranchName, repository))
+	newText, mergeErr := MergePullRequests(release, prepared.Switched, releaseStrategy(options, config))
+	release.SetReleaseBranch(repositoryKey, releaseBranchName, "")
+
+	merged, notMerged := splitMerged(release, prepared.Switched)
+	if mergeErr != nil {
+		log.Logger().AddError(mergeErr).Msg("Received error during multiple pull-request merge")
+		SendMessageToTheChannel(message.Channel, newText)
+
+		//The not merged pull-requests are restored. When nothing was merged, the release branch is not needed anymore
+		CompensateRepository(message, release, prepared, fmt.Sprintf("The merge into the release branch was stopped: %s", mergeErr))
+		if len(merged) == 0 {
+			log.Logger().FinishMessage("Merge of received pull-requests")
+			return mergeErr
+		}
+
+		//In all-or-nothing mode the partial release is not opened and not watched, the merged pull-requests stay in the release branch
+		if !opensPartialRelease(options) {
+			SendMessageToTheChannel(message.Channel, fmt.Sprintf("I merged %d of %d pull-requests into `%s`, but I don't open the release pull-request, because all pull-requests should be released together. Please check the release-branch manually.", len(merged), len(prepared.Switched), releaseBranchName))
+			log.Logger().FinishMessage("Merge of received pull-requests")
+			return mergeErr
+		}
+
+		//The merged pull-requests cannot be unmerged, so they are released by the release pull-request
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("I merged %d of %d pull-requests into `%s`, so I continue the release of them. These pull-requests are not in the release: %s", len(merged), len(prepared.Switched), releaseBranchName, pullRequestLinks(append(notMerged, prepared.Failed...))))
+	} else {
+		SendMessageToTheChannel(message.Channel, newText)
+	}
+
+	if prepared.ReleaseBranch.Exists {
+		release.SetReleaseBranch(repositoryKey, releaseBranchName, prepared.ReleaseBranch.ReleasePullRequestLink)
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("\nThe release pull-request is already open, please approve it: `%s`", prepared.ReleaseBranch.ReleasePullRequestLink))
+		release.AddReleasePullRequest(preparedReleasePullRequest(prepared, prepared.ReleaseBranch.ReleasePullRequestID))
+		return partialReleaseError(mergeErr)
+	}
 
 	//Now we need to create the pull-request
-	pullRequestLink, err := createReleasePullRequest(workspace, repository, repositories[repository], releasePullRequestDescription)
+	releasePullRequest, err := createReleasePullRequest(prepared.Host, prepared.Workspace, repository, prepared.Branch, config, releaseTarget(options, config), ReleaseNotes(repository, merged))
 	if err != nil {
 		log.Logger().FinishMessage("Merge of received pull-requests")
 		return errors.Wrap(err, fmt.Sprintf("\nI tried to create the release pull-request and I failed. Reason: %s", err))
 	}
 
-	SendMessageToTheChannel(message.Channel, fmt.Sprintf("\nPlease approve release pull-request: `%s`", pullRequestLink))
-	return nil
+	release.SetReleaseBranch(repositoryKey, releaseBranchName, releasePullRequest.Link)
+	SendMessageToTheChannel(message.Channel, fmt.Sprintf("\nPlease approve release pull-request: `%s`", releasePullRequest.Link))
+	release.AddReleasePullRequest(preparedReleasePullRequest(prepared, releasePullRequest.ID))
+	return partialReleaseError(mergeErr)
+}
+
+// preparedReleasePullRequest returns the release pull-request of the prepared repository, which should be watched once the release is saved
+func preparedReleasePullRequest(prepared PreparedRepository, pullRequestID int64) bitbucketrelease_dto.PullRequest {
+	providerHost, _ := ProviderHostFor(prepared.Host)
+
+	return bitbucketrelease_dto.PullRequest{
+		Host:           prepared.Host,
+		Provider:       providerHost.Type,
+		ID:             pullRequestID,
+		Workspace:      prepared.Workspace,
+		RepositorySlug: prepared.RepositorySlug,
+		BranchName:     prepared.ReleaseBranch.Name,
+	}
+}
+
+// opensPartialRelease returns true when the release pull-request is opened for the pull-requests, which were merged into the release branch before the merge failed
+func opensPartialRelease(options bitbucketrelease_dto.ReleaseOptions) bool {
+	return !options.AllOrNothing
+}
+
+// splitMerged returns the pull-requests, which were merged by the release, and the rest of them
+func splitMerged(release *bitbucketrelease_dto.Release, pullRequests []bitbucketrelease_dto.PullRequest) (merged []bitbucketrelease_dto.PullRequest, notMerged []bitbucketrelease_dto.PullRequest) {
+	for _, pullRequest := range pullRequests {
+		if release.PullRequestResult(pullRequest).Status == bitbucketrelease_dto.PullRequestStatusMerged {
+			merged = append(merged, pullRequest)
+			continue
+		}
+
+		notMerged = append(notMerged, pullRequest)
+	}
+
+	return merged, notMerged
+}
+
+// partialReleaseError returns the error of the release, where only part of pull-requests was merged. The release pull-request is open for the merged ones
+func partialReleaseError(mergeErr error) error {
+	if mergeErr == nil {
+		return nil
+	}
+
+	return errors.Wrap(mergeErr, "Not all pull-requests were merged into the release branch, the release pull-request contains only the merged ones")
+}
+
+func pullRequestLinks(pullRequests []bitbucketrelease_dto.PullRequest) string {
+	var links []string
+	for _, pullRequest := range pullRequests {
+		links = append(links, pullRequest.URL())
+	}
+
+	return strings.Join(links, ", ")
+}
+
+// switchToTarget switches the destination of the pull-requests to the target branch. The pull-requests are not changed, when the target is not defined
+func switchToTarget(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, target string, pullRequests []bitbucketrelease_dto.PullRequest) ([]bitbucketrelease_dto.PullRequest, error) {
+	if target == "" || len(pullRequests) == 0 {
+		return pullRequests, nil
+	}
+
+	if err := ValidateTarget(context.Background(), pullRequests[0].Host, pullRequests[0].Workspace, pullRequests[0].RepositorySlug, target); err != nil {
+		failPullRequests(release, pullRequests, err.Error())
+		return nil, err
+	}
+
+	result, switched, err := switchDestinations(release, target, pullRequests)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, pullRequest := range switched {
+		SendMessageToTheChannel(message.Channel, fmt.Sprintf("I switched the destination of pull-request #%d from `%s` to `%s`.", pullRequest.ID, pullRequest.DestinationBranch, target))
+	}
+
+	return result, nil
+}
+
+// switchDestinations changes the destination of the pull-requests to the target branch and returns them together with the switched ones, which keep the original destination.
+// When the destination of one of them cannot be changed, the already switched pull-requests are restored and marked as failed in the release
+func switchDestinations(release *bitbucketrelease_dto.Release, target string, pullRequests []bitbucketrelease_dto.PullRequest) (result []bitbucketrelease_dto.PullRequest, switched []bitbucketrelease_dto.PullRequest, err error) {
+	for _, pullRequest := range pullRequests {
+		if pullRequest.DestinationBranch == target {
+			result = append(result, pullRequest)
+			continue
+		}
+
+		if _, err = ProviderFor(pullRequest.Host).ChangePullRequestDestination(context.Background(), pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID, pullRequest.Title, target); err != nil {
+			release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, fmt.Sprintf("The destination cannot be switched to the target branch: %s", err))
+
+			text := fmt.Sprintf("The destination of pull-request #%d cannot be switched to `%s`", pullRequest.ID, target)
+			failPullRequests(release, switched, fmt.Sprintf("%s, so the release was stopped.", text))
+			if restoreErr := RestorePullRequests(switched); restoreErr != nil {
+				text = fmt.Sprintf("%s. %s", text, restoreErr)
+			}
+
+			return nil, nil, errors.Wrap(err, text)
+		}
+
+		switched = append(switched, pullRequest)
+
+		pullRequest.DestinationBranch = target
+		result = append(result, pullRequest)
+	}
+
+	return result, switched, nil
+}
+
+// failPullRequests marks all pull-requests of the repository as failed in the release
+func failPullRequests(release *bitbucketrelease_dto.Release, pullRequests []bitbucketrelease_dto.PullRequest, reason string) {
+	for _, pullRequest := range pullRequests {
+		release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, reason)
+	}
 }
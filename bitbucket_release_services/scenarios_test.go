@@ -0,0 +1,132 @@
+package bitbucket_release_services
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMainBranchRelease(t *testing.T) {
+	pullRequests := []bitbucketrelease_dto.PullRequest{
+		{ID: 1, Title: "fix: wrong response", DestinationBranch: "master"},
+		{ID: 2, Title: "feat: new endpoint", DestinationBranch: "master"},
+		{ID: 3, Title: "feat!: drop v1", DestinationBranch: "develop"},
+		{ID: 4, Title: "fix: not merged", DestinationBranch: "master"},
+	}
+
+	mergeCommits := map[int64]string{1: "first", 2: "second", 3: "third"}
+	mergeCommit, released := mainBranchRelease(pullRequests, "master", func(pullRequest bitbucketrelease_dto.PullRequest) string {
+		return mergeCommits[pullRequest.ID]
+	})
+
+	if mergeCommit != "second" {
+		t.Errorf("expected the merge commit of the last pull-request merged into the main branch, got %q", mergeCommit)
+	}
+
+	if len(released) != 2 || released[0].ID != 1 || released[1].ID != 2 {
+		t.Errorf("expected the pull-requests #1 and #2, got %+v", released)
+	}
+
+	if mergeCommit, _ = mainBranchRelease(pullRequests, "main", func(pullRequest bitbucketrelease_dto.PullRequest) string {
+		return mergeCommits[pullRequest.ID]
+	}); mergeCommit != "" {
+		t.Errorf("expected no tag for the pull-requests merged into other branches, got %q", mergeCommit)
+	}
+}
+
+func TestSplitMerged(t *testing.T) {
+	var (
+		release = bitbucketrelease_dto.NewRelease("U1", "C1")
+		first   = bitbucketrelease_dto.PullRequest{ID: 1, Workspace: "ws", RepositorySlug: "api"}
+		second  = bitbucketrelease_dto.PullRequest{ID: 2, Workspace: "ws", RepositorySlug: "api"}
+		third   = bitbucketrelease_dto.PullRequest{ID: 3, Workspace: "ws", RepositorySlug: "api"}
+	)
+
+	release.SetPullRequestStatus(first, bitbucketrelease_dto.PullRequestStatusMerged, "")
+	release.SetPullRequestStatus(second, bitbucketrelease_dto.PullRequestStatusMergeFailed, "conflict")
+
+	merged, notMerged := splitMerged(release, []bitbucketrelease_dto.PullRequest{first, second, third})
+	if len(merged) != 1 || merged[0].ID != 1 {
+		t.Errorf("expected the pull-request #1 to be merged, got %+v", merged)
+	}
+
+	if len(notMerged) != 2 || notMerged[0].ID != 2 || notMerged[1].ID != 3 {
+		t.Errorf("expected the pull-requests #2 and #3 not to be merged, got %+v", notMerged)
+	}
+
+	if partialReleaseError(nil) != nil {
+		t.Error("expected no error, when all pull-requests were merged")
+	}
+}
+
+func TestOpensPartialRelease(t *testing.T) {
+	if !opensPartialRelease(bitbucketrelease_dto.ReleaseOptions{}) {
+		t.Error("expected the release pull-request for the merged pull-requests by default")
+	}
+
+	if opensPartialRelease(bitbucketrelease_dto.ReleaseOptions{AllOrNothing: true}) {
+		t.Error("expected no release pull-request for the partially merged repository in all-or-nothing mode")
+	}
+}
+
+func TestSwitchDestinationsRestoresSwitchedPullRequests(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		requests = append(requests, fmt.Sprintf("#%s %s %s", path.Base(r.URL.Path), body["base"], body["title"]))
+		if path.Base(r.URL.Path) == "3" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"number": 1}`))
+	}))
+	defer server.Close()
+
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{
+		Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", Type: bitbucketrelease_dto.ProviderGitHub, URL: server.URL}},
+	}
+
+	var (
+		release = bitbucketrelease_dto.NewRelease("U1", "C1")
+		first   = bitbucketrelease_dto.PullRequest{ID: 1, Host: "git.example.com", Workspace: "my-owner", RepositorySlug: "api", Title: "fix: first", DestinationBranch: "master"}
+		second  = bitbucketrelease_dto.PullRequest{ID: 2, Host: "git.example.com", Workspace: "my-owner", RepositorySlug: "api", Title: "fix: second", DestinationBranch: "develop"}
+		third   = bitbucketrelease_dto.PullRequest{ID: 3, Host: "git.example.com", Workspace: "my-owner", RepositorySlug: "api", Title: "fix: third", DestinationBranch: "master"}
+	)
+
+	result, switched, err := switchDestinations(release, "develop", []bitbucketrelease_dto.PullRequest{first, second, third})
+	if err == nil || !strings.Contains(err.Error(), "The destination of pull-request #3 cannot be switched to `develop`") {
+		t.Errorf("expected the error of pull-request #3, got %v", err)
+	}
+
+	if result != nil || switched != nil {
+		t.Errorf("expected no pull-requests, when the switch failed, got %+v and %+v", result, switched)
+	}
+
+	expected := []string{"#1 develop fix: first", "#3 develop fix: third", "#1 master fix: first"}
+	if fmt.Sprint(requests) != fmt.Sprint(expected) {
+		t.Errorf("expected the requests %v, got %v", expected, requests)
+	}
+
+	for _, pullRequest := range []bitbucketrelease_dto.PullRequest{first, third} {
+		if status := release.PullRequestResult(pullRequest).Status; status != bitbucketrelease_dto.PullRequestStatusMergeFailed {
+			t.Errorf("expected pull-request #%d to be failed, got %q", pullRequest.ID, status)
+		}
+	}
+
+	if status := release.PullRequestResult(second).Status; status != "" {
+		t.Errorf("expected no status of pull-request #2, which already targets `develop`, got %q", status)
+	}
+}
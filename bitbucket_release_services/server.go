@@ -0,0 +1,62 @@
+package bitbucket_release_services
+
+import (
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+)
+
+// prepareServers validates the VCS provider hosts of the configuration and fills the default types and URLs
+func prepareServers(servers []bitbucketrelease_dto.ProviderHost) error {
+	for i, host := range servers {
+		if host.Host == "" {
+			return errors.New("The host of the provider is not defined.")
+		}
+
+		if host.Type == "" {
+			servers[i].Type = bitbucketrelease_dto.ProviderBitBucketServer
+		}
+
+		switch servers[i].Type {
+		case bitbucketrelease_dto.ProviderBitBucketServer:
+			if host.URL == "" {
+				servers[i].URL = "https://" + host.Host
+			}
+		case bitbucketrelease_dto.ProviderGitHub:
+			if host.URL == "" {
+				servers[i].URL = defaultGitHubURL(host.Host)
+			}
+		case bitbucketrelease_dto.ProviderGitLab:
+			if host.URL == "" {
+				servers[i].URL = "https://" + host.Host + "/api/v4"
+			}
+		default:
+			return errors.New("The provider type " + host.Type + " is not supported.")
+		}
+
+		servers[i].URL = strings.TrimSuffix(servers[i].URL, "/")
+	}
+
+	return nil
+}
+
+// ProviderHostFor returns the configuration of the selected host
+func ProviderHostFor(host string) (bitbucketrelease_dto.ProviderHost, bool) {
+	if host == "" {
+		return bitbucketrelease_dto.ProviderHost{}, false
+	}
+
+	for _, item := range currentConfig().Servers {
+		if strings.EqualFold(item.Host, host) {
+			return item, true
+		}
+	}
+
+	return bitbucketrelease_dto.ProviderHost{}, false
+}
+
+// IsBitBucketCloud returns true when the host is bitbucket.org
+func IsBitBucketCloud(host string) bool {
+	_, ok := ProviderHostFor(host)
+	return !ok
+}
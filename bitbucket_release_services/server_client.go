@@ -0,0 +1,305 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"net/http"
+	"net/url"
+)
+
+const (
+	serverStrategySquash = "squash"
+	serverStrategyMerge  = "no-ff"
+
+	serverBranchPrefix = "refs/heads/"
+)
+
+// bitBucketServerProvider the Bitbucket Server REST API provider. The project key is used as the workspace
+type bitBucketServerProvider struct {
+	host   bitbucketrelease_dto.ProviderHost
+	client restClient
+}
+
+func newBitBucketServerProvider(host bitbucketrelease_dto.ProviderHost) bitBucketServerProvider {
+	return bitBucketServerProvider{
+		host:   host,
+		client: newRestClient(host.URL, map[string]string{"Authorization": fmt.Sprintf("Bearer %s", host.Token)}),
+	}
+}
+
+func (p bitBucketServerProvider) repositoryEndpoint(project string, repository string) string {
+	return fmt.Sprintf("/rest/api/1.0/projects/%s/repos/%s", url.PathEscape(project), url.PathEscape(repository))
+}
+
+func (p bitBucketServerProvider) pullRequest(ctx context.Context, project string, repository string, pullRequestID int64) (bitbucketrelease_dto.ServerPullRequest, error) {
+	var pullRequest bitbucketrelease_dto.ServerPullRequest
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/pull-requests/%d", p.repositoryEndpoint(project, repository), pullRequestID), nil, &pullRequest)
+	return pullRequest, err
+}
+
+// PullRequest returns the pull-request with its approvals
+func (p bitBucketServerProvider) PullRequest(ctx context.Context, project string, repository string, pullRequestID int64) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	pullRequest, err := p.pullRequest(ctx, project, repository, pullRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return serverPullRequest(pullRequest), nil
+}
+
+// MergePullRequest merges the pull-request. The squash strategy is used for client.StrategySquash and no-ff strategy for other strategies
+func (p bitBucketServerProvider) MergePullRequest(ctx context.Context, project string, repository string, pullRequestID int64, message string, strategy string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	pullRequest, err := p.pullRequest(ctx, project, repository, pullRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	serverStrategy := serverStrategyMerge
+	if strategy == client.StrategySquash {
+		serverStrategy = serverStrategySquash
+	}
+
+	var merged bitbucketrelease_dto.ServerPullRequest
+	err = p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/pull-requests/%d/merge?version=%d", p.repositoryEndpoint(project, repository), pullRequestID, pullRequest.Version), map[string]string{
+		"strategyId": serverStrategy,
+		"message":    message,
+	}, &merged)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return serverPullRequest(merged), nil
+}
+
+// ChangePullRequestDestination changes the destination branch and the title of the pull-request
+func (p bitBucketServerProvider) ChangePullRequestDestination(ctx context.Context, project string, repository string, pullRequestID int64, title string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	pullRequest, err := p.pullRequest(ctx, project, repository, pullRequestID)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	var updated bitbucketrelease_dto.ServerPullRequest
+	err = p.client.request(ctx, http.MethodPut, fmt.Sprintf("%s/pull-requests/%d", p.repositoryEndpoint(project, repository), pullRequestID), map[string]interface{}{
+		"version":     pullRequest.Version,
+		"title":       title,
+		"description": pullRequest.Description,
+		"toRef":       serverRef(project, repository, branchName),
+	}, &updated)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return serverPullRequest(updated), nil
+}
+
+// CreateBranch creates the branch from the default branch of the repository
+func (p bitBucketServerProvider) CreateBranch(ctx context.Context, project string, repository string, branchName string, fromBranch string) (bitbucketrelease_dto.ProviderBranch, error) {
+	startPoint := serverBranchPrefix + fromBranch
+	if fromBranch == "" {
+		defaultBranch, err := p.defaultBranch(ctx, project, repository)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderBranch{}, errors.Wrap(err, "Failed to get the default branch")
+		}
+
+		startPoint = defaultBranch.ID
+	}
+
+	var branch bitbucketrelease_dto.ServerBranch
+	err := p.client.request(ctx, http.MethodPost, fmt.Sprintf("/rest/branch-utils/1.0/projects/%s/repos/%s/branches", url.PathEscape(project), url.PathEscape(repository)), map[string]string{
+		"name":       branchName,
+		"startPoint": startPoint,
+	}, &branch)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderBranch{}, err
+	}
+
+	return bitbucketrelease_dto.ProviderBranch{Name: branch.DisplayID, Hash: branch.LatestCommit}, nil
+}
+
+// CreatePullRequest creates the pull-request. When the destination is not defined, the default branch is used. When the request has no reviewers, they are taken from the host configuration
+func (p bitBucketServerProvider) CreatePullRequest(ctx context.Context, project string, repository string, request bitbucketrelease_dto.ProviderPullRequestCreate) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	destination := request.DestinationBranch
+	if destination == "" {
+		defaultBranch, err := p.defaultBranch(ctx, project, repository)
+		if err != nil {
+			return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, "Failed to get the default branch")
+		}
+
+		destination = defaultBranch.DisplayID
+	}
+
+	var reviewers []bitbucketrelease_dto.ServerParticipant
+	for _, reviewer := range requestReviewers(request, p.host) {
+		reviewers = append(reviewers, bitbucketrelease_dto.ServerParticipant{User: bitbucketrelease_dto.ServerUser{Name: reviewer}})
+	}
+
+	var created bitbucketrelease_dto.ServerPullRequest
+	err := p.client.request(ctx, http.MethodPost, fmt.Sprintf("%s/pull-requests", p.repositoryEndpoint(project, repository)), map[string]interface{}{
+		"title":       request.Title,
+		"description": request.Description,
+		"fromRef":     serverRef(project, repository, request.SourceBranch),
+		"toRef":       serverRef(project, repository, destination),
+		"reviewers":   reviewers,
+	}, &created)
+	if err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, err
+	}
+
+	return serverPullRequest(created), nil
+}
+
+// MainBranch returns the default branch of the repository
+func (p bitBucketServerProvider) MainBranch(ctx context.Context, project string, repository string) (string, error) {
+	branch, err := p.defaultBranch(ctx, project, repository)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the default branch of the repository")
+	}
+
+	return branch.DisplayID, nil
+}
+
+func (p bitBucketServerProvider) defaultBranch(ctx context.Context, project string, repository string) (bitbucketrelease_dto.ServerBranch, error) {
+	var branch bitbucketrelease_dto.ServerBranch
+	err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/default-branch", p.repositoryEndpoint(project, repository)), nil, &branch)
+	return branch, err
+}
+
+// BranchExists returns true when the repository has the branch with the selected name
+func (p bitBucketServerProvider) BranchExists(ctx context.Context, project string, repository string, branchName string) (bool, error) {
+	var response bitbucketrelease_dto.ServerBranchesResponse
+	if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("%s/branches?filterText=%s&limit=100", p.repositoryEndpoint(project, repository), url.QueryEscape(branchName)), nil, &response); err != nil {
+		return false, err
+	}
+
+	for _, branch := range response.Values {
+		if branch.DisplayID == branchName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// DeleteBranch deletes the branch of the repository
+func (p bitBucketServerProvider) DeleteBranch(ctx context.Context, project string, repository string, branchName string) error {
+	return p.client.request(ctx, http.MethodDelete, fmt.Sprintf("/rest/branch-utils/1.0/projects/%s/repos/%s/branches", url.PathEscape(project), url.PathEscape(repository)), map[string]string{
+		"name": serverBranchPrefix + branchName,
+	}, nil)
+}
+
+// OpenPullRequest returns the open pull-request from the selected branch
+func (p bitBucketServerProvider) OpenPullRequest(ctx context.Context, project string, repository string, branchName string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	var response bitbucketrelease_dto.ServerPullRequestsResponse
+	endpoint := fmt.Sprintf("%s/pull-requests?state=OPEN&direction=OUTGOING&at=%s", p.repositoryEndpoint(project, repository), url.QueryEscape(serverBranchPrefix+branchName))
+	if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+		return bitbucketrelease_dto.ProviderPullRequest{}, errors.Wrap(err, fmt.Sprintf("Failed to find the pull-requests of the branch %s", branchName))
+	}
+
+	if len(response.Values) == 0 {
+		return bitbucketrelease_dto.ProviderPullRequest{}, nil
+	}
+
+	return serverPullRequest(response.Values[0]), nil
+}
+
+// OpenPullRequests returns the open pull-requests of the repository
+func (p bitBucketServerProvider) OpenPullRequests(ctx context.Context, project string, repository string, destinationBranch string) ([]bitbucketrelease_dto.ProviderPullRequest, error) {
+	var (
+		pullRequests []bitbucketrelease_dto.ProviderPullRequest
+		start        int64
+		filter       = ""
+	)
+
+	if destinationBranch != "" {
+		filter = "&direction=INCOMING&at=" + url.QueryEscape(serverBranchPrefix+destinationBranch)
+	}
+
+	for {
+		var response bitbucketrelease_dto.ServerPullRequestsResponse
+		endpoint := fmt.Sprintf("%s/pull-requests?state=OPEN&limit=100&start=%d%s", p.repositoryEndpoint(project, repository), start, filter)
+		if err := p.client.request(ctx, http.MethodGet, endpoint, nil, &response); err != nil {
+			return nil, errors.Wrap(err, "Failed to get the open pull-requests")
+		}
+
+		for _, item := range response.Values {
+			pullRequests = append(pullRequests, serverPullRequest(item))
+		}
+
+		if response.IsLastPage || len(response.Values) == 0 {
+			return pullRequests, nil
+		}
+
+		start = response.NextPageStart
+	}
+}
+
+// BuildStatuses returns all build statuses of the selected commit
+func (p bitBucketServerProvider) BuildStatuses(ctx context.Context, project string, repository string, commitHash string) ([]bitbucketrelease_dto.BuildStatus, error) {
+	var (
+		statuses []bitbucketrelease_dto.BuildStatus
+		start    int64
+	)
+
+	for {
+		var response bitbucketrelease_dto.ServerBuildStatusesResponse
+		if err := p.client.request(ctx, http.MethodGet, fmt.Sprintf("/rest/build-status/1.0/commits/%s?start=%d", commitHash, start), nil, &response); err != nil {
+			return nil, err
+		}
+
+		statuses = append(statuses, response.Values...)
+		if response.IsLastPage || len(response.Values) == 0 {
+			return statuses, nil
+		}
+
+		start = response.NextPageStart
+	}
+}
+
+// serverRef returns the reference to the branch of the repository. Bitbucket Server requires the repository and its project in the references of the pull-request
+func serverRef(project string, repository string, branchName string) bitbucketrelease_dto.ServerRef {
+	return bitbucketrelease_dto.ServerRef{
+		ID: serverBranchPrefix + branchName,
+		Repository: &bitbucketrelease_dto.ServerRepository{
+			Slug:    repository,
+			Project: bitbucketrelease_dto.ServerProject{Key: project},
+		},
+	}
+}
+
+// serverPullRequest converts Bitbucket Server pull-request. The usernames are used as the user IDs
+func serverPullRequest(pullRequest bitbucketrelease_dto.ServerPullRequest) bitbucketrelease_dto.ProviderPullRequest {
+	var result = bitbucketrelease_dto.ProviderPullRequest{
+		ID:                pullRequest.ID,
+		Title:             pullRequest.Title,
+		Description:       pullRequest.Description,
+		State:             pullRequest.State,
+		Author:            serverUser(pullRequest.Author.User),
+		SourceBranch:      pullRequest.FromRef.DisplayID,
+		SourceCommit:      pullRequest.FromRef.LatestCommit,
+		DestinationBranch: pullRequest.ToRef.DisplayID,
+		MergeCommit:       pullRequest.Properties.MergeCommit.ID,
+	}
+
+	if pullRequest.FromRef.Repository != nil {
+		result.RepositorySlug = pullRequest.FromRef.Repository.Slug
+	}
+
+	if len(pullRequest.Links.Self) > 0 {
+		result.Link = pullRequest.Links.Self[0].Href
+	}
+
+	for _, participant := range append(pullRequest.Reviewers, pullRequest.Participants...) {
+		if participant.Approved {
+			result.ApprovedBy = append(result.ApprovedBy, serverUser(participant.User))
+		}
+	}
+
+	return result
+}
+
+func serverUser(user bitbucketrelease_dto.ServerUser) bitbucketrelease_dto.ProviderUser {
+	return bitbucketrelease_dto.ProviderUser{ID: user.Name, Name: user.DisplayName}
+}
@@ -0,0 +1,98 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/client"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrepareServers(t *testing.T) {
+	servers := []bitbucketrelease_dto.ProviderHost{
+		{Host: "git.example.com"},
+		{Host: "github.com", Type: bitbucketrelease_dto.ProviderGitHub},
+		{Host: "gitlab.example.com", Type: bitbucketrelease_dto.ProviderGitLab, URL: "https://gitlab.example.com/api/v4/"},
+	}
+
+	if err := prepareServers(servers); err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	expected := []bitbucketrelease_dto.ProviderHost{
+		{Host: "git.example.com", Type: bitbucketrelease_dto.ProviderBitBucketServer, URL: "https://git.example.com"},
+		{Host: "github.com", Type: bitbucketrelease_dto.ProviderGitHub, URL: "https://api.github.com"},
+		{Host: "gitlab.example.com", Type: bitbucketrelease_dto.ProviderGitLab, URL: "https://gitlab.example.com/api/v4"},
+	}
+
+	for i, server := range servers {
+		if server.Type != expected[i].Type || server.URL != expected[i].URL {
+			t.Errorf("expected %+v, got %+v", expected[i], server)
+		}
+	}
+
+	if err := prepareServers([]bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", Type: "svn"}}); err == nil || !strings.Contains(err.Error(), "The provider type svn is not supported.") {
+		t.Errorf("expected the error of unknown provider type, got %v", err)
+	}
+
+	if err := prepareServers([]bitbucketrelease_dto.ProviderHost{{Type: bitbucketrelease_dto.ProviderGitHub}}); err == nil {
+		t.Error("expected the error of the provider without the host")
+	}
+}
+
+func TestProviderHostFor(t *testing.T) {
+	previous := releaseConfig
+	t.Cleanup(func() {
+		releaseConfig = previous
+	})
+
+	releaseConfig = &bitbucketrelease_dto.Config{Servers: []bitbucketrelease_dto.ProviderHost{{Host: "git.example.com", URL: "https://git.example.com"}}}
+
+	if host, ok := ProviderHostFor("Git.Example.com"); !ok || host.URL != "https://git.example.com" {
+		t.Errorf("expected the configured host, got %+v", host)
+	}
+
+	if !IsBitBucketCloud("") || IsBitBucketCloud("git.example.com") || !IsBitBucketCloud("unknown.example.com") {
+		t.Error("expected only the configured hosts to be served by other providers")
+	}
+}
+
+func TestBitBucketServerMergePullRequest(t *testing.T) {
+	var merge map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/rest/api/1.0/projects/PRJ/repos/api/pull-requests/7") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(`{"id": 7, "version": 3, "state": "OPEN"}`))
+			return
+		}
+
+		if r.URL.Query().Get("version") != "3" {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+
+		_ = json.NewDecoder(r.Body).Decode(&merge)
+		_, _ = w.Write([]byte(`{"id": 7, "version": 4, "state": "MERGED", "properties": {"mergeCommit": {"id": "abc"}}, "toRef": {"displayId": "master"}, "links": {"self": [{"href": "https://git.example.com/projects/PRJ/repos/api/pull-requests/7"}]}}`))
+	}))
+	defer server.Close()
+
+	pullRequest, err := newBitBucketServerProvider(bitbucketrelease_dto.ProviderHost{URL: server.URL}).MergePullRequest(context.Background(), "PRJ", "api", 7, "Release", client.StrategySquash)
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if pullRequest.State != bitbucketrelease_dto.ProviderPullRequestStateMerged || pullRequest.MergeCommit != "abc" || pullRequest.DestinationBranch != "master" || pullRequest.Link == "" {
+		t.Errorf("expected the merged pull-request, got %+v", pullRequest)
+	}
+
+	if merge["strategyId"] != serverStrategySquash || merge["message"] != "Release" {
+		t.Errorf("expected the squash merge with the message, got %v", merge)
+	}
+}
@@ -1,18 +1,16 @@
 package bitbucket_release_services
 
 import (
+	"context"
 	"fmt"
 	"github.com/pkg/errors"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
 	"github.com/sharovik/devbot/internal/client"
-	"github.com/sharovik/devbot/internal/container"
-	"github.com/sharovik/devbot/internal/dto"
-	"github.com/sharovik/devbot/internal/helper"
 	"github.com/sharovik/devbot/internal/log"
 	"strings"
 )
 
-func MergePullRequests(pullRequests map[string]bitbucketrelease_dto.PullRequest, strategy string) (string, error) {
+func MergePullRequests(release *bitbucketrelease_dto.Release, pullRequests []bitbucketrelease_dto.PullRequest, strategy string) (string, error) {
 	var (
 		releaseText     string
 		repository      = ""
@@ -26,12 +24,12 @@ func MergePullRequests(pullRequests map[string]bitbucketrelease_dto.PullRequest,
 			repository = pullRequest.RepositorySlug
 		}
 
-		if isReleaseBranchName(pullRequest.BranchName) {
-			strategy = client.StrategyMerge
+		pullRequestStrategy := mergeStrategy(pullRequest, strategy)
+		if pullRequestStrategy != strategy {
 			releaseText += fmt.Sprintf("I merge `#%d` pull-request using `merge` strategy, because it is a release pull-request.\n", pullRequest.ID)
 		}
 
-		response, err := container.C.BibBucketClient.MergePullRequest(pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID, pullRequest.Description, strategy)
+		response, err := ProviderFor(pullRequest.Host).MergePullRequest(context.Background(), pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID, pullRequest.Description, pullRequestStrategy)
 		if err != nil {
 			releaseText += fmt.Sprintf("I cannot merge the pull-request #%d because of error `%s`", pullRequest.ID, err.Error())
 			log.Logger().Info().
@@ -40,6 +38,7 @@ func MergePullRequests(pullRequests map[string]bitbucketrelease_dto.PullRequest,
 				Err(err).
 				Int64("pull_request_id", pullRequest.ID).
 				Msg("Failed to merge pull-request")
+			release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, err.Error())
 			return releaseText, err
 		}
 
@@ -47,6 +46,8 @@ func MergePullRequests(pullRequests map[string]bitbucketrelease_dto.PullRequest,
 			Interface("response", response).
 			Int64("pull_request_id", pullRequest.ID).
 			Msg("Merged pull-request")
+
+		release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMerged, "").MergeCommit = response.MergeCommit
 	}
 
 	if len(pullRequests) == 1 {
@@ -59,15 +60,13 @@ func MergePullRequests(pullRequests map[string]bitbucketrelease_dto.PullRequest,
 	return releaseText, nil
 }
 
-func isReleaseBranchName(branchName string) bool {
-	found, err := helper.IsFoundMatches("(?i)^(release\\/\\w+)", branchName)
-	if err != nil {
-		log.Logger().AddError(err).
-			Str("branch", branchName).
-			Msg("Failed to find the release-branch matches in the branch name.")
+// mergeStrategy returns the strategy which will be used for the selected pull-request. Release pull-requests are always merged using merge strategy
+func mergeStrategy(pullRequest bitbucketrelease_dto.PullRequest, strategy string) string {
+	if isReleaseBranchName(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.BranchName) {
+		return client.StrategyMerge
 	}
 
-	return found
+	return strategy
 }
 
 func prepareReleaseTitle(currentTitle string) string {
@@ -78,33 +77,24 @@ func prepareReleaseTitle(currentTitle string) string {
 	return currentTitle
 }
 
-func createReleasePullRequest(workspace string, repository string, releaseBranch dto.BitBucketResponseBranchCreate, description string) (string, error) {
-	bitBucketPullRequestCreate := dto.BitBucketRequestPullRequestCreate{
-		Title:       "Release pull-request",
-		Description: description,
-		Source: dto.BitBucketPullRequestDestination{
-			Branch: dto.BitBucketPullRequestDestinationBranch{
-				Name: releaseBranch.Name,
-			},
-		},
-	}
-
-	//Append reviewers to this pull-request except the author of the branch(which is current user)
-	for _, reviewerUuID := range container.C.Config.BitBucketConfig.RequiredReviewers {
-		if reviewerUuID.UUID != container.C.Config.BitBucketConfig.CurrentUserUUID {
-			bitBucketPullRequestCreate.Reviewers = append(bitBucketPullRequestCreate.Reviewers, dto.BitBucketReviewer{UUID: reviewerUuID.UUID})
-		}
+func createReleasePullRequest(host string, workspace string, repository string, releaseBranch bitbucketrelease_dto.ProviderBranch, config bitbucketrelease_dto.RepositoryConfig, target string, description string) (bitbucketrelease_dto.ProviderPullRequest, error) {
+	pullRequestCreate := bitbucketrelease_dto.ProviderPullRequestCreate{
+		Title:             releasePullRequestTitle(config, repository, releaseBranch.Name),
+		Description:       description,
+		SourceBranch:      releaseBranch.Name,
+		DestinationBranch: target,
+		Reviewers:         releaseReviewers(host, config),
 	}
 
-	response, err := container.C.BibBucketClient.CreatePullRequest(workspace, repository, bitBucketPullRequestCreate)
+	response, err := ProviderFor(host).CreatePullRequest(context.Background(), workspace, repository, pullRequestCreate)
 	if err != nil {
-		return "", err
+		return response, err
 	}
 
-	if response.Links.HTML.Href == "" {
+	if response.Link == "" {
 		log.Logger().Warn().Interface("response", response).Msg("There is no pull-request link in response.")
-		return "", errors.New("The pull-request link was not found in the response. ")
+		return response, errors.New("The pull-request link was not found in the response. ")
 	}
 
-	return response.Links.HTML.Href, nil
+	return response, nil
 }
@@ -0,0 +1,275 @@
+package bitbucket_release_services
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"net/url"
+	"regexp"
+	"strconv"
+)
+
+const (
+	versionMajor = "major"
+	versionMinor = "minor"
+	versionPatch = "patch"
+
+	//versionNone the bump rule, when the pull-request type doesn't change the version
+	versionNone = "none"
+
+	//pullRequestTypeBreaking the key of the bump rule for the breaking changes
+	pullRequestTypeBreaking = "breaking"
+
+	defaultInitialVersion = "0.1.0"
+)
+
+// Version the semantic version
+type Version struct {
+	Major int64
+	Minor int64
+	Patch int64
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Bump returns the next version, where the selected part is incremented
+func (v Version) Bump(part string) Version {
+	switch part {
+	case versionMajor:
+		return Version{Major: v.Major + 1}
+	case versionMinor:
+		return Version{Major: v.Major, Minor: v.Minor + 1}
+	default:
+		return Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1}
+	}
+}
+
+// Less returns true when the version is lower than the selected version
+func (v Version) Less(version Version) bool {
+	if v.Major != version.Major {
+		return v.Major < version.Major
+	}
+
+	if v.Minor != version.Minor {
+		return v.Minor < version.Minor
+	}
+
+	return v.Patch < version.Patch
+}
+
+var (
+	defaultBumps = map[string]string{
+		pullRequestTypeBreaking: versionMajor,
+		PullRequestTypeFeature:  versionMinor,
+		PullRequestTypeFix:      versionPatch,
+		PullRequestTypeChore:    versionPatch,
+	}
+
+	versionPriority = map[string]int{
+		versionNone:  0,
+		versionPatch: 1,
+		versionMinor: 2,
+		versionMajor: 3,
+	}
+
+	//errNoVersionBump the merged pull-requests don't change the version, so the tag is not needed
+	errNoVersionBump = errors.New("There are no pull-requests, which bump the version.")
+)
+
+// VersioningPolicyFor returns the versioning policy of the selected repository
+func VersioningPolicyFor(host string, workspace string, repository string) bitbucketrelease_dto.VersioningPolicy {
+	if policy := RepositoryConfigFor(host, workspace, repository).Versioning; policy != nil {
+		return *policy
+	}
+
+	return bitbucketrelease_dto.VersioningPolicy{}
+}
+
+// validateVersioningPolicy checks the pull-request types and the version parts of the bump rules
+func validateVersioningPolicy(key string, policy *bitbucketrelease_dto.VersioningPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	for pullRequestType, part := range policy.Bumps {
+		if _, ok := defaultBumps[pullRequestType]; !ok {
+			return fmt.Errorf("The pull-request type `%s` in the versioning bumps of `%s` configuration is not supported. Please use `breaking`, `feature`, `fix` or `chore`.", pullRequestType, key)
+		}
+
+		if _, ok := versionPriority[part]; !ok {
+			return fmt.Errorf("The version part `%s` in the versioning bumps of `%s` configuration is not supported. Please use `major`, `minor`, `patch` or `none`.", part, key)
+		}
+	}
+
+	if _, ok := ParseVersion("", initialVersion(*policy)); !ok {
+		return fmt.Errorf("The initial version `%s` of `%s` configuration is not a semantic version.", policy.InitialVersion, key)
+	}
+
+	return nil
+}
+
+func initialVersion(policy bitbucketrelease_dto.VersioningPolicy) string {
+	if policy.InitialVersion == "" {
+		return defaultInitialVersion
+	}
+
+	return policy.InitialVersion
+}
+
+// ParseVersion parses the semantic version from the tag name with the selected prefix
+func ParseVersion(prefix string, tagName string) (Version, bool) {
+	matches := regexp.MustCompile(fmt.Sprintf(`^%s(\d+)\.(\d+)\.(\d+)$`, regexp.QuoteMeta(prefix))).FindStringSubmatch(tagName)
+	if len(matches) != 4 {
+		return Version{}, false
+	}
+
+	var (
+		version Version
+		err     error
+	)
+
+	if version.Major, err = strconv.ParseInt(matches[1], 10, 64); err != nil {
+		return Version{}, false
+	}
+
+	if version.Minor, err = strconv.ParseInt(matches[2], 10, 64); err != nil {
+		return Version{}, false
+	}
+
+	if version.Patch, err = strconv.ParseInt(matches[3], 10, 64); err != nil {
+		return Version{}, false
+	}
+
+	return version, true
+}
+
+// NextVersion returns the next version for the merged pull-requests. The part of the version is selected by the most significant pull-request type.
+// Returns errNoVersionBump, when all pull-requests have the types, which don't change the version
+func NextVersion(policy bitbucketrelease_dto.VersioningPolicy, latest Version, hasLatest bool, pullRequests []bitbucketrelease_dto.PullRequest) (Version, error) {
+	if !hasLatest {
+		version, ok := ParseVersion("", initialVersion(policy))
+		if !ok {
+			return Version{}, fmt.Errorf("The initial version `%s` is not a semantic version.", initialVersion(policy))
+		}
+
+		return version, nil
+	}
+
+	var part = versionNone
+	for _, pullRequest := range pullRequests {
+		pullRequestType := PullRequestType(pullRequest)
+		if IsBreakingChange(pullRequest) {
+			pullRequestType = pullRequestTypeBreaking
+		}
+
+		bump := defaultBumps[pullRequestType]
+		if policyBump, ok := policy.Bumps[pullRequestType]; ok {
+			bump = policyBump
+		}
+
+		if versionPriority[bump] > versionPriority[part] {
+			part = bump
+		}
+	}
+
+	if part == versionNone {
+		return Version{}, errNoVersionBump
+	}
+
+	return latest.Bump(part), nil
+}
+
+// LatestVersion returns the highest semantic version from the repository tags
+func LatestVersion(ctx context.Context, workspace string, repository string, prefix string) (Version, bool, error) {
+	var (
+		latest    Version
+		hasLatest bool
+		endpoint  = fmt.Sprintf("/repositories/%s/%s/refs/tags?pagelen=100", workspace, repository)
+	)
+
+	for endpoint != "" {
+		var response bitbucketrelease_dto.TagsResponse
+		if err := api.request(ctx, "GET", endpoint, nil, &response); err != nil {
+			return Version{}, false, err
+		}
+
+		for _, tag := range response.Values {
+			version, ok := ParseVersion(prefix, tag.Name)
+			if !ok {
+				continue
+			}
+
+			if !hasLatest || latest.Less(version) {
+				latest = version
+				hasLatest = true
+			}
+		}
+
+		endpoint = response.Next
+	}
+
+	return latest, hasLatest, nil
+}
+
+// TagRelease creates the next semantic version tag on the merge commit. Returns empty tag name when the versioning is disabled for the repository
+func TagRelease(host string, workspace string, repository string, commitHash string, pullRequests []bitbucketrelease_dto.PullRequest) (string, error) {
+	policy := VersioningPolicyFor(host, workspace, repository)
+	if !policy.Enabled {
+		return "", nil
+	}
+
+	if !IsBitBucketCloud(host) {
+		return "", errNotSupportedByProvider
+	}
+
+	if commitHash == "" {
+		return "", errors.New("The merge commit is unknown, so the tag cannot be created.")
+	}
+
+	ctx := context.Background()
+
+	latest, hasLatest, err := LatestVersion(ctx, workspace, repository, policy.TagPrefix)
+	if err != nil {
+		return "", errors.Wrap(err, "Failed to get the latest version tag")
+	}
+
+	version, err := NextVersion(policy, latest, hasLatest, pullRequests)
+	if err == errNoVersionBump {
+		log.Logger().Info().Str("repository", repository).Msg("The merged pull-requests don't bump the version, so the tag is not created")
+		return "", nil
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	tag := bitbucketrelease_dto.Tag{
+		Name:   policy.TagPrefix + version.String(),
+		Target: bitbucketrelease_dto.CommitParent{Hash: commitHash},
+	}
+
+	//The tag creation is not idempotent, so before the next attempt we check, that the tag was not created by the previous one
+	endpoint := fmt.Sprintf("/repositories/%s/%s/refs/tags", workspace, repository)
+	err = withCheckedRetry(ctx, fmt.Sprintf("tag %s creation", tag.Name), func(ctx context.Context) bool {
+		var created bitbucketrelease_dto.Tag
+		err := api.request(ctx, "GET", fmt.Sprintf("%s/%s", endpoint, url.PathEscape(tag.Name)), nil, &created)
+		return err == nil && sameCommit(created.Target.Hash, commitHash)
+	}, func() error {
+		return api.request(ctx, "POST", endpoint, tag, nil)
+	})
+	if err != nil {
+		return "", errors.Wrap(err, fmt.Sprintf("Failed to create the tag %s", tag.Name))
+	}
+
+	log.Logger().Info().
+		Str("repository", repository).
+		Str("tag", tag.Name).
+		Str("commit", commitHash).
+		Msg("Created release tag")
+
+	return tag.Name, nil
+}
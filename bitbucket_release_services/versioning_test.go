@@ -0,0 +1,120 @@
+package bitbucket_release_services
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	cases := []struct {
+		prefix   string
+		tag      string
+		ok       bool
+		expected Version
+	}{
+		{prefix: "v", tag: "v1.2.3", ok: true, expected: Version{Major: 1, Minor: 2, Patch: 3}},
+		{prefix: "", tag: "10.0.12", ok: true, expected: Version{Major: 10, Patch: 12}},
+		{prefix: "release-", tag: "release-0.1.0", ok: true, expected: Version{Minor: 1}},
+		{prefix: "v", tag: "1.2.3"},
+		{prefix: "v", tag: "v1.2"},
+		{prefix: "v", tag: "v1.2.3-rc.1"},
+		{prefix: "v", tag: "v1.2.x"},
+		{prefix: ".", tag: "x1.2.3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.prefix+" "+c.tag, func(t *testing.T) {
+			version, ok := ParseVersion(c.prefix, c.tag)
+			if ok != c.ok || version != c.expected {
+				t.Errorf("expected %s (%t), got %s (%t)", c.expected, c.ok, version, ok)
+			}
+		})
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	if !(Version{Major: 1, Minor: 9, Patch: 9}).Less(Version{Major: 2}) {
+		t.Error("expected 1.9.9 to be lower than 2.0.0")
+	}
+
+	if (Version{Major: 1, Minor: 10}).Less(Version{Major: 1, Minor: 9, Patch: 1}) {
+		t.Error("expected 1.10.0 to be higher than 1.9.1")
+	}
+}
+
+func TestNextVersion(t *testing.T) {
+	var (
+		latest   = Version{Major: 1, Minor: 2, Patch: 3}
+		feature  = bitbucketrelease_dto.PullRequest{Title: "feat: new endpoint"}
+		fix      = bitbucketrelease_dto.PullRequest{Title: "fix: wrong response"}
+		chore    = bitbucketrelease_dto.PullRequest{Title: "Update README"}
+		breaking = bitbucketrelease_dto.PullRequest{Title: "fix!: drop v1"}
+		fixture  = bitbucketrelease_dto.PullRequest{Title: "fixture: new test data"}
+	)
+
+	cases := []struct {
+		name         string
+		policy       bitbucketrelease_dto.VersioningPolicy
+		hasLatest    bool
+		pullRequests []bitbucketrelease_dto.PullRequest
+		expected     Version
+		err          error
+	}{
+		{name: "initial version", pullRequests: []bitbucketrelease_dto.PullRequest{feature}, expected: Version{Minor: 1}},
+		{name: "configured initial version", policy: bitbucketrelease_dto.VersioningPolicy{InitialVersion: "1.0.0"}, expected: Version{Major: 1}},
+		{name: "fix", hasLatest: true, pullRequests: []bitbucketrelease_dto.PullRequest{fix, chore}, expected: Version{Major: 1, Minor: 2, Patch: 4}},
+		{name: "feature", hasLatest: true, pullRequests: []bitbucketrelease_dto.PullRequest{fix, feature}, expected: Version{Major: 1, Minor: 3}},
+		{name: "breaking change", hasLatest: true, pullRequests: []bitbucketrelease_dto.PullRequest{feature, breaking}, expected: Version{Major: 2}},
+		{name: "title without prefix", hasLatest: true, pullRequests: []bitbucketrelease_dto.PullRequest{fixture}, expected: Version{Major: 1, Minor: 2, Patch: 4}},
+		{
+			name:         "configured bump",
+			policy:       bitbucketrelease_dto.VersioningPolicy{Bumps: map[string]string{PullRequestTypeFix: versionMinor}},
+			hasLatest:    true,
+			pullRequests: []bitbucketrelease_dto.PullRequest{fix},
+			expected:     Version{Major: 1, Minor: 3},
+		},
+		{
+			name:         "no bump",
+			policy:       bitbucketrelease_dto.VersioningPolicy{Bumps: map[string]string{PullRequestTypeChore: versionNone}},
+			hasLatest:    true,
+			pullRequests: []bitbucketrelease_dto.PullRequest{chore},
+			err:          errNoVersionBump,
+		},
+		{name: "no pull-requests", hasLatest: true, err: errNoVersionBump},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			version, err := NextVersion(c.policy, latest, c.hasLatest, c.pullRequests)
+			if err != c.err {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+
+			if version != c.expected {
+				t.Errorf("expected %s, got %s", c.expected, version)
+			}
+		})
+	}
+}
+
+func TestValidateVersioningPolicy(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy bitbucketrelease_dto.VersioningPolicy
+		valid  bool
+	}{
+		{name: "default", valid: true},
+		{name: "bumps", policy: bitbucketrelease_dto.VersioningPolicy{Bumps: map[string]string{"breaking": "minor", "chore": "none"}}, valid: true},
+		{name: "unknown type", policy: bitbucketrelease_dto.VersioningPolicy{Bumps: map[string]string{"feat": "minor"}}},
+		{name: "unknown part", policy: bitbucketrelease_dto.VersioningPolicy{Bumps: map[string]string{"fix": "minr"}}},
+		{name: "wrong initial version", policy: bitbucketrelease_dto.VersioningPolicy{InitialVersion: "v1"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := validateVersioningPolicy("default", &c.policy); (err == nil) != c.valid {
+				t.Errorf("expected valid: %t, got %v", c.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package bitbucketrelease_dto
+
+// ApprovalPolicy the rules, which should be satisfied by the pull-request approvals before merge
+type ApprovalPolicy struct {
+	//MinApprovals the minimum number of approvals
+	MinApprovals int `json:"min_approvals"`
+
+	//RequiredApprovers the list of user UUIDs, who all must approve the pull-request
+	RequiredApprovers []string `json:"required_approvers"`
+
+	//Groups the groups of users, from which the selected number of approvals is required
+	Groups []ApprovalGroup `json:"groups"`
+
+	//ExcludeAuthor when true, the approval of the pull-request author is not counted
+	ExcludeAuthor bool `json:"exclude_author"`
+}
+
+// ApprovalGroup the group of users, from which any MinApprovals of approvals are required
+type ApprovalGroup struct {
+	Name         string   `json:"name"`
+	Members      []string `json:"members"`
+	MinApprovals int      `json:"min_approvals"`
+}
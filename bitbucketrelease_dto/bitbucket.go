@@ -0,0 +1,67 @@
+package bitbucketrelease_dto
+
+// BitBucketUser the user of bitbucket.org
+type BitBucketUser struct {
+	UUID        string `json:"uuid"`
+	DisplayName string `json:"display_name"`
+}
+
+// BitBucketParticipant the reviewer or participant of bitbucket.org pull-request
+type BitBucketParticipant struct {
+	User     BitBucketUser `json:"user"`
+	Approved bool          `json:"approved"`
+}
+
+// BitBucketBranchName the branch of bitbucket.org pull-request source or destination
+type BitBucketBranchName struct {
+	Name string `json:"name"`
+}
+
+// BitBucketRepository the repository of bitbucket.org pull-request source or destination
+type BitBucketRepository struct {
+	Name     string `json:"name"`
+	FullName string `json:"full_name"`
+}
+
+// BitBucketRef the source or destination of bitbucket.org pull-request
+type BitBucketRef struct {
+	Branch     BitBucketBranchName  `json:"branch"`
+	Commit     *CommitParent        `json:"commit,omitempty"`
+	Repository *BitBucketRepository `json:"repository,omitempty"`
+}
+
+// BitBucketLinks the links of bitbucket.org object
+type BitBucketLinks struct {
+	HTML struct {
+		Href string `json:"href"`
+	} `json:"html"`
+}
+
+// BitBucketPullRequest the pull-request of bitbucket.org
+type BitBucketPullRequest struct {
+	ID           int64                  `json:"id"`
+	Title        string                 `json:"title"`
+	Description  string                 `json:"description"`
+	State        string                 `json:"state"`
+	Author       BitBucketUser          `json:"author"`
+	Source       BitBucketRef           `json:"source"`
+	Destination  BitBucketRef           `json:"destination"`
+	MergeCommit  *CommitParent          `json:"merge_commit"`
+	Links        BitBucketLinks         `json:"links"`
+	Participants []BitBucketParticipant `json:"participants"`
+}
+
+// BitBucketReviewer the reviewer of bitbucket.org pull-request creation request
+type BitBucketReviewer struct {
+	UUID string `json:"uuid"`
+}
+
+// BitBucketPullRequestCreate the request of bitbucket.org pull-request creation
+type BitBucketPullRequestCreate struct {
+	Title             string              `json:"title"`
+	Description       string              `json:"description"`
+	Source            BitBucketRef        `json:"source"`
+	Destination       *BitBucketRef       `json:"destination,omitempty"`
+	Reviewers         []BitBucketReviewer `json:"reviewers,omitempty"`
+	CloseSourceBranch bool                `json:"close_source_branch"`
+}
@@ -0,0 +1,24 @@
+package bitbucketrelease_dto
+
+// BuildStatus the status of the build for the commit
+type BuildStatus struct {
+	Key   string `json:"key"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+	URL   string `json:"url"`
+}
+
+// BuildStatusesResponse the response of BitBucket commit statuses endpoint
+type BuildStatusesResponse struct {
+	Values []BuildStatus `json:"values"`
+	Next   string        `json:"next"`
+}
+
+// BuildStatusPolicy the rules for the build statuses of the pull-request source commit
+type BuildStatusPolicy struct {
+	//Disabled when true, the build statuses are not checked
+	Disabled bool `json:"disabled"`
+
+	//RequiredKeys the keys of the statuses, which must be present and successful
+	RequiredKeys []string `json:"required_keys"`
+}
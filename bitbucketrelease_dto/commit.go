@@ -0,0 +1,37 @@
+package bitbucketrelease_dto
+
+// Commit the commit of the repository
+type Commit struct {
+	Hash    string         `json:"hash"`
+	Message string         `json:"message"`
+	Parents []CommitParent `json:"parents"`
+}
+
+// CommitParent the parent of the commit
+type CommitParent struct {
+	Hash string `json:"hash"`
+}
+
+// DiffStat the change of one file in the commit
+type DiffStat struct {
+	Status string        `json:"status"`
+	Old    *DiffStatPath `json:"old"`
+	New    *DiffStatPath `json:"new"`
+}
+
+// DiffStatPath the path of the changed file
+type DiffStatPath struct {
+	Path string `json:"path"`
+}
+
+// DiffStatResponse the response of BitBucket diffstat endpoint
+type DiffStatResponse struct {
+	Values []DiffStat `json:"values"`
+	Next   string     `json:"next"`
+}
+
+// Branch the branch of the repository
+type Branch struct {
+	Name   string       `json:"name"`
+	Target CommitParent `json:"target"`
+}
@@ -0,0 +1,74 @@
+package bitbucketrelease_dto
+
+// GitHubUser the user of GitHub
+type GitHubUser struct {
+	Login string `json:"login"`
+}
+
+// GitHubRef the head or the base of GitHub pull-request
+type GitHubRef struct {
+	Ref  string           `json:"ref"`
+	SHA  string           `json:"sha"`
+	Repo GitHubRepository `json:"repo"`
+}
+
+// GitHubRepository the repository of GitHub
+type GitHubRepository struct {
+	Name          string `json:"name"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// GitHubPullRequest the pull-request of GitHub
+type GitHubPullRequest struct {
+	Number         int64      `json:"number"`
+	Title          string     `json:"title"`
+	Body           string     `json:"body"`
+	State          string     `json:"state"`
+	Merged         bool       `json:"merged"`
+	MergeCommitSHA string     `json:"merge_commit_sha"`
+	HTMLURL        string     `json:"html_url"`
+	User           GitHubUser `json:"user"`
+	Head           GitHubRef  `json:"head"`
+	Base           GitHubRef  `json:"base"`
+}
+
+// GitHubReview the review of GitHub pull-request
+type GitHubReview struct {
+	User  GitHubUser `json:"user"`
+	State string     `json:"state"`
+}
+
+// GitHubMergeResponse the response of GitHub pull-request merge endpoint
+type GitHubMergeResponse struct {
+	SHA    string `json:"sha"`
+	Merged bool   `json:"merged"`
+}
+
+// GitHubGitRef the git reference of GitHub repository
+type GitHubGitRef struct {
+	Ref    string `json:"ref"`
+	Object struct {
+		SHA string `json:"sha"`
+	} `json:"object"`
+}
+
+// GitHubCombinedStatus the combined commit status of GitHub
+type GitHubCombinedStatus struct {
+	TotalCount int `json:"total_count"`
+	Statuses   []struct {
+		Context   string `json:"context"`
+		State     string `json:"state"`
+		TargetURL string `json:"target_url"`
+	} `json:"statuses"`
+}
+
+// GitHubCheckRuns the check runs of GitHub commit
+type GitHubCheckRuns struct {
+	TotalCount int `json:"total_count"`
+	CheckRuns  []struct {
+		Name       string `json:"name"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		HTMLURL    string `json:"html_url"`
+	} `json:"check_runs"`
+}
@@ -0,0 +1,51 @@
+package bitbucketrelease_dto
+
+// GitLabUser the user of GitLab
+type GitLabUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// GitLabMergeRequest the merge request of GitLab
+type GitLabMergeRequest struct {
+	IID             int64      `json:"iid"`
+	Title           string     `json:"title"`
+	Description     string     `json:"description"`
+	State           string     `json:"state"`
+	SourceBranch    string     `json:"source_branch"`
+	TargetBranch    string     `json:"target_branch"`
+	SHA             string     `json:"sha"`
+	MergeCommitSHA  string     `json:"merge_commit_sha"`
+	SquashCommitSHA string     `json:"squash_commit_sha"`
+	WebURL          string     `json:"web_url"`
+	Author          GitLabUser `json:"author"`
+}
+
+// GitLabApprovals the approvals of GitLab merge request
+type GitLabApprovals struct {
+	ApprovedBy []struct {
+		User GitLabUser `json:"user"`
+	} `json:"approved_by"`
+}
+
+// GitLabProject the project of GitLab
+type GitLabProject struct {
+	Path          string `json:"path"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+// GitLabBranch the branch of GitLab project
+type GitLabBranch struct {
+	Name   string `json:"name"`
+	Commit struct {
+		ID string `json:"id"`
+	} `json:"commit"`
+}
+
+// GitLabCommitStatus the pipeline job status of GitLab commit
+type GitLabCommitStatus struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	TargetURL string `json:"target_url"`
+}
@@ -0,0 +1,149 @@
+package bitbucketrelease_dto
+
+// RepositoryKey identifies the repository of VCS provider
+type RepositoryKey struct {
+	//Host the host of VCS provider. It is empty for bitbucket.org repositories
+	Host string
+
+	Workspace      string
+	RepositorySlug string
+}
+
+// Less returns true when the repository goes before the selected repository in the sorted lists
+func (k RepositoryKey) Less(key RepositoryKey) bool {
+	if k.RepositorySlug != key.RepositorySlug {
+		return k.RepositorySlug < key.RepositorySlug
+	}
+
+	if k.Workspace != key.Workspace {
+		return k.Workspace < key.Workspace
+	}
+
+	return k.Host < key.Host
+}
+
+// MergePlan the pull-requests, which can be merged, grouped by repository. The repositories and the pull-requests keep the order, in which they were received in the message
+type MergePlan struct {
+	Repositories []RepositoryMergePlan
+}
+
+// RepositoryMergePlan the pull-requests of one repository, which can be merged
+type RepositoryMergePlan struct {
+	//Host the host of Bitbucket Server. It is empty for bitbucket.org repositories
+	Host string
+
+	Workspace      string
+	RepositorySlug string
+	PullRequests   []PullRequest
+
+	//DependsOn the repositories, which should be released before this repository, sorted by name
+	DependsOn []RepositoryKey
+}
+
+// Key returns the key of the repository
+func (p RepositoryMergePlan) Key() RepositoryKey {
+	return RepositoryKey{Host: p.Host, Workspace: p.Workspace, RepositorySlug: p.RepositorySlug}
+}
+
+// Is returns true when it is the plan of the selected repository
+func (p RepositoryMergePlan) Is(host string, workspace string, repository string) bool {
+	return p.Host == host && p.Workspace == workspace && p.RepositorySlug == repository
+}
+
+// Add appends the pull-request to the plan of its repository. The slices of the plan are copied, so the copies of the plan, which were taken before, are not changed
+func (p *MergePlan) Add(pullRequest PullRequest) {
+	p.Repositories = append([]RepositoryMergePlan{}, p.Repositories...)
+	for i := range p.Repositories {
+		if p.Repositories[i].Is(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug) {
+			p.Repositories[i].PullRequests = append(append([]PullRequest{}, p.Repositories[i].PullRequests...), pullRequest)
+			return
+		}
+	}
+
+	p.Repositories = append(p.Repositories, RepositoryMergePlan{
+		Host:           pullRequest.Host,
+		Workspace:      pullRequest.Workspace,
+		RepositorySlug: pullRequest.RepositorySlug,
+		PullRequests:   []PullRequest{pullRequest},
+	})
+}
+
+// RemoveRepository removes the repository with all its pull-requests from the plan. The slices of the plan are copied
+func (p *MergePlan) RemoveRepository(host string, workspace string, repository string) {
+	for i := range p.Repositories {
+		if p.Repositories[i].Is(host, workspace, repository) {
+			p.Repositories = removeRepositoryMergePlan(p.Repositories, i)
+			return
+		}
+	}
+}
+
+// RemovePullRequest removes the pull-request from the plan. The repository without pull-requests is removed as well. The slices of the plan are copied
+func (p *MergePlan) RemovePullRequest(pullRequest PullRequest) {
+	for i := range p.Repositories {
+		for j, item := range p.Repositories[i].PullRequests {
+			if !item.Is(pullRequest) {
+				continue
+			}
+
+			pullRequests := make([]PullRequest, 0, len(p.Repositories[i].PullRequests)-1)
+			pullRequests = append(append(pullRequests, p.Repositories[i].PullRequests[:j]...), p.Repositories[i].PullRequests[j+1:]...)
+			if len(pullRequests) == 0 {
+				p.Repositories = removeRepositoryMergePlan(p.Repositories, i)
+				return
+			}
+
+			p.Repositories = append([]RepositoryMergePlan{}, p.Repositories...)
+			p.Repositories[i].PullRequests = pullRequests
+			return
+		}
+	}
+}
+
+// removeRepositoryMergePlan returns the copy of the repositories without the repository of the selected index
+func removeRepositoryMergePlan(repositories []RepositoryMergePlan, index int) []RepositoryMergePlan {
+	result := make([]RepositoryMergePlan, 0, len(repositories)-1)
+	return append(append(result, repositories[:index]...), repositories[index+1:]...)
+}
+
+// Contains returns true when the pull-request is in the plan
+func (p MergePlan) Contains(pullRequest PullRequest) bool {
+	for _, item := range p.PullRequests() {
+		if item.Is(pullRequest) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Repository returns the plan of the repository
+func (p MergePlan) Repository(host string, workspace string, repository string) (RepositoryMergePlan, bool) {
+	for _, item := range p.Repositories {
+		if item.Is(host, workspace, repository) {
+			return item, true
+		}
+	}
+
+	return RepositoryMergePlan{}, false
+}
+
+// PullRequests returns all pull-requests of the plan in the received order
+func (p MergePlan) PullRequests() []PullRequest {
+	var pullRequests []PullRequest
+	for _, item := range p.Repositories {
+		pullRequests = append(pullRequests, item.PullRequests...)
+	}
+
+	return pullRequests
+}
+
+// Len returns the number of pull-requests in the plan
+func (p MergePlan) Len() int {
+	var length = 0
+	for _, item := range p.Repositories {
+		length += len(item.PullRequests)
+	}
+
+	return length
+}
@@ -0,0 +1,63 @@
+package bitbucketrelease_dto
+
+import (
+	"testing"
+)
+
+func TestMergePlanKeepsCopies(t *testing.T) {
+	var plan MergePlan
+	plan.Add(PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 1})
+	plan.Add(PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 2})
+	plan.Add(PullRequest{Workspace: "my-workspace", RepositorySlug: "web", ID: 3})
+
+	cases := []struct {
+		name   string
+		change func(plan *MergePlan)
+		length int
+	}{
+		{
+			name: "add",
+			change: func(plan *MergePlan) {
+				plan.Add(PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 4})
+			},
+			length: 4,
+		},
+		{
+			name: "remove repository",
+			change: func(plan *MergePlan) {
+				plan.RemoveRepository("", "my-workspace", "api")
+			},
+			length: 1,
+		},
+		{
+			name: "remove pull-request",
+			change: func(plan *MergePlan) {
+				plan.RemovePullRequest(PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 1})
+			},
+			length: 2,
+		},
+		{
+			name: "remove last pull-request of repository",
+			change: func(plan *MergePlan) {
+				plan.RemovePullRequest(PullRequest{Workspace: "my-workspace", RepositorySlug: "web", ID: 3})
+			},
+			length: 2,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			changed := plan
+			c.change(&changed)
+
+			if changed.Len() != c.length {
+				t.Errorf("expected %d pull-requests in the changed plan, got %d", c.length, changed.Len())
+			}
+
+			pullRequests := plan.PullRequests()
+			if len(pullRequests) != 3 || pullRequests[0].ID != 1 || pullRequests[1].ID != 2 || pullRequests[2].ID != 3 {
+				t.Errorf("expected the original plan not to be changed, got %+v", pullRequests)
+			}
+		})
+	}
+}
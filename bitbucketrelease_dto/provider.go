@@ -0,0 +1,72 @@
+package bitbucketrelease_dto
+
+const (
+	//ProviderBitBucket the bitbucket.org provider
+	ProviderBitBucket = "bitbucket"
+
+	//ProviderBitBucketServer the self-hosted Bitbucket Server or Data Center provider
+	ProviderBitBucketServer = "bitbucket_server"
+
+	//ProviderGitHub the GitHub or GitHub Enterprise provider
+	ProviderGitHub = "github"
+
+	//ProviderGitLab the GitLab provider
+	ProviderGitLab = "gitlab"
+
+	//ProviderPullRequestStateOpen the state of the pull-request, which can be merged
+	ProviderPullRequestStateOpen = "OPEN"
+
+	//ProviderPullRequestStateMerged the state of the merged pull-request
+	ProviderPullRequestStateMerged = "MERGED"
+
+	//ProviderPullRequestStateDeclined the state of the closed pull-request, which was not merged
+	ProviderPullRequestStateDeclined = "DECLINED"
+)
+
+// ProviderUser the user of VCS provider. The ID is the UUID for bitbucket.org and the username for other providers
+type ProviderUser struct {
+	ID   string
+	Name string
+}
+
+// ProviderPullRequest the pull-request of VCS provider
+type ProviderPullRequest struct {
+	ID          int64
+	Title       string
+	Description string
+
+	//State one of ProviderPullRequestState* values
+	State string
+
+	Author ProviderUser
+
+	//ApprovedBy the users, who approved the pull-request
+	ApprovedBy []ProviderUser
+
+	RepositorySlug    string
+	SourceBranch      string
+	SourceCommit      string
+	DestinationBranch string
+	MergeCommit       string
+	Link              string
+}
+
+// ProviderBranch the branch of VCS provider
+type ProviderBranch struct {
+	Name string
+	Hash string
+}
+
+// ProviderPullRequestCreate the request for the pull-request creation
+type ProviderPullRequestCreate struct {
+	Title             string
+	Description       string
+	SourceBranch      string
+	DestinationBranch string
+
+	//Reviewers the user IDs of the reviewers
+	Reviewers []string
+
+	//CloseSourceBranch when true, the source branch is deleted after the merge. It is used by bitbucket.org only
+	CloseSourceBranch bool
+}
@@ -1,11 +1,43 @@
 package bitbucketrelease_dto
 
-//PullRequest the pull-request item
+import "fmt"
+
+// PullRequest the pull-request item
 type PullRequest struct {
-	ID             int64
-	RepositorySlug string
-	BranchName     string
-	Workspace      string
-	Title          string
-	Description    string
+	//Host the host of VCS provider. It is empty for bitbucket.org pull-requests
+	Host string
+
+	//Provider one of Provider* values. It is empty for bitbucket.org pull-requests
+	Provider string
+
+	ID                int64
+	RepositorySlug    string
+	BranchName        string
+	DestinationBranch string
+	Workspace         string
+	Title             string
+	Description       string
+	Author            string
+
+	//DependsOn the pull-requests, which should be merged before this pull-request. Defined by `Depends on {pull-request-link}` in the description
+	DependsOn []PullRequest
+}
+
+// URL returns the link to the pull-request
+func (p PullRequest) URL() string {
+	switch p.Provider {
+	case ProviderBitBucketServer:
+		return fmt.Sprintf("https://%s/projects/%s/repos/%s/pull-requests/%d", p.Host, p.Workspace, p.RepositorySlug, p.ID)
+	case ProviderGitHub:
+		return fmt.Sprintf("https://%s/%s/%s/pull/%d", p.Host, p.Workspace, p.RepositorySlug, p.ID)
+	case ProviderGitLab:
+		return fmt.Sprintf("https://%s/%s/%s/-/merge_requests/%d", p.Host, p.Workspace, p.RepositorySlug, p.ID)
+	}
+
+	return fmt.Sprintf("https://bitbucket.org/%s/%s/pull-requests/%d", p.Workspace, p.RepositorySlug, p.ID)
+}
+
+// Is returns true when both items are the same pull-request
+func (p PullRequest) Is(pullRequest PullRequest) bool {
+	return p.Host == pullRequest.Host && p.Workspace == pullRequest.Workspace && p.RepositorySlug == pullRequest.RepositorySlug && p.ID == pullRequest.ID
 }
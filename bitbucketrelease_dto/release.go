@@ -0,0 +1,190 @@
+package bitbucketrelease_dto
+
+import "time"
+
+const (
+	//ReleaseStatusInProgress the release is running
+	ReleaseStatusInProgress = "in_progress"
+
+	//ReleaseStatusFinished the release is finished, the result of each pull-request can be found in ReleasePullRequest
+	ReleaseStatusFinished = "finished"
+
+	//ReleaseStatusFailed the release is stopped because of error
+	ReleaseStatusFailed = "failed"
+
+	//PullRequestStatusCheckFailed the pull-request didn't pass the checks before merge
+	PullRequestStatusCheckFailed = "check_failed"
+
+	//PullRequestStatusMerged the pull-request was merged into destination or release branch
+	PullRequestStatusMerged = "merged"
+
+	//PullRequestStatusMergeFailed the pull-request passed the checks, but it cannot be merged
+	PullRequestStatusMergeFailed = "merge_failed"
+)
+
+// Release the run of the release triggered by the user
+type Release struct {
+	ID           int64
+	User         string
+	Channel      string
+	Status       string
+	Error        string
+	CreatedAt    time.Time
+	FinishedAt   time.Time
+	PullRequests []ReleasePullRequest
+
+	//ReleasePullRequests the release pull-requests, which were opened or reused by the release. They are watched for the automatic merge once the release is saved
+	ReleasePullRequests []PullRequest
+}
+
+// ReleasePullRequest the result of the pull-request in the release
+type ReleasePullRequest struct {
+	ID        int64
+	ReleaseID int64
+
+	//Host the host of VCS provider. It is empty for bitbucket.org repositories
+	Host string
+
+	Workspace              string
+	RepositorySlug         string
+	PullRequestID          int64
+	Title                  string
+	URL                    string
+	Status                 string
+	Reason                 string
+	DestinationBranch      string
+	MergeCommit            string
+	ReleaseBranch          string
+	ReleasePullRequestLink string
+}
+
+// Repository returns the key of the pull-request repository
+func (p ReleasePullRequest) Repository() RepositoryKey {
+	return RepositoryKey{Host: p.Host, Workspace: p.Workspace, RepositorySlug: p.RepositorySlug}
+}
+
+// Is returns true when it is the result of the selected pull-request
+func (p ReleasePullRequest) Is(pullRequest PullRequest) bool {
+	return p.Host == pullRequest.Host && p.Workspace == pullRequest.Workspace && p.RepositorySlug == pullRequest.RepositorySlug && p.PullRequestID == pullRequest.ID
+}
+
+// IsReleasePullRequest returns true when it is the result of the release pull-request, which merged the release branch into the destination branch
+func (p ReleasePullRequest) IsReleasePullRequest() bool {
+	return p.URL != "" && p.URL == p.ReleasePullRequestLink
+}
+
+// NewRelease creates the release, which is triggered by the user in the channel
+func NewRelease(user string, channel string) *Release {
+	return &Release{
+		User:      user,
+		Channel:   channel,
+		Status:    ReleaseStatusInProgress,
+		CreatedAt: time.Now(),
+	}
+}
+
+// SetPullRequestStatus sets the status of the pull-request in the release. If the pull-request is not in the release yet, it will be added
+func (r *Release) SetPullRequestStatus(pullRequest PullRequest, status string, reason string) *ReleasePullRequest {
+	if r == nil {
+		return &ReleasePullRequest{}
+	}
+
+	item := r.pullRequest(pullRequest)
+	item.Title = pullRequest.Title
+	item.DestinationBranch = pullRequest.DestinationBranch
+	item.Status = status
+	item.Reason = reason
+
+	return item
+}
+
+// SetReleaseBranch sets the release branch for all merged pull-requests of the repository
+func (r *Release) SetReleaseBranch(repository RepositoryKey, releaseBranch string, releasePullRequestLink string) {
+	if r == nil {
+		return
+	}
+
+	for i := range r.PullRequests {
+		if r.PullRequests[i].Repository() != repository || r.PullRequests[i].Status != PullRequestStatusMerged {
+			continue
+		}
+
+		if releaseBranch != "" {
+			r.PullRequests[i].ReleaseBranch = releaseBranch
+		}
+
+		if releasePullRequestLink != "" {
+			r.PullRequests[i].ReleasePullRequestLink = releasePullRequestLink
+		}
+	}
+}
+
+// AddReleasePullRequest adds the release pull-request, which was opened or reused by the release
+func (r *Release) AddReleasePullRequest(pullRequest PullRequest) {
+	if r == nil || pullRequest.ID == 0 {
+		return
+	}
+
+	for _, item := range r.ReleasePullRequests {
+		if item.Is(pullRequest) {
+			return
+		}
+	}
+
+	r.ReleasePullRequests = append(r.ReleasePullRequests, pullRequest)
+}
+
+// PullRequestResult returns the result of the pull-request in the release
+func (r *Release) PullRequestResult(pullRequest PullRequest) ReleasePullRequest {
+	if r == nil {
+		return ReleasePullRequest{}
+	}
+
+	for _, item := range r.PullRequests {
+		if item.Is(pullRequest) {
+			return item
+		}
+	}
+
+	return ReleasePullRequest{}
+}
+
+// Finish marks the release as finished. When err is not nil the release will be marked as failed
+func (r *Release) Finish(err error) {
+	if r == nil {
+		return
+	}
+
+	r.FinishedAt = time.Now()
+	r.Status = ReleaseStatusFinished
+	if err != nil {
+		r.Status = ReleaseStatusFailed
+		r.Error = err.Error()
+	}
+}
+
+func (r *Release) pullRequest(pullRequest PullRequest) *ReleasePullRequest {
+	for i := range r.PullRequests {
+		item := &r.PullRequests[i]
+		if item.Is(pullRequest) {
+			return item
+		}
+	}
+
+	r.PullRequests = append(r.PullRequests, ReleasePullRequest{
+		Host:           pullRequest.Host,
+		Workspace:      pullRequest.Workspace,
+		RepositorySlug: pullRequest.RepositorySlug,
+		PullRequestID:  pullRequest.ID,
+		URL:            pullRequest.URL(),
+	})
+
+	return &r.PullRequests[len(r.PullRequests)-1]
+}
+
+// ReleaseFilter the filter for the releases history
+type ReleaseFilter struct {
+	Limit      int64
+	Repository string
+	User       string
+}
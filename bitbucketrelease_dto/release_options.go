@@ -0,0 +1,16 @@
+package bitbucketrelease_dto
+
+// ReleaseOptions the options of the release, which are defined by the flags of the release command
+type ReleaseOptions struct {
+	//Strategy the merge strategy of the pull-requests. The squash strategy is used when it is empty
+	Strategy string
+
+	//Target the branch, into which the pull-requests are released. The main branch is used when it is empty
+	Target string
+
+	//NoReleasePullRequest when true, the pull-requests are merged directly without the release branch and the release pull-request
+	NoReleasePullRequest bool
+
+	//AllOrNothing when true, the release is stopped by the first failed repository. The release pull-request is not opened for the partially merged repository
+	AllOrNothing bool
+}
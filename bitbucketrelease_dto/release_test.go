@@ -0,0 +1,50 @@
+package bitbucketrelease_dto
+
+import (
+	"testing"
+)
+
+func TestReleaseKeepsPullRequestsOfHosts(t *testing.T) {
+	var (
+		release = NewRelease("U1", "C1")
+		cloud   = PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 1}
+		server  = PullRequest{Host: "git.example.com", Provider: ProviderBitBucketServer, Workspace: "my-workspace", RepositorySlug: "api", ID: 1}
+	)
+
+	release.SetPullRequestStatus(cloud, PullRequestStatusMerged, "")
+	release.SetPullRequestStatus(server, PullRequestStatusMerged, "")
+	release.SetReleaseBranch(RepositoryKey{Host: "git.example.com", Workspace: "my-workspace", RepositorySlug: "api"}, "release/1", "https://git.example.com/projects/my-workspace/repos/api/pull-requests/2")
+
+	if len(release.PullRequests) != 2 {
+		t.Fatalf("expected the results of both hosts, got %+v", release.PullRequests)
+	}
+
+	if result := release.PullRequestResult(cloud); result.Host != "" || result.ReleaseBranch != "" {
+		t.Errorf("expected the bitbucket.org pull-request without the release branch, got %+v", result)
+	}
+
+	if result := release.PullRequestResult(server); result.Host != "git.example.com" || result.ReleaseBranch != "release/1" || result.URL != server.URL() {
+		t.Errorf("expected the server pull-request in the release branch, got %+v", result)
+	}
+}
+
+func TestReleaseAddReleasePullRequest(t *testing.T) {
+	var (
+		release            = NewRelease("U1", "C1")
+		releasePullRequest = PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 3, BranchName: "release/1"}
+	)
+
+	release.AddReleasePullRequest(releasePullRequest)
+	release.AddReleasePullRequest(releasePullRequest)
+	release.AddReleasePullRequest(PullRequest{Workspace: "my-workspace", RepositorySlug: "web"})
+
+	if len(release.ReleasePullRequests) != 1 || !release.ReleasePullRequests[0].Is(releasePullRequest) {
+		t.Errorf("expected the release pull-request once, got %+v", release.ReleasePullRequests)
+	}
+
+	result := ReleasePullRequest{URL: releasePullRequest.URL(), ReleaseBranch: "release/1", ReleasePullRequestLink: releasePullRequest.URL()}
+	member := ReleasePullRequest{URL: "https://bitbucket.org/my-workspace/api/pull-requests/1", ReleaseBranch: "release/1", ReleasePullRequestLink: releasePullRequest.URL()}
+	if !result.IsReleasePullRequest() || member.IsReleasePullRequest() {
+		t.Error("expected only the result of the release pull-request to be the release pull-request")
+	}
+}
@@ -0,0 +1,37 @@
+package bitbucketrelease_dto
+
+import "time"
+
+// ReleaseWindows the time, when the release is allowed
+type ReleaseWindows struct {
+	//Timezone the IANA timezone name, e.g. `Europe/Berlin`, in which the windows are defined. UTC is used by default
+	Timezone string `json:"timezone"`
+
+	//Windows the weekdays and hours, when the release is allowed. If empty, the release is allowed at any time outside of freeze periods
+	Windows []ReleaseWindow `json:"windows"`
+
+	//Freezes the periods, when the release is not allowed
+	Freezes []FreezePeriod `json:"freezes"`
+
+	//ICalendarFile the path to iCalendar file, where each event is the freeze period
+	ICalendarFile string `json:"ical_file"`
+}
+
+// ReleaseWindow the weekdays and hours, when the release is allowed
+type ReleaseWindow struct {
+	//Weekdays the list of weekdays, e.g. `monday`
+	Weekdays []string `json:"weekdays"`
+
+	//From the start time of the window in `15:04` format
+	From string `json:"from"`
+
+	//To the end time of the window in `15:04` format
+	To string `json:"to"`
+}
+
+// FreezePeriod the period, when the release is not allowed
+type FreezePeriod struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Reason string    `json:"reason"`
+}
@@ -0,0 +1,94 @@
+package bitbucketrelease_dto
+
+// RepositoryConfig the release behaviour of the repository. The empty values are taken from the default configuration or from the global settings
+type RepositoryConfig struct {
+	//MainBranch the branch, from which the release branch is created and into which the release pull-request is opened. When it is empty, the main branch of the repository is used
+	MainBranch string `json:"main_branch"`
+
+	//Strategy the merge strategy of the pull-requests: `merge` or `squash`
+	Strategy string `json:"strategy"`
+
+	//ReleaseBranchTemplate the template of the release branch name
+	ReleaseBranchTemplate string `json:"release_branch_template"`
+
+	//ReleasePullRequestTitle the template of the release pull-request title
+	ReleasePullRequestTitle string `json:"release_pull_request_title"`
+
+	//Reviewers the UUIDs for bitbucket.org or the usernames for other providers, which are added to the release pull-request
+	Reviewers []string `json:"reviewers"`
+
+	//Approval the approval policy of the pull-requests of the repository
+	Approval *ApprovalPolicy `json:"approval"`
+
+	//BuildStatuses the build status policy of the repository
+	BuildStatuses *BuildStatusPolicy `json:"build_statuses"`
+
+	//Versioning the rules for the semantic version tags of the repository
+	Versioning *VersioningPolicy `json:"versioning"`
+
+	//ReleaseBranches when false, the pull-requests are merged directly without the release branch and the release pull-request
+	ReleaseBranches *bool `json:"release_branches"`
+}
+
+// Config the release configuration: the default and per repository release behaviour and the global settings of the event
+type Config struct {
+	Default RepositoryConfig `json:"default"`
+
+	//Repositories the configurations by repository. The key can be `{host}/{workspace}/{repository_slug}`, `{workspace}/{repository_slug}` or `{repository_slug}`. The last two are used for bitbucket.org only
+	Repositories map[string]RepositoryConfig `json:"repositories"`
+
+	//Servers the VCS provider hosts, which are used in addition to bitbucket.org
+	Servers []ProviderHost `json:"servers"`
+
+	//ReleaseWindows the time, when the release is allowed
+	ReleaseWindows ReleaseWindows `json:"release_windows"`
+
+	//RepositoryOrder the repositories, which should be released in this order
+	RepositoryOrder []string `json:"repository_order"`
+
+	//AllOrNothing when true, all releases are released in all-or-nothing mode
+	AllOrNothing bool `json:"all_or_nothing"`
+
+	//DeleteFailedBranch when true, the release branch is deleted, when nothing was merged into it
+	DeleteFailedBranch bool `json:"delete_failed_branch"`
+
+	//ConfirmationTimeout the time in seconds, during which the bot waits for the release confirmation
+	ConfirmationTimeout int64 `json:"confirmation_timeout"`
+
+	Checks    ChecksConfig    `json:"checks"`
+	Retry     RetryConfig     `json:"retry"`
+	AutoMerge AutoMergeConfig `json:"auto_merge"`
+}
+
+// ChecksConfig the settings of the parallel pull-request checks
+type ChecksConfig struct {
+	//Concurrency the number of pull-requests, which are checked at the same time
+	Concurrency int `json:"concurrency"`
+
+	//Timeout the time in seconds, during which the pull-request should be checked
+	Timeout int64 `json:"timeout"`
+
+	//Interval the minimal time in milliseconds between the starts of two checks
+	Interval int64 `json:"interval"`
+}
+
+// RetryConfig the settings of the retries of the failed provider requests
+type RetryConfig struct {
+	//Attempts the number of attempts for each request
+	Attempts int `json:"attempts"`
+
+	//Delay the base delay in milliseconds between the attempts
+	Delay int64 `json:"delay"`
+}
+
+// AutoMergeConfig the settings of the release pull-request auto-merge
+type AutoMergeConfig struct {
+	//Enabled when true, the release pull-requests are merged automatically. The auto-merge is disabled by default
+	Enabled bool `json:"enabled"`
+
+	//Interval the interval in seconds between the release pull-request checks
+	Interval int64 `json:"interval"`
+
+	//Timeout the time in hours, after which we stop to watch the release pull-request
+	Timeout int64 `json:"timeout"`
+}
@@ -0,0 +1,117 @@
+package bitbucketrelease_dto
+
+// ProviderHost the host of VCS provider, which is used in addition to bitbucket.org
+type ProviderHost struct {
+	//Type one of `bitbucket_server`, `github` or `gitlab`. The default is `bitbucket_server`
+	Type string `json:"type"`
+
+	//Host the host of the pull-request links, e.g. `git.example.com`
+	Host string `json:"host"`
+
+	//URL the base URL of REST API. When it is empty, the default URL of the provider is used
+	URL string `json:"url"`
+
+	//Token the access token of the bot user
+	Token string `json:"token"`
+
+	//Reviewers the usernames, which are added to the release pull-requests
+	Reviewers []string `json:"reviewers"`
+}
+
+// ServerUser the user of Bitbucket Server
+type ServerUser struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	DisplayName string `json:"displayName"`
+}
+
+// ServerParticipant the author, reviewer or participant of Bitbucket Server pull-request
+type ServerParticipant struct {
+	User     ServerUser `json:"user"`
+	Approved bool       `json:"approved"`
+	Status   string     `json:"status"`
+}
+
+// ServerProject the project of Bitbucket Server
+type ServerProject struct {
+	Key string `json:"key"`
+}
+
+// ServerRepository the repository of Bitbucket Server
+type ServerRepository struct {
+	Slug    string        `json:"slug"`
+	Name    string        `json:"name"`
+	Project ServerProject `json:"project"`
+}
+
+// ServerRef the source or destination of Bitbucket Server pull-request
+type ServerRef struct {
+	ID           string            `json:"id"`
+	DisplayID    string            `json:"displayId,omitempty"`
+	LatestCommit string            `json:"latestCommit,omitempty"`
+	Repository   *ServerRepository `json:"repository,omitempty"`
+}
+
+// ServerLink the link of Bitbucket Server object
+type ServerLink struct {
+	Href string `json:"href"`
+}
+
+// ServerPullRequestLinks the links of Bitbucket Server pull-request
+type ServerPullRequestLinks struct {
+	Self []ServerLink `json:"self"`
+}
+
+// ServerMergeCommit the merge commit of Bitbucket Server pull-request
+type ServerMergeCommit struct {
+	ID string `json:"id"`
+}
+
+// ServerPullRequestProperties the properties of Bitbucket Server pull-request
+type ServerPullRequestProperties struct {
+	MergeCommit ServerMergeCommit `json:"mergeCommit"`
+}
+
+// ServerPullRequest the pull-request of Bitbucket Server
+type ServerPullRequest struct {
+	ID           int64                       `json:"id"`
+	Version      int64                       `json:"version"`
+	Title        string                      `json:"title"`
+	Description  string                      `json:"description"`
+	State        string                      `json:"state"`
+	Author       ServerParticipant           `json:"author"`
+	Reviewers    []ServerParticipant         `json:"reviewers"`
+	Participants []ServerParticipant         `json:"participants"`
+	FromRef      ServerRef                   `json:"fromRef"`
+	ToRef        ServerRef                   `json:"toRef"`
+	Links        ServerPullRequestLinks      `json:"links"`
+	Properties   ServerPullRequestProperties `json:"properties"`
+}
+
+// ServerPullRequestsResponse the page of Bitbucket Server pull-requests
+type ServerPullRequestsResponse struct {
+	Values        []ServerPullRequest `json:"values"`
+	IsLastPage    bool                `json:"isLastPage"`
+	NextPageStart int64               `json:"nextPageStart"`
+}
+
+// ServerBranch the branch of Bitbucket Server repository
+type ServerBranch struct {
+	ID           string `json:"id"`
+	DisplayID    string `json:"displayId"`
+	LatestCommit string `json:"latestCommit"`
+}
+
+// ServerBranchesResponse the page of Bitbucket Server branches
+type ServerBranchesResponse struct {
+	Values        []ServerBranch `json:"values"`
+	IsLastPage    bool           `json:"isLastPage"`
+	NextPageStart int64          `json:"nextPageStart"`
+}
+
+// ServerBuildStatusesResponse the page of Bitbucket Server build statuses
+type ServerBuildStatusesResponse struct {
+	Values        []BuildStatus `json:"values"`
+	IsLastPage    bool          `json:"isLastPage"`
+	NextPageStart int64         `json:"nextPageStart"`
+}
@@ -0,0 +1,35 @@
+package bitbucketrelease_dto
+
+// VersioningPolicy the rules for the semantic version tag, which is created after the release
+type VersioningPolicy struct {
+	//Enabled when true, the tag is created after the pull-requests merge into the main branch
+	Enabled bool `json:"enabled"`
+
+	//TagPrefix the prefix of the tag name, e.g. `v` for `v1.2.3`
+	TagPrefix string `json:"tag_prefix"`
+
+	//InitialVersion the version, which is used when the repository doesn't have any version tag yet
+	InitialVersion string `json:"initial_version"`
+
+	//Bumps the version part (major, minor or patch), which should be incremented by the pull-request type (breaking, feature, fix or chore)
+	Bumps map[string]string `json:"bumps"`
+}
+
+// Tag the tag of the repository
+type Tag struct {
+	Name   string       `json:"name"`
+	Target CommitParent `json:"target"`
+}
+
+// RepositoryResponse the response of BitBucket repository endpoint with its main branch
+type RepositoryResponse struct {
+	MainBranch struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+}
+
+// TagsResponse the response of BitBucket tags endpoint
+type TagsResponse struct {
+	Values []Tag  `json:"values"`
+	Next   string `json:"next"`
+}
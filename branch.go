@@ -0,0 +1,97 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+	"strings"
+)
+
+func isBranchRelease(text string) bool {
+	return commandOf(text).Subcommand == "branch"
+}
+
+// releaseBranch finds the open pull-request of the branch from `release branch {workspace}/{repository}:{branch}` message and plans its release.
+// When there is no open pull-request, the bot offers to create it into the main branch
+func releaseBranch(message dto.BaseChatMessage) string {
+	pullRequest, err := parseBranchReference(message.OriginalMessage.Text)
+	if err != nil {
+		return err.Error()
+	}
+
+	info, err := bitbucket_release_services.ProviderFor(pullRequest.Host).OpenPullRequest(context.Background(), pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.BranchName)
+	if err != nil {
+		return fmt.Sprintf("I cannot find the pull-request of the branch `%s`. Reason: `%s`", pullRequest.BranchName, err)
+	}
+
+	if info.ID != 0 {
+		pullRequest.ID = info.ID
+		return planRelease(message, ReceivedPullRequests{Items: []bitbucketrelease_dto.PullRequest{pullRequest}})
+	}
+
+	if isDryRun(message.OriginalMessage.Text) {
+		return fmt.Sprintf("There is no open pull-request from the branch `%s` of repository `%s`. Nothing was changed, please send the same message without `plan` or `--dry-run` if I should create it.", pullRequest.BranchName, pullRequest.RepositorySlug)
+	}
+
+	requestPullRequestCreation(message, pullRequest)
+
+	return fmt.Sprintf("There is no open pull-request from the branch `%s` of repository `%s`. Please reply ```release yes``` or ```release go``` if I should create it into the main branch and release it, or ```release cancel``` to stop. I will wait %d minutes.", pullRequest.BranchName, pullRequest.RepositorySlug, int(confirmationTimeout().Minutes()))
+}
+
+// parseBranchReference returns the pull-request reference with the source branch from `release branch` message. The ID is not defined yet
+func parseBranchReference(text string) (bitbucketrelease_dto.PullRequest, error) {
+	argument := commandOf(text).Argument(0)
+	if argument == "" {
+		return bitbucketrelease_dto.PullRequest{}, errors.New("Please send me ```release branch {workspace}/{repository}:{branch}```.")
+	}
+
+	reference := strings.Trim(commandArgument(argument), referenceTrimCharacters)
+	for _, prefix := range []string{"https://", "http://"} {
+		reference = strings.TrimPrefix(reference, prefix)
+	}
+
+	separator := strings.Index(reference, ":")
+	if separator == -1 || separator == len(reference)-1 {
+		return bitbucketrelease_dto.PullRequest{}, errors.New("Please send me ```release branch {workspace}/{repository}:{branch}```.")
+	}
+
+	host, workspace, repository, err := parseRepositoryReference(reference[:separator])
+	if err != nil {
+		return bitbucketrelease_dto.PullRequest{}, err
+	}
+
+	providerHost, _ := bitbucket_release_services.ProviderHostFor(host)
+
+	return bitbucketrelease_dto.PullRequest{
+		Host:           host,
+		Provider:       providerHost.Type,
+		Workspace:      workspace,
+		RepositorySlug: repository,
+		BranchName:     reference[separator+1:],
+	}, nil
+}
+
+// createBranchPullRequest creates the pull-request, which creation was confirmed by the user, and plans its release
+func createBranchPullRequest(pending pendingRelease) string {
+	pullRequest := *pending.PullRequestCreation
+
+	created, err := bitbucket_release_services.ProviderFor(pullRequest.Host).CreatePullRequest(context.Background(), pullRequest.Workspace, pullRequest.RepositorySlug, bitbucketrelease_dto.ProviderPullRequestCreate{
+		Title:             pullRequest.BranchName,
+		SourceBranch:      pullRequest.BranchName,
+		DestinationBranch: bitbucket_release_services.RepositoryConfigFor(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug).MainBranch,
+		Reviewers:         bitbucket_release_services.RepositoryReviewers(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug),
+	})
+	if err != nil {
+		log.Logger().AddError(err).Str("branch", pullRequest.BranchName).Msg("Failed to create the pull-request of the branch")
+		return fmt.Sprintf("I cannot create the pull-request from the branch `%s`. Reason: `%s`", pullRequest.BranchName, err)
+	}
+
+	pullRequest.ID = created.ID
+	bitbucket_release_services.SendMessageToTheChannel(pending.Message.Channel, fmt.Sprintf("I created the pull-request %s.", created.Link))
+
+	return planRelease(pending.Message, ReceivedPullRequests{Items: []bitbucketrelease_dto.PullRequest{pullRequest}})
+}
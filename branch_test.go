@@ -0,0 +1,73 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseBranchReference(t *testing.T) {
+	loadReleaseConfig(t, `{"servers": [{"type": "gitlab", "host": "gitlab.example.com"}]}`)
+
+	cases := []struct {
+		text     string
+		expected string
+		err      bool
+	}{
+		{text: "release branch my-workspace/api:feature/login", expected: "/my-workspace/api:feature/login"},
+		{text: "release branch `gitlab.example.com/group/subgroup/api:fix-1`", expected: "gitlab.example.com/group/subgroup/api:fix-1"},
+		{text: "release branch my-workspace/api", err: true},
+		{text: "release branch my-workspace/api:", err: true},
+		{text: "release branch", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			pullRequest, err := parseBranchReference(c.text)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected the error, got %+v", pullRequest)
+				}
+				return
+			}
+
+			if err != nil || fmt.Sprintf("%s/%s/%s:%s", pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.BranchName) != c.expected {
+				t.Errorf("expected %s, got %+v, %v", c.expected, pullRequest, err)
+			}
+		})
+	}
+}
+
+func TestReleaseBranchWithoutPullRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	loadReleaseConfig(t, fmt.Sprintf(`{"servers": [{"type": "github", "host": "github.com", "url": %q}]}`, server.URL))
+
+	dryRun := confirmationMessage("C1", "U1", "release branch github.com/my-owner/api:feature --dry-run")
+	if text := releaseBranch(dryRun); !strings.Contains(text, "Nothing was changed") {
+		t.Errorf("expected the dry-run not to offer the pull-request creation, got %q", text)
+	}
+
+	if _, ok := peekPendingRelease(dryRun); ok {
+		t.Error("expected no pull-request creation waiting for the confirmation after the dry-run")
+	}
+
+	message := confirmationMessage("C1", "U1", "release branch github.com/my-owner/api:feature")
+	t.Cleanup(func() {
+		takePendingRelease(message)
+	})
+
+	if text := releaseBranch(message); !strings.Contains(text, "Please reply ```release yes```") {
+		t.Errorf("expected the bot to offer the pull-request creation, got %q", text)
+	}
+
+	pending, ok := peekPendingRelease(message)
+	if !ok || pending.PullRequestCreation == nil || pending.PullRequestCreation.BranchName != "feature" || pending.PullRequestCreation.Host != "github.com" {
+		t.Errorf("expected the pull-request creation of the branch to wait for the confirmation, got %+v", pending)
+	}
+}
@@ -0,0 +1,97 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"sync"
+	"time"
+)
+
+const defaultCheckConcurrency = 4
+
+// checkResult the result of the pull-request check
+type checkResult struct {
+	PullRequest bitbucketrelease_dto.PullRequest
+	Failed      *failedToMerge
+}
+
+// checkPullRequests checks the received pull-requests in parallel. Returns the merge plan with the pull-requests, which can be merged, and the list of failed pull-requests. Both keep the received order
+func checkPullRequests(items []bitbucketrelease_dto.PullRequest) (bitbucketrelease_dto.MergePlan, []failedToMerge) {
+	var (
+		failedPullRequests []failedToMerge
+		plan               bitbucketrelease_dto.MergePlan
+		results            = make([]checkResult, len(items))
+		queue              = make(chan int)
+		wg                 sync.WaitGroup
+		settings           = bitbucket_release_services.Config().Checks
+		concurrency        = settings.Concurrency
+		timeout            = bitbucket_release_services.CheckTimeout()
+		interval           = time.Duration(settings.Interval) * time.Millisecond
+	)
+
+	if concurrency <= 0 {
+		concurrency = defaultCheckConcurrency
+	}
+
+	for i := 0; i < concurrency && i < len(items); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range queue {
+				results[index] = checkPullRequestWithTimeout(items[index], timeout)
+			}
+		}()
+	}
+
+	for index := range items {
+		if index > 0 && interval > 0 {
+			time.Sleep(interval)
+		}
+
+		queue <- index
+	}
+
+	close(queue)
+	wg.Wait()
+
+	//Every result has its own place, so the aggregation does not depend on the order in which the checks are finished
+	for _, result := range results {
+		if result.Failed != nil {
+			failedPullRequests = append(failedPullRequests, *result.Failed)
+			continue
+		}
+
+		plan.Add(result.PullRequest)
+	}
+
+	return plan, failedPullRequests
+}
+
+// checkPullRequestWithTimeout checks the pull-request. The provider requests of the check are cancelled after the selected timeout and the pull-request is marked as failed
+func checkPullRequestWithTimeout(pullRequest bitbucketrelease_dto.PullRequest, timeout time.Duration) checkResult {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	checked, failed := checkPullRequest(ctx, pullRequest)
+	if failed == nil || ctx.Err() == nil {
+		return checkResult{PullRequest: checked, Failed: failed}
+	}
+
+	log.Logger().Warn().
+		Int64("pull_request_id", pullRequest.ID).
+		Str("repository", pullRequest.RepositorySlug).
+		Msg("The pull-request check timed out")
+
+	return checkResult{
+		PullRequest: checked,
+		Failed: &failedToMerge{
+			Reason:      fmt.Sprintf("The pull-request check was not finished in %s.", timeout),
+			Info:        failed.Info,
+			Error:       ctx.Err(),
+			PullRequest: checked,
+		},
+	}
+}
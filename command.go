@@ -0,0 +1,317 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"unicode"
+)
+
+const (
+	commandKeyword = "release"
+	flagPrefix     = "--"
+)
+
+// commandSubcommand the definition of the release subcommand
+type commandSubcommand struct {
+	Name    string
+	Aliases []string
+
+	//Usage the arguments of the subcommand, which are shown in the help
+	Usage       string
+	Description string
+}
+
+// commandFlag the definition of the release command flag
+type commandFlag struct {
+	Name string
+
+	//Value the placeholder of the flag value, which is shown in the help. The flag without the value is the boolean flag
+	Value       string
+	Description string
+}
+
+// command the parsed release command
+type command struct {
+	//Subcommand the name of the subcommand. It is empty for the release of the pull-requests
+	Subcommand string
+
+	//Arguments the words of the command, which are not the subcommand or the flags
+	Arguments []string
+
+	//Flags the received flags with their values. The value of the boolean flag is empty
+	Flags map[string]string
+}
+
+var (
+	subcommands = []commandSubcommand{
+		{Name: "", Usage: "{links-to-pull-requests}", Description: "release the pull-requests. You can use `{workspace}/{repository}#{id}` or `{repository}#{id}` instead of the link"},
+		{Name: "plan", Usage: "{links-to-pull-requests}", Description: "show what will be done for the pull-requests without merging anything"},
+		{Name: "repo", Aliases: []string{"repository"}, Usage: "{workspace}/{repository}", Description: "release all open pull-requests of the repository, which are ready for merge"},
+		{Name: "branch", Usage: "{workspace}/{repository}:{branch}", Description: "release the open pull-request of the branch"},
+		{Name: "status", Description: "show your release, which waits for the confirmation, and the release pull-requests, which wait for the automatic merge"},
+		{Name: "history", Usage: "[number] [repository {repository}] [user @user]", Description: "show the latest releases"},
+		{Name: "show", Usage: "{release-id}", Description: "show the details of the release"},
+		{Name: "revert", Usage: "{release-id} | {links-to-pull-requests}", Description: "open the revert pull-requests for the merged pull-requests"},
+	}
+
+	commandFlags = []commandFlag{
+		{Name: "dry-run", Description: "show what will be done without merging anything, same as `release plan`"},
+		{Name: "strategy", Value: "merge|squash", Description: "the merge strategy of the pull-requests. By default, the strategy of the repository configuration or `squash` is used"},
+		{Name: "target", Value: "{branch}", Description: "release the pull-requests into this branch instead of the main branch"},
+		{Name: "no-release-pr", Description: "merge the pull-requests directly, without the release branch and the release pull-request"},
+		{Name: "all-or-nothing", Description: "release the pull-requests only when all of them pass the checks and all release branches are prepared. The merge is not atomic: when the merge of a repository fails, the repositories merged before it stay merged"},
+		{Name: "order", Value: "{repository},{repository}", Description: "the order of the repositories release"},
+		{Name: "override", Value: "\"{justification}\"", Description: "release outside of the release windows"},
+		{Name: "to", Value: "{branch}", Description: "release only the pull-requests into this branch. It is used by `release repo`"},
+		{Name: "help", Description: "show this message"},
+	}
+)
+
+// HasFlag returns true when the flag is received
+func (c command) HasFlag(name string) bool {
+	_, ok := c.Flags[name]
+	return ok
+}
+
+// Flag returns the value of the flag or empty string, when the flag is not received
+func (c command) Flag(name string) string {
+	return c.Flags[name]
+}
+
+// Argument returns the argument by its index or empty string, when there is no such argument
+func (c command) Argument(index int) string {
+	if index >= len(c.Arguments) {
+		return ""
+	}
+
+	return c.Arguments[index]
+}
+
+// parseCommand parses the release command from the message. The words before the `release` keyword are ignored.
+// The returned command contains everything, which was parsed, even when the error is returned
+func parseCommand(text string) (command, error) {
+	var (
+		result = command{Flags: map[string]string{}}
+		tokens = commandTokens(text)
+		start  = 0
+	)
+
+	for i, token := range tokens {
+		if strings.EqualFold(token, commandKeyword) {
+			start = i + 1
+			break
+		}
+	}
+
+	tokens = tokens[start:]
+	if len(tokens) > 0 {
+		if subcommand, ok := findSubcommand(tokens[0]); ok {
+			result.Subcommand = subcommand.Name
+			tokens = tokens[1:]
+		}
+	}
+
+	var problems []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if !strings.HasPrefix(token, flagPrefix) {
+			result.Arguments = append(result.Arguments, token)
+			continue
+		}
+
+		name, value, hasValue := strings.TrimPrefix(token, flagPrefix), "", false
+		if separator := strings.Index(name, "="); separator != -1 {
+			name, value, hasValue = name[:separator], name[separator+1:], true
+		}
+
+		name = strings.ToLower(name)
+		flag, ok := findFlag(name)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("The flag `--%s` is unknown.", name))
+			continue
+		}
+
+		if flag.Value == "" {
+			if hasValue {
+				problems = append(problems, fmt.Sprintf("The flag `--%s` doesn't have the value.", name))
+				continue
+			}
+
+			result.Flags[name] = ""
+			continue
+		}
+
+		if !hasValue && i+1 < len(tokens) && !strings.HasPrefix(tokens[i+1], flagPrefix) {
+			i++
+			value, hasValue = tokens[i], true
+		}
+
+		if !hasValue || value == "" {
+			problems = append(problems, fmt.Sprintf("The flag `--%s` requires the value: ```--%s %s```", name, name, flag.Value))
+			continue
+		}
+
+		result.Flags[name] = value
+	}
+
+	if strategy := result.Flag("strategy"); strategy != "" && !isReleaseStrategy(strategy) {
+		problems = append(problems, fmt.Sprintf("The strategy `%s` is not supported. Please use `merge` or `squash`.", strategy))
+		delete(result.Flags, "strategy")
+	}
+
+	if len(problems) > 0 {
+		return result, errors.New(strings.Join(problems, "\n"))
+	}
+
+	return result, nil
+}
+
+// commandOf returns the release command of the message. The validation errors are ignored, because they are reported to the user before the release starts
+func commandOf(text string) command {
+	result, _ := parseCommand(text)
+	return result
+}
+
+// commandTokens splits the message into the words. The quoted values and Slack links are kept as one word, the quotes are removed
+func commandTokens(text string) []string {
+	var (
+		tokens  []string
+		current strings.Builder
+		closing rune
+		inToken bool
+	)
+
+	flush := func() {
+		if inToken {
+			tokens = append(tokens, current.String())
+		}
+
+		current.Reset()
+		inToken = false
+	}
+
+	for _, character := range text {
+		switch {
+		case closing != 0 && character == closing:
+			if closing == '>' {
+				current.WriteRune(character)
+			}
+
+			closing = 0
+		case closing != 0:
+			current.WriteRune(character)
+		case character == '"' || character == '“':
+			closing, inToken = '"', true
+			if character == '“' {
+				closing = '”'
+			}
+		case character == '<':
+			closing, inToken = '>', true
+			current.WriteRune(character)
+		case unicode.IsSpace(character):
+			flush()
+		default:
+			current.WriteRune(character)
+			inToken = true
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+// commandArgument returns the argument without the Slack link formatting
+func commandArgument(argument string) string {
+	return slackLinkRegex.ReplaceAllString(argument, "$1")
+}
+
+func findSubcommand(token string) (commandSubcommand, bool) {
+	for _, subcommand := range subcommands {
+		if subcommand.Name == "" {
+			continue
+		}
+
+		if strings.EqualFold(token, subcommand.Name) {
+			return subcommand, true
+		}
+
+		for _, alias := range subcommand.Aliases {
+			if strings.EqualFold(token, alias) {
+				return subcommand, true
+			}
+		}
+	}
+
+	return commandSubcommand{}, false
+}
+
+func findFlag(name string) (commandFlag, bool) {
+	for _, flag := range commandFlags {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+
+	return commandFlag{}, false
+}
+
+func isReleaseStrategy(strategy string) bool {
+	_, ok := bitbucket_release_services.ReleaseStrategy(strategy)
+	return ok
+}
+
+func isHelpCommand(text string) bool {
+	return commandOf(text).HasFlag("help")
+}
+
+func isStatusCommand(text string) bool {
+	return commandOf(text).Subcommand == "status"
+}
+
+// releaseOptions returns the options of the release from the flags of the message
+func releaseOptions(text string) bitbucketrelease_dto.ReleaseOptions {
+	received := commandOf(text)
+	strategy, _ := bitbucket_release_services.ReleaseStrategy(received.Flag("strategy"))
+
+	return bitbucketrelease_dto.ReleaseOptions{
+		Strategy:             strategy,
+		Target:               received.Flag("target"),
+		NoReleasePullRequest: received.HasFlag("no-release-pr"),
+		AllOrNothing:         isAllOrNothing(text),
+	}
+}
+
+// mergesDirectly returns true when the pull-requests of the repository are merged without the release branch
+func mergesDirectly(options bitbucketrelease_dto.ReleaseOptions, repositoryPlan bitbucketrelease_dto.RepositoryMergePlan) bool {
+	return len(repositoryPlan.PullRequests) == 1 || options.NoReleasePullRequest || !bitbucket_release_services.UsesReleaseBranch(repositoryPlan.Host, repositoryPlan.Workspace, repositoryPlan.RepositorySlug)
+}
+
+// commandHelp generates the help message from the definitions of the subcommands and the flags
+func commandHelp() string {
+	var text = "Send me one of the next messages:\n"
+	for _, subcommand := range subcommands {
+		usage := strings.TrimSpace(strings.Join([]string{commandKeyword, subcommand.Name, subcommand.Usage}, " "))
+		usage = strings.Join(strings.Fields(usage), " ")
+
+		text += fmt.Sprintf("```%s``` - %s", usage, subcommand.Description)
+		if len(subcommand.Aliases) > 0 {
+			text += fmt.Sprintf(" (also `%s %s`)", commandKeyword, strings.Join(subcommand.Aliases, "`, `"+commandKeyword+" "))
+		}
+
+		text += "\n"
+	}
+
+	text += "You can add the next flags:\n"
+	for _, flag := range commandFlags {
+		usage := strings.TrimSpace(fmt.Sprintf("%s%s %s", flagPrefix, flag.Name, flag.Value))
+		text += fmt.Sprintf("```%s``` - %s\n", usage, flag.Description)
+	}
+
+	text += "Example: bb release --strategy merge https://bitbucket.org/mywork/my-test-repository/pull-requests/1"
+
+	return text
+}
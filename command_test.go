@@ -0,0 +1,66 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		text       string
+		subcommand string
+		arguments  string
+		flags      string
+		err        string
+	}{
+		{text: "bb release my-workspace/api#1 api#2", arguments: "[my-workspace/api#1 api#2]", flags: "map[]"},
+		{text: "release repository my-workspace/api --to develop", subcommand: "repo", arguments: "[my-workspace/api]", flags: "map[to:develop]"},
+		{text: "Release PLAN api#1 --strategy=merge --no-release-pr", subcommand: "plan", arguments: "[api#1]", flags: "map[no-release-pr: strategy:merge]"},
+		{text: `release api#1 --override "Hotfix of the login"`, arguments: "[api#1]", flags: "map[override:Hotfix of the login]"},
+		{text: "release <https://bitbucket.org/my-workspace/api/pull-requests/1|api #1> --target release/2", arguments: "[<https://bitbucket.org/my-workspace/api/pull-requests/1|api #1>]", flags: "map[target:release/2]"},
+		{text: "release api#1 --unknown", arguments: "[api#1]", flags: "map[]", err: "The flag `--unknown` is unknown."},
+		{text: "release api#1 --target", arguments: "[api#1]", flags: "map[]", err: "The flag `--target` requires the value"},
+		{text: "release api#1 --dry-run=yes", arguments: "[api#1]", flags: "map[]", err: "The flag `--dry-run` doesn't have the value."},
+		{text: "release api#1 --strategy rebase", arguments: "[api#1]", flags: "map[]", err: "The strategy `rebase` is not supported."},
+	}
+
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			received, err := parseCommand(c.text)
+			if c.err == "" && err != nil {
+				t.Errorf("expected no error, got %s", err)
+			}
+
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("expected the error with %q, got %v", c.err, err)
+			}
+
+			if received.Subcommand != c.subcommand || fmt.Sprint(received.Arguments) != c.arguments || fmt.Sprint(received.Flags) != c.flags {
+				t.Errorf("expected %q %s %s, got %+v", c.subcommand, c.arguments, c.flags, received)
+			}
+		})
+	}
+}
+
+func TestCommandHelp(t *testing.T) {
+	help := commandHelp()
+
+	for _, subcommand := range subcommands {
+		if !strings.Contains(help, subcommand.Description) {
+			t.Errorf("expected the help of the subcommand %q", subcommand.Name)
+		}
+	}
+
+	for _, flag := range commandFlags {
+		if !strings.Contains(help, flagPrefix+flag.Name) {
+			t.Errorf("expected the help of the flag %q", flag.Name)
+		}
+	}
+
+	for _, usage := range []string{"```release repo {workspace}/{repository}```", "(also `release repository`)", "```--strategy merge|squash```"} {
+		if !strings.Contains(help, usage) {
+			t.Errorf("expected %s in the help, got %s", usage, help)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/container"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//confirmationRegex the answer to the release confirmation. It starts with the release keyword, so the bot doesn't react on every `yes` in the channel
+	confirmationRegex = `(?i)^\s*release\s+(yes|go|cancel)\s*$`
+
+	defaultConfirmationTimeout = 5 * time.Minute
+)
+
+// pendingRelease the checked pull-requests, which wait for the confirmation of the user
+type pendingRelease struct {
+	Message            dto.BaseChatMessage
+	ExpiresAt          time.Time
+	Plan               bitbucketrelease_dto.MergePlan
+	FailedPullRequests []failedToMerge
+
+	//PullRequestCreation the branch, for which the pull-request should be created before the release. It is nil for the checked pull-requests
+	PullRequestCreation *bitbucketrelease_dto.PullRequest
+}
+
+// pendingReleases the releases, which wait for the confirmation. They are kept in memory only, so the releases, which wait for the confirmation, are lost after the bot restart
+var (
+	pendingReleases      = map[string]pendingRelease{}
+	pendingReleasesMutex sync.Mutex
+)
+
+func isConfirmationAnswer(text string) bool {
+	return regexp.MustCompile(confirmationRegex).MatchString(text)
+}
+
+// isCancelAnswer returns true when the user cancels the release
+func isCancelAnswer(text string) bool {
+	matches := regexp.MustCompile(confirmationRegex).FindStringSubmatch(text)
+	return len(matches) == 2 && strings.EqualFold(matches[1], "cancel")
+}
+
+func confirmationTimeout() time.Duration {
+	seconds := bitbucket_release_services.Config().ConfirmationTimeout
+	if seconds <= 0 {
+		return defaultConfirmationTimeout
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+// pendingReleaseKey the release confirmation is expected from the same user in the same channel. The answers of other users are ignored
+func pendingReleaseKey(message dto.BaseChatMessage) string {
+	return fmt.Sprintf("%s/%s", message.Channel, message.OriginalMessage.User)
+}
+
+// requestReleaseConfirmation stores the checked pull-requests till the user confirms or cancels the release
+func requestReleaseConfirmation(message dto.BaseChatMessage, plan bitbucketrelease_dto.MergePlan, failedPullRequests []failedToMerge) {
+	pendingReleasesMutex.Lock()
+	defer pendingReleasesMutex.Unlock()
+
+	pendingReleases[pendingReleaseKey(message)] = pendingRelease{
+		Message:            message,
+		ExpiresAt:          time.Now().Add(confirmationTimeout()),
+		Plan:               plan,
+		FailedPullRequests: failedPullRequests,
+	}
+}
+
+// requestPullRequestCreation stores the branch, for which the bot offered to create the pull-request, till the user confirms or cancels it
+func requestPullRequestCreation(message dto.BaseChatMessage, pullRequest bitbucketrelease_dto.PullRequest) {
+	pendingReleasesMutex.Lock()
+	defer pendingReleasesMutex.Unlock()
+
+	pendingReleases[pendingReleaseKey(message)] = pendingRelease{
+		Message:             message,
+		ExpiresAt:           time.Now().Add(confirmationTimeout()),
+		PullRequestCreation: &pullRequest,
+	}
+}
+
+// takePendingRelease returns and removes the pending release of the user. The expired release is returned as well
+func takePendingRelease(message dto.BaseChatMessage) (pendingRelease, bool) {
+	pendingReleasesMutex.Lock()
+	defer pendingReleasesMutex.Unlock()
+
+	key := pendingReleaseKey(message)
+	pending, ok := pendingReleases[key]
+	delete(pendingReleases, key)
+
+	return pending, ok
+}
+
+// peekPendingRelease returns the pending release of the user without removing it
+func peekPendingRelease(message dto.BaseChatMessage) (pendingRelease, bool) {
+	pendingReleasesMutex.Lock()
+	defer pendingReleasesMutex.Unlock()
+
+	pending, ok := pendingReleases[pendingReleaseKey(message)]
+	if !ok || time.Now().After(pending.ExpiresAt) {
+		return pendingRelease{}, false
+	}
+
+	return pending, true
+}
+
+// answerReleaseConfirmation starts or cancels the pending release of the user. The answer is ignored, when the user has no release waiting for the confirmation in this channel,
+// because it can be the answer to somebody else. The release windows are checked again, because they could be closed while the release waited for the confirmation
+func answerReleaseConfirmation(message dto.BaseChatMessage) (string, error) {
+	pending, ok := takePendingRelease(message)
+	if !ok {
+		return "There is no release, which waits for your confirmation in this channel.", nil
+	}
+
+	if time.Now().After(pending.ExpiresAt) {
+		return "The release plan expired, so nothing was changed. Please send me the release message again.", nil
+	}
+
+	if isCancelAnswer(message.OriginalMessage.Text) {
+		log.Logger().Info().
+			Str("user", message.OriginalMessage.User).
+			Msg("The release was cancelled")
+		return "Ok, the release is cancelled. Nothing was changed.", nil
+	}
+
+	if pending.PullRequestCreation != nil {
+		return createBranchPullRequest(pending), nil
+	}
+
+	if err := bitbucket_release_services.CheckReleaseWindow(time.Now()); err != nil {
+		justification := overrideJustification(pending.Message.OriginalMessage.Text)
+		if justification == "" {
+			return fmt.Sprintf("%s\nThe release window was closed while I waited for your confirmation, so nothing was changed. If you really need to release now, send the release message again with ```--override \"{justification}\"```.", err), nil
+		}
+
+		logReleaseWindowOverride(pending.Message, err, justification)
+	}
+
+	return runRelease(pending)
+}
+
+// runRelease merges the confirmed pull-requests and stores the release in the history
+func runRelease(pending pendingRelease) (string, error) {
+	message := pending.Message
+
+	release := bitbucketrelease_dto.NewRelease(message.OriginalMessage.User, message.Channel)
+	for _, failed := range pending.FailedPullRequests {
+		release.SetPullRequestStatus(failed.PullRequest, bitbucketrelease_dto.PullRequestStatusCheckFailed, failed.Reason)
+	}
+
+	var err error
+	if isAllOrNothing(message.OriginalMessage.Text) {
+		err = releaseAllOrNothing(message, release, pending.Plan)
+	} else {
+		err = releaseThePullRequests(message, release, pending.Plan)
+	}
+
+	release.Finish(err)
+	saveRelease(release)
+	watchReleasePullRequests(message, release)
+
+	if err != nil {
+		reportPartialRelease(message, release, pending.Plan)
+		return "", err
+	}
+
+	if container.C.Config.BitBucketConfig.ReleaseChannelMessageEnabled && container.C.Config.BitBucketConfig.ReleaseChannel != "" {
+		log.Logger().Debug().
+			Str("channel", container.C.Config.BitBucketConfig.ReleaseChannel).
+			Msg("Send release-confirmation message")
+
+		bitbucket_release_services.SendMessageToTheChannel(container.C.Config.BitBucketConfig.ReleaseChannel, fmt.Sprintf("There were release triggered by <@%s>!\n%s", message.OriginalMessage.User, releaseNotesText(release, pending.Plan)))
+	}
+
+	return "Done", nil
+}
@@ -0,0 +1,98 @@
+package bitbucketrelease
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func confirmationMessage(channel string, user string, text string) dto.BaseChatMessage {
+	return dto.BaseChatMessage{Channel: channel, OriginalMessage: dto.BaseOriginalMessage{User: user, Text: text}}
+}
+
+func TestIsConfirmationAnswer(t *testing.T) {
+	cases := map[string]bool{
+		"release yes":         true,
+		" Release Go ":        true,
+		"RELEASE   CANCEL":    true,
+		"yes":                 false,
+		"go":                  false,
+		"cancel":              false,
+		"release yes, please": false,
+		"yes release":         false,
+	}
+
+	for text, expected := range cases {
+		if isConfirmationAnswer(text) != expected {
+			t.Errorf("expected %v for %q", expected, text)
+		}
+	}
+}
+
+func TestAnswerReleaseConfirmationOfOtherUser(t *testing.T) {
+	requester := confirmationMessage("C1", "U1", "release my-workspace/api#1")
+	requestReleaseConfirmation(requester, bitbucketrelease_dto.MergePlan{}, nil)
+	t.Cleanup(func() {
+		takePendingRelease(requester)
+	})
+
+	for _, answer := range []dto.BaseChatMessage{confirmationMessage("C1", "U2", "release yes"), confirmationMessage("C2", "U1", "release yes")} {
+		if text, err := answerReleaseConfirmation(answer); !strings.Contains(text, "There is no release, which waits for your confirmation") || err != nil {
+			t.Errorf("expected the answer of %s in %s not to start the release, got %q, %v", answer.OriginalMessage.User, answer.Channel, text, err)
+		}
+	}
+
+	if _, ok := peekPendingRelease(requester); !ok {
+		t.Fatal("expected the release to wait for the confirmation of the requester")
+	}
+
+	if text, _ := answerReleaseConfirmation(confirmationMessage("C1", "U1", "release cancel")); !strings.Contains(text, "the release is cancelled") {
+		t.Errorf("expected the release to be cancelled by the requester, got %q", text)
+	}
+
+	if _, ok := peekPendingRelease(requester); ok {
+		t.Error("expected no release waiting for the confirmation after the cancel")
+	}
+}
+
+func TestAnswerReleaseConfirmationOfExpiredRelease(t *testing.T) {
+	requester := confirmationMessage("C1", "U1", "release my-workspace/api#1")
+
+	pendingReleasesMutex.Lock()
+	pendingReleases[pendingReleaseKey(requester)] = pendingRelease{Message: requester, ExpiresAt: time.Now().Add(-time.Second)}
+	pendingReleasesMutex.Unlock()
+
+	if text, _ := answerReleaseConfirmation(confirmationMessage("C1", "U1", "release yes")); !strings.Contains(text, "expired") {
+		t.Errorf("expected the expired release not to start, got %q", text)
+	}
+}
+
+func TestAnswerReleaseConfirmationChecksReleaseWindow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "release.yaml")
+	config := "release_windows:\n  freezes:\n    - from: \"2000-01-01T00:00:00Z\"\n      to: \"2100-01-01T00:00:00Z\"\n      reason: Migration\n"
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = bitbucket_release_services.LoadConfig()
+	})
+	t.Setenv("BITBUCKET_RELEASE_CONFIG_FILE", path)
+
+	if err := bitbucket_release_services.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	requester := confirmationMessage("C1", "U1", "release my-workspace/api#1")
+	requestReleaseConfirmation(requester, bitbucketrelease_dto.MergePlan{}, nil)
+
+	text, err := answerReleaseConfirmation(confirmationMessage("C1", "U1", "release yes"))
+	if err != nil || !strings.Contains(text, "Reason: Migration") || !strings.Contains(text, "nothing was changed") {
+		t.Errorf("expected the release to be refused by the freeze period, got %q, %v", text, err)
+	}
+}
@@ -0,0 +1,137 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+)
+
+// repositoryOrder returns the repositories order from the message. If it is not defined, the `repository_order` of the release configuration is used
+func repositoryOrder(text string) []string {
+	order := commandOf(text).Flag("order")
+	if order == "" {
+		return bitbucket_release_services.DefaultRepositoryOrder()
+	}
+
+	return bitbucket_release_services.ParseRepositoryOrder(order)
+}
+
+// checkPullRequestDependencies moves to the failed list the pull-requests, which depend on the failed pull-requests or on the pull-requests, which are not merged and not in the release.
+// The provider requests are cancelled, when the context is done or the check timeout is over
+func checkPullRequestDependencies(ctx context.Context, plan bitbucketrelease_dto.MergePlan, failedPullRequests []failedToMerge) (bitbucketrelease_dto.MergePlan, []failedToMerge) {
+	var merged = map[string]error{}
+
+	//Each removed pull-request can break the pull-requests, which depend on it, so we check again until nothing is changed
+	for changed := true; changed; {
+		changed = false
+		for _, pullRequest := range plan.PullRequests() {
+			reason := dependenciesFailureReason(ctx, pullRequest, plan, merged)
+			if reason == "" {
+				continue
+			}
+
+			plan.RemovePullRequest(pullRequest)
+			failedPullRequests = append(failedPullRequests, failedToMerge{
+				Reason:      reason,
+				PullRequest: pullRequest,
+			})
+
+			changed = true
+		}
+	}
+
+	return plan, failedPullRequests
+}
+
+// dependenciesFailureReason returns the reason, why the pull-request cannot be merged because of its dependencies. The checked dependencies are kept in merged: the error is nil for the merged ones
+func dependenciesFailureReason(ctx context.Context, pullRequest bitbucketrelease_dto.PullRequest, plan bitbucketrelease_dto.MergePlan, merged map[string]error) string {
+	for _, dependency := range pullRequest.DependsOn {
+		if plan.Contains(dependency) {
+			continue
+		}
+
+		if _, ok := merged[dependency.URL()]; !ok {
+			merged[dependency.URL()] = dependencyMerged(ctx, dependency)
+		}
+
+		if err := merged[dependency.URL()]; err != nil {
+			return fmt.Sprintf("It depends on %s, which cannot be merged by this release. Reason: `%s`", dependency.URL(), err)
+		}
+	}
+
+	return ""
+}
+
+// dependencyMerged returns the error, when the dependency is not merged or its state cannot be checked in the check timeout
+func dependencyMerged(ctx context.Context, dependency bitbucketrelease_dto.PullRequest) error {
+	ctx, cancel := context.WithTimeout(ctx, bitbucket_release_services.CheckTimeout())
+	defer cancel()
+
+	info, err := bitbucket_release_services.ProviderFor(dependency.Host).PullRequest(ctx, dependency.Workspace, dependency.RepositorySlug, dependency.ID)
+	if err != nil {
+		return err
+	}
+
+	if info.State != bitbucketrelease_dto.ProviderPullRequestStateMerged {
+		return fmt.Errorf("The pull-request is %s, not merged.", info.State)
+	}
+
+	return nil
+}
+
+// failedPrerequisite returns the reason, why the repository cannot be released: the release of the repository, which should be released before, failed
+func failedPrerequisite(release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan, repositoryPlan bitbucketrelease_dto.RepositoryMergePlan) string {
+	for _, prerequisite := range repositoryPlan.DependsOn {
+		prerequisitePlan, ok := plan.Repository(prerequisite.Host, prerequisite.Workspace, prerequisite.RepositorySlug)
+		if !ok {
+			continue
+		}
+
+		for _, pullRequest := range prerequisitePlan.PullRequests {
+			if release.PullRequestResult(pullRequest).Status != bitbucketrelease_dto.PullRequestStatusMerged {
+				return fmt.Sprintf("The release of repository `%s`, which should be released before, failed.", prerequisite.RepositorySlug)
+			}
+		}
+	}
+
+	return ""
+}
+
+// prerequisitesInReleaseBranch returns the repositories, which should be released before the repository, but their pull-requests were merged into the release branch. Their changes are in the main branch only after the release pull-request is merged
+func prerequisitesInReleaseBranch(release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan, repositoryPlan bitbucketrelease_dto.RepositoryMergePlan) []bitbucketrelease_dto.RepositoryKey {
+	var repositories []bitbucketrelease_dto.RepositoryKey
+	for _, prerequisite := range repositoryPlan.DependsOn {
+		prerequisitePlan, ok := plan.Repository(prerequisite.Host, prerequisite.Workspace, prerequisite.RepositorySlug)
+		if !ok {
+			continue
+		}
+
+		for _, pullRequest := range prerequisitePlan.PullRequests {
+			if release.PullRequestResult(pullRequest).ReleaseBranch != "" {
+				repositories = append(repositories, prerequisite)
+				break
+			}
+		}
+	}
+
+	return repositories
+}
+
+func dependsOnText(repositories []bitbucketrelease_dto.RepositoryKey) string {
+	if len(repositories) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(" (after %s, skipped when their release fails)", repositoryNames(repositories))
+}
+
+func repositoryNames(repositories []bitbucketrelease_dto.RepositoryKey) string {
+	var names []string
+	for _, repository := range repositories {
+		names = append(names, repository.RepositorySlug)
+	}
+
+	return fmt.Sprintf("`%s`", strings.Join(names, "`, `"))
+}
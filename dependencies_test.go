@@ -0,0 +1,66 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+	"testing"
+)
+
+func TestFailedPrerequisite(t *testing.T) {
+	api := bitbucketrelease_dto.PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 1}
+	web := bitbucketrelease_dto.PullRequest{Workspace: "my-workspace", RepositorySlug: "web", ID: 2}
+
+	var plan bitbucketrelease_dto.MergePlan
+	plan.Add(api)
+	plan.Add(web)
+	plan.Repositories[1].DependsOn = []bitbucketrelease_dto.RepositoryKey{plan.Repositories[0].Key()}
+
+	cases := []struct {
+		name          string
+		status        string
+		releaseBranch string
+		failed        bool
+		inRelease     bool
+	}{
+		{name: "prerequisite is merged", status: bitbucketrelease_dto.PullRequestStatusMerged},
+		{name: "prerequisite is merged into the release branch", status: bitbucketrelease_dto.PullRequestStatusMerged, releaseBranch: "release/1", inRelease: true},
+		{name: "prerequisite is failed", status: bitbucketrelease_dto.PullRequestStatusMergeFailed, failed: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			release := bitbucketrelease_dto.NewRelease("U1", "C1")
+			release.SetPullRequestStatus(api, c.status, "")
+			release.SetReleaseBranch(plan.Repositories[0].Key(), c.releaseBranch, "")
+
+			if reason := failedPrerequisite(release, plan, plan.Repositories[1]); (reason != "") != c.failed {
+				t.Errorf("expected the failed prerequisite %v, got %q", c.failed, reason)
+			}
+
+			if repositories := prerequisitesInReleaseBranch(release, plan, plan.Repositories[1]); (len(repositories) > 0) != c.inRelease {
+				t.Errorf("expected the prerequisite in the release branch %v, got %v", c.inRelease, repositories)
+			}
+		})
+	}
+}
+
+func TestCheckPullRequestDependenciesUsesContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pullRequest := bitbucketrelease_dto.PullRequest{
+		Workspace:      "my-workspace",
+		RepositorySlug: "web",
+		ID:             2,
+		DependsOn:      []bitbucketrelease_dto.PullRequest{{Workspace: "my-workspace", RepositorySlug: "api", ID: 1}},
+	}
+
+	var plan bitbucketrelease_dto.MergePlan
+	plan.Add(pullRequest)
+
+	plan, failed := checkPullRequestDependencies(ctx, plan, nil)
+	if plan.Len() != 0 || len(failed) != 1 || !strings.Contains(failed[0].Reason, "context canceled") {
+		t.Errorf("expected the dependency check to be cancelled with the context, got %+v", failed)
+	}
+}
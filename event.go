@@ -1,31 +1,33 @@
 package bitbucketrelease
 
 import (
+	"context"
 	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_database"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
 	"github.com/sharovik/devbot/internal/container"
 	"github.com/sharovik/devbot/internal/database"
 	"github.com/sharovik/devbot/internal/dto"
 	"github.com/sharovik/devbot/internal/log"
+	"time"
 )
 
 // EventName the name of the event
 const (
-	EventName         = "bitbucket_release"
-	EventVersion      = "2.0.0"
-	pullRequestsRegex = `(?m)https:\/\/bitbucket.org\/(?P<workspace>.+)\/(?P<repository_slug>.+)\/pull-requests\/(?P<pull_request_id>\d+)`
-	helpMessage       = "Send me message ```release {links-to-pull-requests}``` with the links to the bitbucket pull-requests instead of `{links-to-pull-requests}`.\nExample: bb release https://bitbucket.org/mywork/my-test-repository/pull-requests/1"
+	EventName    = "bitbucket_release"
+	EventVersion = "2.6.0"
 
 	pullRequestStringAnswer   = "I found the next pull-requests:\n"
 	noPullRequestStringAnswer = `I can't find any pull-request in your message`
-
-	pullRequestStateOpen = "OPEN"
 )
 
 // ReceivedPullRequests struct for pull-requests list
 type ReceivedPullRequests struct {
 	Items []bitbucketrelease_dto.PullRequest
+
+	//Errors the references, which look like pull-requests, but cannot be parsed, with the reasons
+	Errors []string
 }
 
 // PullRequest the pull-request item
@@ -45,18 +47,22 @@ type EventStruct struct {
 // Event - object which is ready to use
 var (
 	Event = EventStruct{}
-	m     = []database.BaseMigrationInterface{}
+	m     = []database.BaseMigrationInterface{
+		bitbucket_release_database.CreateReleasesTableMigration{},
+		bitbucket_release_database.CreateReleasePullRequestsTableMigration{},
+		bitbucket_release_database.AddHostToReleasePullRequestsMigration{},
+	}
 )
 
 type failedToMerge struct {
 	Reason      string
-	Info        dto.BitBucketPullRequestInfoResponse
+	Info        bitbucketrelease_dto.ProviderPullRequest
 	Error       error
 	PullRequest bitbucketrelease_dto.PullRequest
 }
 
 func (e EventStruct) Help() string {
-	return helpMessage
+	return commandHelp()
 }
 
 func (e EventStruct) Alias() string {
@@ -70,6 +76,10 @@ func (e EventStruct) Install() error {
 		Str("event_version", EventVersion).
 		Msg("Triggered event installation")
 
+	if err := bitbucket_release_services.LoadConfig(); err != nil {
+		return err
+	}
+
 	if err := container.C.Dictionary.InstallNewEventScenario(database.EventScenario{
 		EventName:    EventName,
 		EventVersion: EventVersion,
@@ -79,6 +89,36 @@ func (e EventStruct) Install() error {
 				QuestionRegex: "(?i)(release)",
 				Answer:        "Ok, give me a minute",
 			},
+			{
+				Question:      "release plan",
+				QuestionRegex: "(?i)(release plan)",
+				Answer:        "Ok, let me prepare the release plan",
+			},
+			{
+				Question:      "release history",
+				QuestionRegex: "(?i)(release history)",
+				Answer:        "Let me check",
+			},
+			{
+				Question:      "release show",
+				QuestionRegex: "(?i)(release show)",
+				Answer:        "Let me check",
+			},
+			{
+				Question:      "release status",
+				QuestionRegex: "(?i)(release status)",
+				Answer:        "Let me check",
+			},
+			{
+				Question:      "release revert",
+				QuestionRegex: "(?i)(release revert)",
+				Answer:        "Ok, let me prepare the revert pull-requests",
+			},
+			{
+				Question:      "release yes",
+				QuestionRegex: confirmationRegex,
+				Answer:        "Ok",
+			},
 			{
 				Question:      "bb release",
 				QuestionRegex: "(?i)(bb release)",
@@ -94,6 +134,10 @@ func (e EventStruct) Install() error {
 
 // Update the method applies updates
 func (e EventStruct) Update() error {
+	if err := bitbucket_release_services.LoadConfig(); err != nil {
+		return err
+	}
+
 	for _, migration := range m {
 		container.C.MigrationService.SetMigration(migration)
 	}
@@ -105,45 +149,124 @@ func (e EventStruct) Update() error {
 func (EventStruct) Execute(message dto.BaseChatMessage) (dto.BaseChatMessage, error) {
 	var answer = message
 
+	if isConfirmationAnswer(answer.OriginalMessage.Text) {
+		text, err := answerReleaseConfirmation(message)
+		answer.Text = text
+		return answer, err
+	}
+
+	//The command with the wrong flags is not executed at all, so the user doesn't release something unexpected
+	if _, err := parseCommand(answer.OriginalMessage.Text); err != nil {
+		answer.Text = fmt.Sprintf("%s\nSend me ```release --help``` to see the available commands and flags.", err)
+		return answer, nil
+	}
+
+	if isHelpCommand(answer.OriginalMessage.Text) {
+		answer.Text = commandHelp()
+		return answer, nil
+	}
+
+	switch {
+	case isStatusCommand(answer.OriginalMessage.Text):
+		answer.Text = releaseStatusText(message)
+		return answer, nil
+	case isRevertCommand(answer.OriginalMessage.Text):
+		answer.Text = revertRelease(message)
+		return answer, nil
+	case isShowCommand(answer.OriginalMessage.Text):
+		answer.Text = releaseShowText(answer.OriginalMessage.Text)
+		return answer, nil
+	case isHistoryCommand(answer.OriginalMessage.Text):
+		answer.Text = releaseHistoryText(answer.OriginalMessage.Text)
+		return answer, nil
+	}
+
+	//The release is allowed only in the release windows, unless the user overrides it with the justification
+	if err := bitbucket_release_services.CheckReleaseWindow(time.Now()); err != nil {
+		justification := overrideJustification(answer.OriginalMessage.Text)
+		switch {
+		case isDryRun(answer.OriginalMessage.Text):
+			bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("Note! %s", err))
+		case justification == "":
+			answer.Text = fmt.Sprintf("%s\nIf you really need to release now, send the same message with ```--override \"{justification}\"```.", err)
+			return answer, nil
+		default:
+			logReleaseWindowOverride(message, err, justification)
+		}
+	}
+
+	if isBranchRelease(answer.OriginalMessage.Text) {
+		answer.Text = releaseBranch(message)
+		return answer, nil
+	}
+
 	//First we need to find all the pull-requests in received message
-	foundPullRequests := findAllPullRequestsInText(pullRequestsRegex, answer.OriginalMessage.Text)
+	foundPullRequests, err := receivedPullRequests(answer.OriginalMessage.Text)
+	if err != nil {
+		answer.Text = fmt.Sprintf("I cannot find the pull-requests to release. Reason: `%s`", err)
+		return answer, nil
+	}
+
+	answer.Text = planRelease(message, foundPullRequests)
+
+	return answer, nil
+}
 
+// planRelease checks the found pull-requests and asks the user to confirm the release plan. Returns the answer text
+func planRelease(message dto.BaseChatMessage, foundPullRequests ReceivedPullRequests) string {
 	//We prepare the text, where we define all the pull-requests which we found in the received message
-	answer.Text = receivedPullRequestsText(foundPullRequests)
+	text := receivedPullRequestsText(foundPullRequests)
 
 	//Next step is a pull-request statuses check
-	canBeMergedPullRequestsList, canBeMergedByRepository, failedPullRequests := checkPullRequests(foundPullRequests.Items)
-
-	//When we have failed pull-requests, we filter them out
-	if len(failedPullRequests) > 0 {
-		filterOutFailedRepositories(failedPullRequests, canBeMergedPullRequestsList, canBeMergedByRepository)
+	checkStartedAt := time.Now()
+	plan, failedPullRequests := checkPullRequests(foundPullRequests.Items)
+	if len(foundPullRequests.Items) > 0 {
+		text += fmt.Sprintf("I checked %d pull-request(s) in %s.\n", len(foundPullRequests.Items), time.Since(checkStartedAt).Round(time.Millisecond))
 	}
 
-	//We generate text for pull-requests which cannot be merged
-	if len(failedPullRequests) > 0 {
+	//The pull-request cannot be released before the pull-requests it depends on
+	plan, failedPullRequests = checkPullRequestDependencies(context.Background(), plan, failedPullRequests)
+
+	//In all-or-nothing mode the release is possible only when all pull-requests can be merged
+	if isAllOrNothing(message.OriginalMessage.Text) && len(failedPullRequests) > 0 {
 		bitbucket_release_services.SendMessageToTheChannel(message.Channel, failedPullRequestsText(failedPullRequests))
+		text += "\nNothing will be released, because of all-or-nothing mode all pull-requests should be ready for merge."
+		return text
 	}
 
-	bitbucket_release_services.SendMessageToTheChannel(message.Channel, canBeMergedPullRequestsText(canBeMergedPullRequestsList))
+	//When we have failed pull-requests, we filter them out. The repository release releases every pull-request, which passed the checks
+	if len(failedPullRequests) > 0 && !isRepositoryRelease(message.OriginalMessage.Text) {
+		plan = filterOutFailedRepositories(failedPullRequests, plan)
+	}
 
-	if len(canBeMergedByRepository) == 0 {
-		answer.Text += "\nNothing to release"
-		return answer, nil
+	//The repositories and pull-requests are released in the order of their dependencies
+	plan, err := bitbucket_release_services.OrderMergePlan(plan, repositoryOrder(message.OriginalMessage.Text))
+	if err != nil {
+		text += fmt.Sprintf("\n%s", err)
+		return text
 	}
 
-	if err := releaseThePullRequests(message, canBeMergedPullRequestsList, canBeMergedByRepository); err != nil {
-		return answer, err
+	//We generate text for pull-requests which cannot be merged
+	if len(failedPullRequests) > 0 {
+		bitbucket_release_services.SendMessageToTheChannel(message.Channel, failedPullRequestsText(failedPullRequests))
 	}
 
-	answer.Text += "Done"
+	bitbucket_release_services.SendMessageToTheChannel(message.Channel, canBeMergedPullRequestsText(plan))
 
-	if container.C.Config.BitBucketConfig.ReleaseChannelMessageEnabled && container.C.Config.BitBucketConfig.ReleaseChannel != "" {
-		log.Logger().Debug().
-			Str("channel", container.C.Config.BitBucketConfig.ReleaseChannel).
-			Msg("Send release-confirmation message")
+	//In dry-run mode we only show what will be done, without any changes in BitBucket
+	if isDryRun(message.OriginalMessage.Text) {
+		text += fmt.Sprintf("\nThis is the release plan. Nothing was changed, please send the same message without `plan` or `--dry-run` to trigger the release:\n%s", releasePlanText(message, plan))
+		return text
+	}
 
-		bitbucket_release_services.SendMessageToTheChannel(container.C.Config.BitBucketConfig.ReleaseChannel, fmt.Sprintf("There were release triggered by <@%s>!", answer.OriginalMessage.User))
+	if plan.Len() == 0 {
+		text += "\nNothing to release"
+		return text
 	}
 
-	return answer, nil
+	//Before any merge we ask the user to confirm the release plan
+	requestReleaseConfirmation(message, plan, failedPullRequests)
+	text += fmt.Sprintf("\nThis is the release plan:\n%s\nPlease reply ```release yes``` or ```release go``` to start the release or ```release cancel``` to stop it. I will wait %d minutes.", releasePlanText(message, plan), int(confirmationTimeout().Minutes()))
+
+	return text
 }
@@ -1,11 +1,11 @@
 package bitbucketrelease
 
 import (
+	"context"
 	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_database"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
 	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
-	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/sharovik/devbot/internal/container"
@@ -13,120 +13,131 @@ import (
 	"github.com/sharovik/devbot/internal/log"
 )
 
-func failedPullRequestsText(failedPullRequests map[string]failedToMerge) string {
+func failedPullRequestsText(failedPullRequests []failedToMerge) string {
 	if len(failedPullRequests) == 0 {
 		return "All pull-requests are ready for merge! This is awesome!"
 	}
 
 	var text = "These pull-requests cannot be merged:\n"
 
-	for pullRequest, reason := range failedPullRequests {
-		text += fmt.Sprintf("%s - %s \n", pullRequest, reason.Reason)
+	for _, failed := range failedPullRequests {
+		text += fmt.Sprintf("%s - %s \n", failed.PullRequest.URL(), failed.Reason)
 	}
 
 	return text
 }
 
-func canBeMergedPullRequestsText(canBeMerged map[string]bitbucketrelease_dto.PullRequest) string {
-	if len(canBeMerged) == 0 {
+func canBeMergedPullRequestsText(plan bitbucketrelease_dto.MergePlan) string {
+	if plan.Len() == 0 {
 		return "There is no pull-requests, which can be merged."
 	}
 
 	var text = "From received pull-requests, next are good to go:\n"
 
-	for pullRequestURL, pullRequest := range canBeMerged {
-		text += fmt.Sprintf("[#%d] %s \n", pullRequest.ID, pullRequestURL)
+	for _, pullRequest := range plan.PullRequests() {
+		text += fmt.Sprintf("[#%d] %s \n", pullRequest.ID, pullRequest.URL())
 	}
 
 	return text
 }
 
-func checkPullRequests(items []bitbucketrelease_dto.PullRequest) (map[string]bitbucketrelease_dto.PullRequest, map[string]map[string]bitbucketrelease_dto.PullRequest, map[string]failedToMerge) {
-	var (
-		failedPullRequests         = make(map[string]failedToMerge)
-		canBeMergedPullRequestList = make(map[string]bitbucketrelease_dto.PullRequest)
-		canBeMergedByRepository    = make(map[string]map[string]bitbucketrelease_dto.PullRequest)
-	)
-	for _, pullRequest := range items {
-		cleanPullRequestURL := fmt.Sprintf("https://bitbucket.org/%s/%s/pull-requests/%d", pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
-		info, err := container.C.BibBucketClient.PullRequestInfo(pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
-		if err != nil {
-			failedPullRequests[cleanPullRequestURL] = failedToMerge{
-				Reason:      err.Error(),
-				Info:        info,
-				Error:       err,
-				PullRequest: pullRequest,
-			}
-
-			continue
+// checkPullRequest checks the received pull-request. Returns the pull-request filled with its information from BitBucket, or the reason why it cannot be merged.
+// The provider requests are cancelled, when the context is done
+func checkPullRequest(ctx context.Context, pullRequest bitbucketrelease_dto.PullRequest) (bitbucketrelease_dto.PullRequest, *failedToMerge) {
+	info, err := bitbucket_release_services.ProviderFor(pullRequest.Host).PullRequest(ctx, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
+	if err != nil {
+		return pullRequest, &failedToMerge{
+			Reason:      err.Error(),
+			Info:        info,
+			Error:       err,
+			PullRequest: pullRequest,
 		}
+	}
 
-		replacer := strings.NewReplacer("\\", "")
-		pullRequest.Title = info.Title
-		pullRequest.BranchName = info.Source.Branch.Name
-		pullRequest.RepositorySlug = info.Source.Repository.Name
-		pullRequest.Description = replacer.Replace(info.Description)
-
-		cleanPullRequestURL = fmt.Sprintf("https://bitbucket.org/%s/%s/pull-requests/%d", pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
-
-		if isPullRequestAlreadyMerged(info) {
-			failedPullRequests[cleanPullRequestURL] = failedToMerge{
-				Reason:      fmt.Sprintf("The state should be %s, instead of it %s received.", pullRequestStateOpen, info.State),
-				Info:        info,
-				Error:       nil,
-				PullRequest: pullRequest,
-			}
-
-			continue
+	replacer := strings.NewReplacer("\\", "")
+	pullRequest.Title = info.Title
+	pullRequest.BranchName = info.SourceBranch
+	pullRequest.DestinationBranch = info.DestinationBranch
+	pullRequest.Author = info.Author.Name
+	pullRequest.Description = replacer.Replace(info.Description)
+	pullRequest.DependsOn = bitbucket_release_services.PullRequestDependencies(pullRequest.Description)
+
+	if isPullRequestAlreadyMerged(info) {
+		return pullRequest, &failedToMerge{
+			Reason:      fmt.Sprintf("The state should be %s, instead of it %s received.", bitbucketrelease_dto.ProviderPullRequestStateOpen, info.State),
+			Info:        info,
+			Error:       nil,
+			PullRequest: pullRequest,
 		}
+	}
 
-		isPullRequestApprovedByReviewers := isApprovedByReviewers(info)
-		if !isPullRequestApprovedByReviewers {
-			failedPullRequests[cleanPullRequestURL] = failedToMerge{
-				Reason:      "Not all reviewers approved the change.",
-				Info:        info,
-				Error:       nil,
-				PullRequest: pullRequest,
-			}
-
-			continue
+	policy := bitbucket_release_services.ApprovalPolicyFor(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug)
+	if err := bitbucket_release_services.CheckApprovalPolicy(policy, info); err != nil {
+		return pullRequest, &failedToMerge{
+			Reason:      err.Error(),
+			Info:        info,
+			Error:       err,
+			PullRequest: pullRequest,
 		}
+	}
 
-		log.Logger().Debug().
-			Interface("pull_request", pullRequest).
-			Msg("The pull-request can be merged.")
-
-		canBeMergedPullRequestList[cleanPullRequestURL] = pullRequest
-
-		if canBeMergedByRepository[pullRequest.RepositorySlug] == nil {
-			canBeMergedByRepository[pullRequest.RepositorySlug] = make(map[string]bitbucketrelease_dto.PullRequest)
+	buildStatusPolicy := bitbucket_release_services.BuildStatusPolicyFor(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug)
+	if err := bitbucket_release_services.CheckBuildStatuses(ctx, buildStatusPolicy, pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, info); err != nil {
+		return pullRequest, &failedToMerge{
+			Reason:      err.Error(),
+			Info:        info,
+			Error:       err,
+			PullRequest: pullRequest,
 		}
-
-		canBeMergedByRepository[pullRequest.RepositorySlug][pullRequest.Title] = pullRequest
 	}
 
-	return canBeMergedPullRequestList, canBeMergedByRepository, failedPullRequests
+	log.Logger().Debug().
+		Interface("pull_request", pullRequest).
+		Msg("The pull-request can be merged.")
+
+	return pullRequest, nil
 }
 
-func releaseThePullRequests(message dto.BaseChatMessage, canBeMergedPullRequestList map[string]bitbucketrelease_dto.PullRequest, canBeMergedByRepository map[string]map[string]bitbucketrelease_dto.PullRequest) error {
+func releaseThePullRequests(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan) error {
 	log.Logger().StartMessage("Merge of received pull-requests")
 
+	options := releaseOptions(message.OriginalMessage.Text)
+
 	//In case when we have only one pull-request we will merge it straight to the main branch
-	if len(canBeMergedPullRequestList) == 1 {
+	if plan.Len() == 1 {
 		bitbucket_release_services.SendMessageToTheChannel(message.Channel, "We have only one pull-request, so I will try to merge it directly to the main branch.")
-		return bitbucket_release_services.MergeOnePullRequestScenario(message, canBeMergedPullRequestList)
+		return bitbucket_release_services.MergeOnePullRequestScenario(message, release, options, plan.PullRequests())
 	}
 
 	//Here we take sorted by repository pull-requests and trying to merge them into main or release branch.
-	//We go in for loop into each repository and check how many pull-requests do we have there.
+	//We go in for loop into each repository in the received order and check how many pull-requests do we have there.
 	//If only one, then we merge it into main branch, otherwise we create release branch for selected repository,
 	//switch direction of the pull-requests to that release branch and merge all of them.
-	for repository, pullRequests := range canBeMergedByRepository {
-		//Well, in that case we have only one pull-request so we merge it into main branch
-		if len(pullRequests) == 1 {
-			log.Logger().Debug().Str("repository", repository).Msg("Only one pull-request received for selected repository")
-			bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("There is only one pull-request for repository `%s`.", repository))
-			err := bitbucket_release_services.MergeOnePullRequestScenario(message, canBeMergedPullRequestList)
+	for _, repositoryPlan := range plan.Repositories {
+		repository := repositoryPlan.RepositorySlug
+
+		//The repository is not released when any of the repositories it depends on failed
+		if reason := failedPrerequisite(release, plan, repositoryPlan); reason != "" {
+			for _, pullRequest := range repositoryPlan.PullRequests {
+				release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, reason)
+			}
+
+			bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("I skip repository `%s`. %s", repository, reason))
+			continue
+		}
+
+		if prerequisites := prerequisitesInReleaseBranch(release, plan, repositoryPlan); len(prerequisites) > 0 {
+			bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("I release repository `%s`, but the changes of %s, which should be released before, are in the release branch till the release pull-request is merged.", repository, repositoryNames(prerequisites)))
+		}
+
+		//Well, in that case we have only one pull-request or the release pull-request is not needed, so we merge the pull-requests into main branch
+		if mergesDirectly(options, repositoryPlan) {
+			log.Logger().Debug().Str("repository", repository).Msg("The pull-requests of selected repository are merged directly")
+			if len(repositoryPlan.PullRequests) == 1 {
+				bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("There is only one pull-request for repository `%s`.", repository))
+			}
+
+			err := bitbucket_release_services.MergeOnePullRequestScenario(message, release, options, repositoryPlan.PullRequests)
 			if err != nil {
 				log.Logger().AddError(err).Msg("Received error during pull-request merge")
 			}
@@ -134,7 +145,7 @@ func releaseThePullRequests(message dto.BaseChatMessage, canBeMergedPullRequestL
 			continue
 		}
 
-		if err := bitbucket_release_services.MergeMultiplePullRequestsScenario(message, repository, pullRequests); err != nil {
+		if err := bitbucket_release_services.MergeMultiplePullRequestsScenario(message, release, options, repository, repositoryPlan.PullRequests); err != nil {
 			log.Logger().AddError(err).Msg("Failed to trigger multiple pull-requests scenario")
 			bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("Failed to merge: `%s`", err.Error()))
 			continue
@@ -145,82 +156,161 @@ func releaseThePullRequests(message dto.BaseChatMessage, canBeMergedPullRequestL
 	return nil
 }
 
-func isApprovedByReviewers(info dto.BitBucketPullRequestInfoResponse) bool {
-	requiredReviewers := container.C.Config.BitBucketConfig.RequiredReviewers
-	if len(requiredReviewers) == 0 {
-		return true
+// releasePlanText returns the text with all actions, which releaseThePullRequests will do for received pull-requests. Nothing is changed in BitBucket
+func releasePlanText(message dto.BaseChatMessage, plan bitbucketrelease_dto.MergePlan) string {
+	if plan.Len() == 0 {
+		return "Nothing to release"
+	}
+
+	options := releaseOptions(message.OriginalMessage.Text)
+	if plan.Len() == 1 {
+		return bitbucket_release_services.DescribeOnePullRequestScenario(options, plan.PullRequests())
+	}
+
+	var text = ""
+	for _, repositoryPlan := range plan.Repositories {
+		text += fmt.Sprintf("Repository `%s`%s:\n", repositoryPlan.RepositorySlug, dependsOnText(repositoryPlan.DependsOn))
+		if mergesDirectly(options, repositoryPlan) {
+			text += bitbucket_release_services.DescribeOnePullRequestScenario(options, repositoryPlan.PullRequests)
+			continue
+		}
+
+		text += bitbucket_release_services.DescribeMultiplePullRequestsScenario(message.OriginalMessage.User, options, repositoryPlan.RepositorySlug, repositoryPlan.PullRequests)
 	}
 
-	var numberApprovals = 0
-	for _, user := range info.Participants {
-		if user.Approved {
-			numberApprovals++
+	return text
+}
+
+// releaseNotesText returns the release notes of all pull-requests merged by the release
+func releaseNotesText(release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan) string {
+	var text = ""
+	for _, repositoryPlan := range plan.Repositories {
+		var merged []bitbucketrelease_dto.PullRequest
+		for _, pullRequest := range repositoryPlan.PullRequests {
+			if release.PullRequestResult(pullRequest).Status == bitbucketrelease_dto.PullRequestStatusMerged {
+				merged = append(merged, pullRequest)
+			}
+		}
+
+		if len(merged) == 0 {
+			continue
 		}
+
+		text += bitbucket_release_services.ReleaseNotes(repositoryPlan.RepositorySlug, merged) + "\n"
 	}
 
-	return numberApprovals >= 2
+	return text
 }
 
-func isPullRequestAlreadyMerged(info dto.BitBucketPullRequestInfoResponse) bool {
-	return info.State != pullRequestStateOpen
+// reportPartialRelease tells the user, which pull-requests were merged by the stopped release, and sends their release notes to the release channel
+func reportPartialRelease(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan) {
+	text := mergedPullRequestsText(release)
+	if text == "" {
+		return
+	}
+
+	bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("The release was stopped, but these pull-requests were already merged:\n%s", text))
+
+	if container.C.Config.BitBucketConfig.ReleaseChannelMessageEnabled && container.C.Config.BitBucketConfig.ReleaseChannel != "" {
+		bitbucket_release_services.SendMessageToTheChannel(container.C.Config.BitBucketConfig.ReleaseChannel, fmt.Sprintf("There were partial release triggered by <@%s>!\n%s", message.OriginalMessage.User, releaseNotesText(release, plan)))
+	}
 }
 
-func receivedPullRequestsText(foundPullRequests ReceivedPullRequests) string {
+// mergedPullRequestsText returns the merged pull-requests of the release and where they were merged
+func mergedPullRequestsText(release *bitbucketrelease_dto.Release) string {
+	var text = ""
+	for _, pullRequest := range release.PullRequests {
+		if pullRequest.Status != bitbucketrelease_dto.PullRequestStatusMerged {
+			continue
+		}
 
-	if len(foundPullRequests.Items) == 0 {
-		return noPullRequestStringAnswer
+		switch {
+		case pullRequest.ReleaseBranch == "":
+			text += fmt.Sprintf("- %s is merged into `%s`\n", pullRequest.URL, pullRequest.DestinationBranch)
+		case pullRequest.ReleasePullRequestLink != "":
+			text += fmt.Sprintf("- %s is merged into the release branch `%s`, it goes out with the release pull-request %s\n", pullRequest.URL, pullRequest.ReleaseBranch, pullRequest.ReleasePullRequestLink)
+		default:
+			text += fmt.Sprintf("- %s is merged into the release branch `%s`, which has no release pull-request\n", pullRequest.URL, pullRequest.ReleaseBranch)
+		}
 	}
 
-	var pullRequestsString = pullRequestStringAnswer
-	for _, item := range foundPullRequests.Items {
-		pullRequestsString = pullRequestsString + fmt.Sprintf("Pull-request #%d\n", item.ID)
+	return text
+}
+
+// saveRelease stores the release run in the history. The release is already done at this point, so we only log the error
+func saveRelease(release *bitbucketrelease_dto.Release) {
+	if err := bitbucket_release_database.SaveRelease(release); err != nil {
+		log.Logger().AddError(err).Msg("Failed to save the release history")
 	}
+}
 
-	return pullRequestsString
+// watchReleasePullRequests starts the auto-merge of the release pull-requests of the saved release. The merged release pull-request is added to the release history, so it can be reverted
+func watchReleasePullRequests(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release) {
+	for _, pullRequest := range release.ReleasePullRequests {
+		bitbucket_release_services.WatchReleasePullRequest(message, release.ID, pullRequest, saveMergedReleasePullRequest)
+	}
 }
 
-func findAllPullRequestsInText(regex string, subject string) ReceivedPullRequests {
-	re, err := regexp.Compile(regex)
+// saveMergedReleasePullRequest stores the merged release pull-request in the history of its release. The release pull-request is already merged at this point, so we only log the error
+func saveMergedReleasePullRequest(pullRequest bitbucketrelease_dto.ReleasePullRequest) {
+	if err := bitbucket_release_database.SaveReleasePullRequest(&pullRequest); err != nil {
+		log.Logger().AddError(err).Int64("release_id", pullRequest.ReleaseID).Str("url", pullRequest.URL).Msg("Failed to save the merged release pull-request")
+	}
+}
 
-	if err != nil {
-		log.Logger().AddError(err).Msg("Error during the Find Matches operation")
-		return ReceivedPullRequests{}
+// overrideJustification returns the justification of the release windows override
+func overrideJustification(text string) string {
+	return strings.TrimSpace(commandOf(text).Flag("override"))
+}
+
+func logReleaseWindowOverride(message dto.BaseChatMessage, reason error, justification string) {
+	log.Logger().Warn().
+		Str("user", message.OriginalMessage.User).
+		Str("channel", message.Channel).
+		Str("reason", reason.Error()).
+		Str("justification", justification).
+		Msg("The release window is overridden")
+
+	if container.C.Config.BitBucketConfig.ReleaseChannelMessageEnabled && container.C.Config.BitBucketConfig.ReleaseChannel != "" {
+		bitbucket_release_services.SendMessageToTheChannel(container.C.Config.BitBucketConfig.ReleaseChannel, fmt.Sprintf("<@%s> overrides the release window: `%s`\nJustification: %s", message.OriginalMessage.User, reason, justification))
 	}
+}
+
+func isDryRun(text string) bool {
+	received := commandOf(text)
+	return received.Subcommand == "plan" || received.HasFlag("dry-run")
+}
 
-	matches := re.FindAllStringSubmatch(subject, -1)
-	result := ReceivedPullRequests{}
+func isPullRequestAlreadyMerged(info bitbucketrelease_dto.ProviderPullRequest) bool {
+	return info.State != bitbucketrelease_dto.ProviderPullRequestStateOpen
+}
 
-	if len(matches) == 0 {
-		return result
+func receivedPullRequestsText(foundPullRequests ReceivedPullRequests) string {
+	var pullRequestsString = ""
+	if len(foundPullRequests.Errors) > 0 {
+		pullRequestsString = fmt.Sprintf("I cannot understand the next pull-request references:\n%s\n", strings.Join(foundPullRequests.Errors, "\n"))
 	}
 
-	for _, id := range matches {
-		if id[1] != "" {
-			item := bitbucketrelease_dto.PullRequest{}
-			item.Workspace = id[1]
-			item.RepositorySlug = id[2]
-			item.ID, err = strconv.ParseInt(id[3], 10, 64)
-			if err != nil {
-				log.Logger().AddError(err).
-					Interface("matches", matches).
-					Msg("Error during pull-request ID parsing")
-				return ReceivedPullRequests{}
-			}
+	if len(foundPullRequests.Items) == 0 {
+		return pullRequestsString + noPullRequestStringAnswer
+	}
 
-			result.Items = append(result.Items, item)
-		}
+	pullRequestsString += pullRequestStringAnswer
+	for _, item := range foundPullRequests.Items {
+		pullRequestsString = pullRequestsString + fmt.Sprintf("Pull-request #%d\n", item.ID)
 	}
 
-	return result
+	return pullRequestsString
 }
 
-func filterOutFailedRepositories(failedPullRequests map[string]failedToMerge, canBeMergedPullRequestsList map[string]bitbucketrelease_dto.PullRequest, canBeMergedByRepository map[string]map[string]bitbucketrelease_dto.PullRequest) (map[string]bitbucketrelease_dto.PullRequest, map[string]map[string]bitbucketrelease_dto.PullRequest) {
-	for url, pullRequest := range failedPullRequests {
-		delete(canBeMergedPullRequestsList, url)
-		if len(canBeMergedByRepository[pullRequest.PullRequest.RepositorySlug]) == 1 {
-			delete(canBeMergedByRepository, pullRequest.PullRequest.RepositorySlug)
+// filterOutFailedRepositories removes from the plan the repositories, where only one pull-request can be merged and other pull-requests failed
+func filterOutFailedRepositories(failedPullRequests []failedToMerge, plan bitbucketrelease_dto.MergePlan) bitbucketrelease_dto.MergePlan {
+	for _, failed := range failedPullRequests {
+		repositoryPlan, ok := plan.Repository(failed.PullRequest.Host, failed.PullRequest.Workspace, failed.PullRequest.RepositorySlug)
+		if ok && len(repositoryPlan.PullRequests) == 1 {
+			plan.RemoveRepository(failed.PullRequest.Host, failed.PullRequest.Workspace, failed.PullRequest.RepositorySlug)
 		}
 	}
 
-	return canBeMergedPullRequestsList, canBeMergedByRepository
+	return plan
 }
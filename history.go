@@ -0,0 +1,133 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_database"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/log"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	historyRepositoryRegex = `(?i)(?:repository|repo)[:\s]+([\w.\-]+)`
+	historyUserRegex       = `(?i)user[:\s]+<@(\w+)(?:\|[^>]*)?>`
+
+	defaultHistoryLimit int64 = 10
+	maxHistoryLimit     int64 = 100
+	historyDateFormat         = "2006-01-02 15:04"
+)
+
+func isHistoryCommand(text string) bool {
+	return commandOf(text).Subcommand == "history"
+}
+
+func isShowCommand(text string) bool {
+	return commandOf(text).Subcommand == "show"
+}
+
+// parseHistoryFilter parses the limit, repository and user filters from the `release history` message
+func parseHistoryFilter(text string) bitbucketrelease_dto.ReleaseFilter {
+	filter := bitbucketrelease_dto.ReleaseFilter{Limit: defaultHistoryLimit}
+
+	if limit, err := strconv.ParseInt(commandOf(text).Argument(0), 10, 64); err == nil && limit > 0 {
+		filter.Limit = limit
+	}
+
+	if filter.Limit > maxHistoryLimit {
+		filter.Limit = maxHistoryLimit
+	}
+
+	if matches := regexp.MustCompile(historyRepositoryRegex).FindStringSubmatch(text); len(matches) > 1 {
+		filter.Repository = matches[1]
+	}
+
+	if matches := regexp.MustCompile(historyUserRegex).FindStringSubmatch(text); len(matches) > 1 {
+		filter.User = matches[1]
+	}
+
+	return filter
+}
+
+func releaseHistoryText(text string) string {
+	releases, err := bitbucket_release_database.FindReleases(parseHistoryFilter(text))
+	if err != nil {
+		log.Logger().AddError(err).Msg("Failed to load the releases history")
+		return fmt.Sprintf("I cannot load the releases history. Reason: `%s`", err)
+	}
+
+	if len(releases) == 0 {
+		return "I didn't find any release."
+	}
+
+	var result = "These are the latest releases:\n"
+	for _, release := range releases {
+		result += fmt.Sprintf("#%d %s by <@%s> in <#%s> - %s\n", release.ID, release.CreatedAt.Format(historyDateFormat), release.User, release.Channel, release.Status)
+	}
+
+	result += "Send me ```release show {release-id}``` to see the details of the release."
+
+	return result
+}
+
+func releaseShowText(text string) string {
+	argument := strings.TrimPrefix(commandOf(text).Argument(0), "#")
+	if argument == "" {
+		return "Please send me ```release show {release-id}```."
+	}
+
+	releaseID, err := strconv.ParseInt(argument, 10, 64)
+	if err != nil {
+		return fmt.Sprintf("I cannot parse the release ID `%s`.", argument)
+	}
+
+	release, err := bitbucket_release_database.FindRelease(releaseID)
+	if err == bitbucket_release_database.ErrReleaseNotFound {
+		return fmt.Sprintf("I cannot find the release #%d.", releaseID)
+	}
+
+	if err != nil {
+		log.Logger().AddError(err).Int64("release_id", releaseID).Msg("Failed to load the release")
+		return fmt.Sprintf("I cannot load the release #%d. Reason: `%s`", releaseID, err)
+	}
+
+	var result = fmt.Sprintf("Release #%d triggered by <@%s> in <#%s>\nStarted: %s\nFinished: %s\nStatus: %s\n", release.ID, release.User, release.Channel, release.CreatedAt.Format(historyDateFormat), release.FinishedAt.Format(historyDateFormat), release.Status)
+	if release.Error != "" {
+		result += fmt.Sprintf("Error: `%s`\n", release.Error)
+	}
+
+	var merged, failed string
+	for _, pullRequest := range release.PullRequests {
+		if pullRequest.IsReleasePullRequest() {
+			merged += fmt.Sprintf("%s - %s (release pull-request of `%s` into `%s`)\n", pullRequest.URL, pullRequest.Title, pullRequest.ReleaseBranch, pullRequest.DestinationBranch)
+			continue
+		}
+
+		if pullRequest.Status == bitbucketrelease_dto.PullRequestStatusMerged {
+			merged += fmt.Sprintf("%s - %s", pullRequest.URL, pullRequest.Title)
+			if pullRequest.ReleaseBranch != "" {
+				merged += fmt.Sprintf(" (into `%s`)", pullRequest.ReleaseBranch)
+			}
+
+			if pullRequest.ReleasePullRequestLink != "" {
+				merged += fmt.Sprintf(", release pull-request: %s", pullRequest.ReleasePullRequestLink)
+			}
+
+			merged += "\n"
+			continue
+		}
+
+		failed += fmt.Sprintf("%s - %s\n", pullRequest.URL, pullRequest.Reason)
+	}
+
+	if merged != "" {
+		result += fmt.Sprintf("Merged pull-requests:\n%s", merged)
+	}
+
+	if failed != "" {
+		result += fmt.Sprintf("Failed pull-requests:\n%s", failed)
+	}
+
+	return result
+}
@@ -0,0 +1,100 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/container"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// referenceTrimCharacters the punctuation and the formatting characters around the reference, which are not part of it
+const referenceTrimCharacters = "()[]{}<>.,;:!?'\"`*_~"
+
+var (
+	//slackLinkRegex the link formatted by Slack: <https://...> or <https://...|label>
+	slackLinkRegex = regexp.MustCompile(`<([^<>|\s]+)(?:\|[^<>]*)?>`)
+
+	//shortReferenceRegex the short reference to bitbucket.org pull-request: {workspace}/{repository}#{id} or {repository}#{id}
+	shortReferenceRegex = regexp.MustCompile(`^(?:([\w.-]+)/)?([\w.-]+)#(\d+)$`)
+)
+
+// parsePullRequestReferences returns the de-duplicated pull-requests referenced in the text by the links or by the short references.
+// The references, which look like pull-requests, but cannot be parsed, are returned in the errors
+func parsePullRequestReferences(text string) ReceivedPullRequests {
+	var result = ReceivedPullRequests{}
+
+	tokens := strings.FieldsFunc(slackLinkRegex.ReplaceAllString(text, " $1 "), func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+
+	for _, token := range tokens {
+		token = strings.Trim(token, referenceTrimCharacters)
+		if token == "" {
+			continue
+		}
+
+		pullRequest, err := parsePullRequestReference(token)
+		if err == bitbucket_release_services.ErrNotPullRequestLink {
+			continue
+		}
+
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("`%s` - %s", token, err))
+			continue
+		}
+
+		if !containsPullRequest(result.Items, pullRequest) {
+			result.Items = append(result.Items, pullRequest)
+		}
+	}
+
+	return result
+}
+
+// parsePullRequestReference parses the link or the short reference to the pull-request
+func parsePullRequestReference(token string) (bitbucketrelease_dto.PullRequest, error) {
+	lowerToken := strings.ToLower(token)
+	if strings.HasPrefix(lowerToken, "https://") || strings.HasPrefix(lowerToken, "http://") {
+		return bitbucket_release_services.ParsePullRequestLink(token)
+	}
+
+	matches := shortReferenceRegex.FindStringSubmatch(token)
+	if len(matches) == 0 {
+		return bitbucketrelease_dto.PullRequest{}, bitbucket_release_services.ErrNotPullRequestLink
+	}
+
+	workspace := matches[1]
+	if workspace == "" {
+		workspace = container.C.Config.BitBucketConfig.DefaultWorkspace
+	}
+
+	if workspace == "" {
+		return bitbucketrelease_dto.PullRequest{}, errors.New("The workspace is unknown. Please use {workspace}/{repository}#{id} or define the default workspace in the BitBucket configuration of `.env`.")
+	}
+
+	id, err := strconv.ParseInt(matches[3], 10, 64)
+	if err != nil || id <= 0 {
+		return bitbucketrelease_dto.PullRequest{}, fmt.Errorf("The pull-request ID `%s` should be a positive number.", matches[3])
+	}
+
+	return bitbucketrelease_dto.PullRequest{
+		Workspace:      workspace,
+		RepositorySlug: matches[2],
+		ID:             id,
+	}, nil
+}
+
+func containsPullRequest(pullRequests []bitbucketrelease_dto.PullRequest, pullRequest bitbucketrelease_dto.PullRequest) bool {
+	for _, item := range pullRequests {
+		if item.Is(pullRequest) {
+			return true
+		}
+	}
+
+	return false
+}
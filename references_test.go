@@ -0,0 +1,60 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/internal/container"
+	"testing"
+)
+
+func TestParsePullRequestReferences(t *testing.T) {
+	previous := container.C.Config.BitBucketConfig.DefaultWorkspace
+	container.C.Config.BitBucketConfig.DefaultWorkspace = "default-workspace"
+	t.Cleanup(func() {
+		container.C.Config.BitBucketConfig.DefaultWorkspace = previous
+	})
+
+	cases := []struct {
+		text     string
+		expected []string
+		errors   int
+	}{
+		{text: "release my-workspace/api#12", expected: []string{"my-workspace/api#12"}},
+		{text: "release api#12, web#3", expected: []string{"default-workspace/api#12", "default-workspace/web#3"}},
+		{text: "release <https://bitbucket.org/my-workspace/api/pull-requests/12|api#12> and (api#12).", expected: []string{"my-workspace/api#12", "default-workspace/api#12"}},
+		{text: "release https://bitbucket.org/my-workspace/api/pull-requests/12 https://bitbucket.org/my-workspace/api/pull-requests/12/diff", expected: []string{"my-workspace/api#12"}},
+		{text: "release api#0", errors: 1},
+		{text: "release #12 please", expected: nil},
+		{text: "hello", expected: nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.text, func(t *testing.T) {
+			result := parsePullRequestReferences(c.text)
+
+			var references []string
+			for _, pullRequest := range result.Items {
+				references = append(references, fmt.Sprintf("%s/%s#%d", pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID))
+			}
+
+			if fmt.Sprint(references) != fmt.Sprint(c.expected) {
+				t.Errorf("expected %v, got %v", c.expected, references)
+			}
+
+			if len(result.Errors) != c.errors {
+				t.Errorf("expected %d errors, got %v", c.errors, result.Errors)
+			}
+		})
+	}
+}
+
+func TestParsePullRequestReferenceWithoutDefaultWorkspace(t *testing.T) {
+	previous := container.C.Config.BitBucketConfig.DefaultWorkspace
+	container.C.Config.BitBucketConfig.DefaultWorkspace = ""
+	t.Cleanup(func() {
+		container.C.Config.BitBucketConfig.DefaultWorkspace = previous
+	})
+
+	if _, err := parsePullRequestReference("api#12"); err == nil {
+		t.Error("expected the error, when the workspace is unknown")
+	}
+}
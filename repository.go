@@ -0,0 +1,87 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"strings"
+)
+
+func isRepositoryRelease(text string) bool {
+	return commandOf(text).Subcommand == "repo"
+}
+
+// receivedPullRequests returns the pull-requests, which should be released: the open pull-requests of the repository for `release repo` command, otherwise the pull-requests referenced in the message
+func receivedPullRequests(text string) (ReceivedPullRequests, error) {
+	if !isRepositoryRelease(text) {
+		return parsePullRequestReferences(text), nil
+	}
+
+	return repositoryPullRequests(text)
+}
+
+// repositoryPullRequests returns the open pull-requests of the repository from `release repo {workspace}/{repository} [--to {branch}]` message
+func repositoryPullRequests(text string) (ReceivedPullRequests, error) {
+	received := commandOf(text)
+	if received.Argument(0) == "" {
+		return ReceivedPullRequests{}, errors.New("Please send me ```release repo {workspace}/{repository}```.")
+	}
+
+	host, workspace, repository, err := parseRepositoryReference(commandArgument(received.Argument(0)))
+	if err != nil {
+		return ReceivedPullRequests{}, err
+	}
+
+	destinationBranch := strings.Trim(received.Flag("to"), referenceTrimCharacters)
+
+	pullRequests, err := bitbucket_release_services.ProviderFor(host).OpenPullRequests(context.Background(), workspace, repository, destinationBranch)
+	if err != nil {
+		return ReceivedPullRequests{}, err
+	}
+
+	if len(pullRequests) == 0 {
+		return ReceivedPullRequests{}, fmt.Errorf("There is no open pull-requests in repository `%s/%s`.", workspace, repository)
+	}
+
+	providerHost, _ := bitbucket_release_services.ProviderHostFor(host)
+
+	var result = ReceivedPullRequests{}
+	for _, pullRequest := range pullRequests {
+		result.Items = append(result.Items, bitbucketrelease_dto.PullRequest{
+			Host:           host,
+			Provider:       providerHost.Type,
+			ID:             pullRequest.ID,
+			Workspace:      workspace,
+			RepositorySlug: repository,
+		})
+	}
+
+	return result, nil
+}
+
+// parseRepositoryReference parses `{workspace}/{repository}` of bitbucket.org or `{host}/{workspace}/{repository}` of the configured provider host
+func parseRepositoryReference(reference string) (string, string, string, error) {
+	reference = strings.Trim(reference, referenceTrimCharacters)
+	for _, prefix := range []string{"https://", "http://"} {
+		reference = strings.TrimPrefix(reference, prefix)
+	}
+
+	segments := strings.Split(strings.Trim(reference, "/"), "/")
+	if len(segments) > 2 {
+		if providerHost, ok := bitbucket_release_services.ProviderHostFor(segments[0]); ok {
+			return providerHost.Host, strings.Join(segments[1:len(segments)-1], "/"), segments[len(segments)-1], nil
+		}
+	}
+
+	if len(segments) == 3 && strings.EqualFold(segments[0], "bitbucket.org") {
+		segments = segments[1:]
+	}
+
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return "", "", "", fmt.Errorf("The repository `%s` should be defined as {workspace}/{repository}.", reference)
+	}
+
+	return "", segments[0], segments[1], nil
+}
@@ -0,0 +1,90 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// loadReleaseConfig loads the release configuration of the test and restores the configuration of the environment after it
+func loadReleaseConfig(t *testing.T, config string) {
+	path := filepath.Join(t.TempDir(), "release.json")
+	if err := os.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = bitbucket_release_services.LoadConfig()
+	})
+	t.Setenv("BITBUCKET_RELEASE_CONFIG_FILE", path)
+
+	if err := bitbucket_release_services.LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseRepositoryReference(t *testing.T) {
+	loadReleaseConfig(t, `{"servers": [{"type": "bitbucket_server", "host": "git.example.com"}]}`)
+
+	cases := []struct {
+		reference string
+		expected  string
+		err       bool
+	}{
+		{reference: "my-workspace/api", expected: "/my-workspace/api"},
+		{reference: "<https://bitbucket.org/my-workspace/api/>", expected: "/my-workspace/api"},
+		{reference: "git.example.com/PRJ/api", expected: "git.example.com/PRJ/api"},
+		{reference: "https://git.example.com/group/subgroup/api", expected: "git.example.com/group/subgroup/api"},
+		{reference: "api", err: true},
+		{reference: "unknown.example.com/PRJ/api", err: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.reference, func(t *testing.T) {
+			host, workspace, repository, err := parseRepositoryReference(c.reference)
+			if c.err {
+				if err == nil {
+					t.Errorf("expected the error, got %s/%s/%s", host, workspace, repository)
+				}
+				return
+			}
+
+			if err != nil || fmt.Sprintf("%s/%s/%s", host, workspace, repository) != c.expected {
+				t.Errorf("expected %s, got %s/%s/%s, %v", c.expected, host, workspace, repository, err)
+			}
+		})
+	}
+}
+
+func TestRepositoryPullRequests(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		_, _ = w.Write([]byte(`[{"number": 3, "state": "open"}, {"number": 5, "state": "open"}]`))
+	}))
+	defer server.Close()
+
+	loadReleaseConfig(t, fmt.Sprintf(`{"servers": [{"type": "github", "host": "github.com", "url": %q}]}`, server.URL))
+
+	received, err := repositoryPullRequests("release repo github.com/my-owner/api --to develop")
+	if err != nil {
+		t.Fatalf("expected no error, got %s", err)
+	}
+
+	if !strings.Contains(query, "base=develop") {
+		t.Errorf("expected the pull-requests into the `--to` branch, got the query %q", query)
+	}
+
+	if len(received.Items) != 2 || received.Items[0].ID != 3 || received.Items[1].ID != 5 || received.Items[0].Host != "github.com" || received.Items[0].Workspace != "my-owner" || received.Items[0].RepositorySlug != "api" {
+		t.Errorf("expected both open pull-requests of the repository, got %+v", received.Items)
+	}
+
+	if _, err = repositoryPullRequests("release repo"); err == nil || !strings.Contains(err.Error(), "release repo {workspace}/{repository}") {
+		t.Errorf("expected the usage of the command, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_database"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+	"strconv"
+	"strings"
+)
+
+func isRevertCommand(text string) bool {
+	return commandOf(text).Subcommand == "revert"
+}
+
+// revertPullRequests returns the merged pull-requests, which should be reverted. The message can contain the release ID or the links to the pull-requests
+func revertPullRequests(text string) ([]bitbucketrelease_dto.ReleasePullRequest, error) {
+	foundPullRequests := parsePullRequestReferences(text)
+	if len(foundPullRequests.Errors) > 0 {
+		return nil, errors.New(strings.Join(foundPullRequests.Errors, "; "))
+	}
+
+	if len(foundPullRequests.Items) > 0 {
+		var result []bitbucketrelease_dto.ReleasePullRequest
+		for _, pullRequest := range foundPullRequests.Items {
+			item, err := bitbucket_release_database.FindMergedReleasePullRequest(pullRequest.Host, pullRequest.Workspace, pullRequest.RepositorySlug, pullRequest.ID)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s", pullRequest.URL(), err)
+			}
+
+			result = append(result, item)
+		}
+
+		return revertTargets(result, releasePullRequestOf)
+	}
+
+	argument := strings.TrimPrefix(commandOf(text).Argument(0), "#")
+	releaseID, err := strconv.ParseInt(argument, 10, 64)
+	if err != nil {
+		return nil, errors.New("Please send me ```release revert {release-id}``` or ```release revert {links-to-pull-requests}```.")
+	}
+
+	release, err := bitbucket_release_database.FindRelease(releaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []bitbucketrelease_dto.ReleasePullRequest
+	for _, pullRequest := range release.PullRequests {
+		if pullRequest.Status == bitbucketrelease_dto.PullRequestStatusMerged {
+			result = append(result, pullRequest)
+		}
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("There is no merged pull-requests in the release #%d.", releaseID)
+	}
+
+	return revertTargets(result, releasePullRequestOf)
+}
+
+// revertTargets returns the pull-requests, which should be reverted. The pull-request merged into the release branch came to the destination branch with the release pull-request,
+// so its release pull-request is reverted instead. Every pull-request is returned once
+func revertTargets(pullRequests []bitbucketrelease_dto.ReleasePullRequest, releasePullRequest func(pullRequest bitbucketrelease_dto.ReleasePullRequest) (bitbucketrelease_dto.ReleasePullRequest, error)) ([]bitbucketrelease_dto.ReleasePullRequest, error) {
+	var (
+		result []bitbucketrelease_dto.ReleasePullRequest
+		found  = map[string]bool{}
+	)
+
+	for _, pullRequest := range pullRequests {
+		if pullRequest.ReleaseBranch != "" && !pullRequest.IsReleasePullRequest() {
+			item, err := releasePullRequest(pullRequest)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s", pullRequest.URL, err)
+			}
+
+			pullRequest = item
+		}
+
+		if found[pullRequest.URL] {
+			continue
+		}
+
+		found[pullRequest.URL] = true
+		result = append(result, pullRequest)
+	}
+
+	return result, nil
+}
+
+// releasePullRequestOf returns the merged release pull-request of the pull-request, which was merged into the release branch
+func releasePullRequestOf(pullRequest bitbucketrelease_dto.ReleasePullRequest) (bitbucketrelease_dto.ReleasePullRequest, error) {
+	if pullRequest.ReleasePullRequestLink == "" {
+		return bitbucketrelease_dto.ReleasePullRequest{}, fmt.Errorf("The release pull-request of the release branch `%s` was not opened, so the pull-request is not in `%s`.", pullRequest.ReleaseBranch, pullRequest.DestinationBranch)
+	}
+
+	reference, err := parsePullRequestReference(pullRequest.ReleasePullRequestLink)
+	if err != nil {
+		return bitbucketrelease_dto.ReleasePullRequest{}, errors.Wrap(err, "Failed to parse the release pull-request link")
+	}
+
+	item, err := bitbucket_release_database.FindMergedReleasePullRequest(reference.Host, reference.Workspace, reference.RepositorySlug, reference.ID)
+	if err != bitbucket_release_database.ErrReleasePullRequestNotFound {
+		return item, err
+	}
+
+	//The release pull-request, which was merged manually while the auto-merge was disabled, is not in the history, so the VCS provider is asked about it
+	return bitbucket_release_services.MergedReleasePullRequest(pullRequest.ReleaseID, reference)
+}
+
+// revertRelease opens the revert pull-requests for the merged pull-requests and sends their links to the channel
+func revertRelease(message dto.BaseChatMessage) string {
+	pullRequests, err := revertPullRequests(message.OriginalMessage.Text)
+	if err != nil {
+		return fmt.Sprintf("I cannot revert it. Reason: `%s`", err)
+	}
+
+	var text = ""
+	for _, pullRequest := range pullRequests {
+		link, err := bitbucket_release_services.RevertPullRequest(pullRequest)
+		if err != nil {
+			log.Logger().AddError(err).
+				Int64("pull_request_id", pullRequest.PullRequestID).
+				Msg("Failed to revert the pull-request")
+			text += fmt.Sprintf("%s - I failed to revert it. Reason: `%s`\n", pullRequest.URL, err)
+			continue
+		}
+
+		if pullRequest.IsReleasePullRequest() {
+			text += fmt.Sprintf("%s - it reverts all pull-requests of the release branch `%s`, please approve revert pull-request: %s\n", pullRequest.URL, pullRequest.ReleaseBranch, link)
+			continue
+		}
+
+		text += fmt.Sprintf("%s - please approve revert pull-request: %s\n", pullRequest.URL, link)
+	}
+
+	bitbucket_release_services.SendMessageToTheChannel(message.Channel, text)
+
+	return "Done"
+}
@@ -0,0 +1,66 @@
+package bitbucketrelease
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"testing"
+)
+
+func TestRevertTargetsOfReleaseBranch(t *testing.T) {
+	const releasePullRequestLink = "https://bitbucket.org/my-workspace/api/pull-requests/3"
+
+	var (
+		direct             = bitbucketrelease_dto.ReleasePullRequest{ReleaseID: 12, URL: "https://bitbucket.org/my-workspace/web/pull-requests/1", Status: bitbucketrelease_dto.PullRequestStatusMerged, MergeCommit: "aaa", DestinationBranch: "master"}
+		first              = bitbucketrelease_dto.ReleasePullRequest{ReleaseID: 12, URL: "https://bitbucket.org/my-workspace/api/pull-requests/1", Status: bitbucketrelease_dto.PullRequestStatusMerged, MergeCommit: "bbb", DestinationBranch: "master", ReleaseBranch: "release/1", ReleasePullRequestLink: releasePullRequestLink}
+		second             = bitbucketrelease_dto.ReleasePullRequest{ReleaseID: 12, URL: "https://bitbucket.org/my-workspace/api/pull-requests/2", Status: bitbucketrelease_dto.PullRequestStatusMerged, MergeCommit: "ccc", DestinationBranch: "master", ReleaseBranch: "release/1", ReleasePullRequestLink: releasePullRequestLink}
+		releasePullRequest = bitbucketrelease_dto.ReleasePullRequest{ReleaseID: 12, URL: releasePullRequestLink, Status: bitbucketrelease_dto.PullRequestStatusMerged, MergeCommit: "ddd", DestinationBranch: "master", ReleaseBranch: "release/1", ReleasePullRequestLink: releasePullRequestLink}
+	)
+
+	merged := func(pullRequest bitbucketrelease_dto.ReleasePullRequest) (bitbucketrelease_dto.ReleasePullRequest, error) {
+		if pullRequest.ReleasePullRequestLink != releasePullRequestLink {
+			t.Errorf("expected the release pull-request of %s to be requested, got %s", pullRequest.URL, pullRequest.ReleasePullRequestLink)
+		}
+
+		return releasePullRequest, nil
+	}
+
+	cases := []struct {
+		name         string
+		pullRequests []bitbucketrelease_dto.ReleasePullRequest
+		expected     string
+	}{
+		{name: "release", pullRequests: []bitbucketrelease_dto.ReleasePullRequest{direct, first, second, releasePullRequest}, expected: fmt.Sprint([]string{direct.URL, releasePullRequestLink})},
+		{name: "pull-request of release branch", pullRequests: []bitbucketrelease_dto.ReleasePullRequest{second}, expected: fmt.Sprint([]string{releasePullRequestLink})},
+		{name: "release pull-request", pullRequests: []bitbucketrelease_dto.ReleasePullRequest{releasePullRequest}, expected: fmt.Sprint([]string{releasePullRequestLink})},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			targets, err := revertTargets(c.pullRequests, merged)
+			if err != nil {
+				t.Fatalf("expected no error, got %s", err)
+			}
+
+			var links []string
+			for _, target := range targets {
+				links = append(links, target.URL)
+			}
+
+			if fmt.Sprint(links) != c.expected {
+				t.Errorf("expected to revert %s, got %v", c.expected, links)
+			}
+
+			if last := targets[len(targets)-1]; last.URL == releasePullRequestLink && last.MergeCommit != "ddd" {
+				t.Errorf("expected the merge commit of the release pull-request, got %+v", last)
+			}
+		})
+	}
+
+	_, err := revertTargets([]bitbucketrelease_dto.ReleasePullRequest{direct, first}, func(bitbucketrelease_dto.ReleasePullRequest) (bitbucketrelease_dto.ReleasePullRequest, error) {
+		return bitbucketrelease_dto.ReleasePullRequest{}, errors.New("The release pull-request is not merged.")
+	})
+	if err == nil || err.Error() != first.URL+" The release pull-request is not merged." {
+		t.Errorf("expected the revert to be refused, when the release pull-request is not merged, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package bitbucketrelease
+
+import (
+	"fmt"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/internal/dto"
+	"time"
+)
+
+// releaseStatusText returns the release of the user, which waits for the confirmation, and the release pull-requests, which wait for the automatic merge
+func releaseStatusText(message dto.BaseChatMessage) string {
+	var text = ""
+
+	pending, ok := peekPendingRelease(message)
+	switch {
+	case !ok:
+		text += "There is no release waiting for your confirmation.\n"
+	case pending.PullRequestCreation != nil:
+		text += fmt.Sprintf("I wait %s for your confirmation to create the pull-request from the branch `%s` of repository `%s`.\n", time.Until(pending.ExpiresAt).Round(time.Second), pending.PullRequestCreation.BranchName, pending.PullRequestCreation.RepositorySlug)
+	default:
+		text += fmt.Sprintf("I wait %s for your confirmation of the release plan:\n%s", time.Until(pending.ExpiresAt).Round(time.Second), releasePlanText(pending.Message, pending.Plan))
+	}
+
+	watched := bitbucket_release_services.WatchedReleasePullRequests()
+	if len(watched) == 0 {
+		text += "There are no release pull-requests waiting for the automatic merge."
+		return text
+	}
+
+	text += "These release pull-requests wait for the approvals and the green build to be merged:\n"
+	for _, link := range watched {
+		text += fmt.Sprintf("- %s\n", link)
+	}
+
+	return text
+}
@@ -0,0 +1,103 @@
+package bitbucketrelease
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucket_release_services"
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"github.com/sharovik/devbot/internal/dto"
+	"github.com/sharovik/devbot/internal/log"
+)
+
+func isAllOrNothing(text string) bool {
+	if bitbucket_release_services.Config().AllOrNothing {
+		return true
+	}
+
+	return commandOf(text).HasFlag("all-or-nothing")
+}
+
+// releaseAllOrNothing prepares the release branches of all repositories before any merge. If any repository cannot be prepared, the switched pull-requests are restored and nothing is merged.
+// The merge itself is not atomic: when the merge of a repository fails, the repositories merged before it stay merged and the rest of them are restored
+func releaseAllOrNothing(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan) error {
+	log.Logger().StartMessage("Merge of received pull-requests")
+	defer log.Logger().FinishMessage("Merge of received pull-requests")
+
+	options := releaseOptions(message.OriginalMessage.Text)
+	prepared, err := prepareRepositories(message, release, options, plan)
+	if err != nil {
+		restorePreparedRepositories(message, release, prepared, plan.Repositories)
+		rollbackRelease(release, plan, fmt.Sprintf("Nothing was merged, because the release of all pull-requests cannot be prepared: %s", err))
+		return errors.Wrap(err, "The release cannot be prepared, so nothing was merged")
+	}
+
+	bitbucket_release_services.SendMessageToTheChannel(message.Channel, "All repositories are prepared, I start to merge the pull-requests.")
+
+	for i, repositoryPlan := range plan.Repositories {
+		if mergesDirectly(options, repositoryPlan) {
+			err = bitbucket_release_services.MergeOnePullRequestScenario(message, release, options, repositoryPlan.PullRequests)
+		} else {
+			err = bitbucket_release_services.MergePreparedRepository(message, release, options, prepared[repositoryPlan.Key()])
+		}
+
+		if err == nil {
+			continue
+		}
+
+		//The merged pull-requests cannot be unmerged, but we stop the release and restore the pull-requests, which were not merged yet
+		//The failed repository is already restored by the merge scenario
+		notReleased := bitbucketrelease_dto.MergePlan{Repositories: plan.Repositories[i:]}
+		restorePreparedRepositories(message, release, prepared, plan.Repositories[i+1:])
+		rollbackRelease(release, notReleased, fmt.Sprintf("The release was stopped, because the release of repository `%s` failed.", repositoryPlan.RepositorySlug))
+		bitbucket_release_services.SendMessageToTheChannel(message.Channel, fmt.Sprintf("I failed to release repository `%s`, so I stop the release. Reason: `%s`", repositoryPlan.RepositorySlug, err))
+		return errors.Wrap(err, fmt.Sprintf("The release of repository %s failed", repositoryPlan.RepositorySlug))
+	}
+
+	return nil
+}
+
+// prepareRepositories prepares the release branches of the repositories with multiple pull-requests and checks the target branch of the repositories, which are merged directly.
+// Any pull-request, which cannot be prepared, fails the whole release
+func prepareRepositories(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, options bitbucketrelease_dto.ReleaseOptions, plan bitbucketrelease_dto.MergePlan) (map[bitbucketrelease_dto.RepositoryKey]bitbucket_release_services.PreparedRepository, error) {
+	var prepared = map[bitbucketrelease_dto.RepositoryKey]bitbucket_release_services.PreparedRepository{}
+	for _, repositoryPlan := range plan.Repositories {
+		if mergesDirectly(options, repositoryPlan) {
+			if err := bitbucket_release_services.ValidateTarget(context.Background(), repositoryPlan.Host, repositoryPlan.Workspace, repositoryPlan.RepositorySlug, options.Target); err != nil {
+				return prepared, err
+			}
+
+			continue
+		}
+
+		preparedRepository, err := bitbucket_release_services.PrepareRepository(message, release, options, repositoryPlan.RepositorySlug, repositoryPlan.PullRequests)
+		prepared[repositoryPlan.Key()] = preparedRepository
+		if err != nil {
+			return prepared, err
+		}
+
+		if len(preparedRepository.Failed) > 0 {
+			return prepared, errors.New(fmt.Sprintf("The destination of %d pull-request(s) of repository %s cannot be switched.", len(preparedRepository.Failed), repositoryPlan.RepositorySlug))
+		}
+	}
+
+	return prepared, nil
+}
+
+// restorePreparedRepositories restores the prepared pull-requests of selected repositories, which were not merged
+func restorePreparedRepositories(message dto.BaseChatMessage, release *bitbucketrelease_dto.Release, prepared map[bitbucketrelease_dto.RepositoryKey]bitbucket_release_services.PreparedRepository, repositories []bitbucketrelease_dto.RepositoryMergePlan) {
+	for _, repositoryPlan := range repositories {
+		if preparedRepository, ok := prepared[repositoryPlan.Key()]; ok {
+			bitbucket_release_services.CompensateRepository(message, release, preparedRepository, "The release was stopped.")
+		}
+	}
+}
+
+// rollbackRelease marks the not merged pull-requests of the plan as failed
+func rollbackRelease(release *bitbucketrelease_dto.Release, plan bitbucketrelease_dto.MergePlan, reason string) {
+	for _, pullRequest := range plan.PullRequests() {
+		if release.PullRequestResult(pullRequest).Status != bitbucketrelease_dto.PullRequestStatusMerged {
+			release.SetPullRequestStatus(pullRequest, bitbucketrelease_dto.PullRequestStatusMergeFailed, reason)
+		}
+	}
+}
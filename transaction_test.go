@@ -0,0 +1,64 @@
+package bitbucketrelease
+
+import (
+	"github.com/sharovik/devbot/events/bitbucketrelease/bitbucketrelease_dto"
+	"testing"
+)
+
+func TestIsAllOrNothing(t *testing.T) {
+	if !isAllOrNothing("release my-workspace/api#1 my-workspace/web#2 --all-or-nothing") {
+		t.Error("expected the all-or-nothing release with the flag")
+	}
+
+	if isAllOrNothing("release my-workspace/api#1 my-workspace/web#2") {
+		t.Error("expected the usual release without the flag")
+	}
+
+	if !releaseOptions("release my-workspace/api#1 my-workspace/web#2 --all-or-nothing").AllOrNothing {
+		t.Error("expected the all-or-nothing release options with the flag")
+	}
+}
+
+func TestRollbackRelease(t *testing.T) {
+	var (
+		release = bitbucketrelease_dto.NewRelease("U1", "C1")
+		merged  = bitbucketrelease_dto.PullRequest{Workspace: "my-workspace", RepositorySlug: "api", ID: 1}
+		failed  = bitbucketrelease_dto.PullRequest{Workspace: "my-workspace", RepositorySlug: "web", ID: 2}
+		plan    bitbucketrelease_dto.MergePlan
+	)
+
+	plan.Add(merged)
+	plan.Add(failed)
+	release.SetPullRequestStatus(merged, bitbucketrelease_dto.PullRequestStatusMerged, "")
+
+	rollbackRelease(release, plan, "The release was stopped.")
+
+	if result := release.PullRequestResult(merged); result.Status != bitbucketrelease_dto.PullRequestStatusMerged {
+		t.Errorf("expected the merged pull-request to stay merged, got %+v", result)
+	}
+
+	if result := release.PullRequestResult(failed); result.Status != bitbucketrelease_dto.PullRequestStatusMergeFailed || result.Reason != "The release was stopped." {
+		t.Errorf("expected the not merged pull-request to be failed, got %+v", result)
+	}
+}
+
+func TestMergedPullRequestsText(t *testing.T) {
+	release := &bitbucketrelease_dto.Release{PullRequests: []bitbucketrelease_dto.ReleasePullRequest{
+		{URL: "https://bitbucket.org/my-workspace/web/pull-requests/1", Status: bitbucketrelease_dto.PullRequestStatusMerged, DestinationBranch: "master"},
+		{URL: "https://bitbucket.org/my-workspace/api/pull-requests/1", Status: bitbucketrelease_dto.PullRequestStatusMerged, ReleaseBranch: "release/1", ReleasePullRequestLink: "https://bitbucket.org/my-workspace/api/pull-requests/3"},
+		{URL: "https://bitbucket.org/my-workspace/api/pull-requests/2", Status: bitbucketrelease_dto.PullRequestStatusMergeFailed, Reason: "The release was stopped."},
+		{URL: "https://bitbucket.org/my-workspace/docs/pull-requests/1", Status: bitbucketrelease_dto.PullRequestStatusMerged, ReleaseBranch: "release/2"},
+	}}
+
+	expected := "- https://bitbucket.org/my-workspace/web/pull-requests/1 is merged into `master`\n" +
+		"- https://bitbucket.org/my-workspace/api/pull-requests/1 is merged into the release branch `release/1`, it goes out with the release pull-request https://bitbucket.org/my-workspace/api/pull-requests/3\n" +
+		"- https://bitbucket.org/my-workspace/docs/pull-requests/1 is merged into the release branch `release/2`, which has no release pull-request\n"
+
+	if text := mergedPullRequestsText(release); text != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, text)
+	}
+
+	if text := mergedPullRequestsText(&bitbucketrelease_dto.Release{}); text != "" {
+		t.Errorf("expected no text without the merged pull-requests, got %q", text)
+	}
+}